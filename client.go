@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -56,6 +57,10 @@ func createClient(conf *Config) (c *Client, err error) {
 			},
 		}
 	}
+	if conf.Logger == nil {
+		conf.Logger = logger.Empty{}
+	}
+
 	httdClient, err := httd.NewClient(&httd.Config{
 		APIVersion:                   constant.DiscordVersion,
 		BotToken:                     conf.BotToken,
@@ -65,6 +70,10 @@ func createClient(conf *Config) (c *Client, err error) {
 		HTTPClient:                   conf.HTTPClient,
 		CancelRequestWhenRateLimited: conf.CancelRequestWhenRateLimited,
 		RESTBucketManager:            conf.RESTBucketManager,
+		RESTBucketStore:              conf.RESTBucketStore,
+		RetryPolicy:                  conf.RetryPolicy,
+		RESTMiddlewares:              conf.RESTMiddlewares,
+		Logger:                       conf.Logger,
 	})
 	if err != nil {
 		return nil, err
@@ -76,10 +85,6 @@ func createClient(conf *Config) (c *Client, err error) {
 
 	conf.shutdownChan = make(chan interface{})
 
-	if conf.Logger == nil {
-		conf.Logger = logger.Empty{}
-	}
-
 	// ignore PRESENCES_REPLACE: https://github.com/discord/discord-api-docs/issues/683
 	conf.IgnoreEvents = append(conf.IgnoreEvents, "PRESENCES_REPLACE")
 
@@ -134,6 +139,182 @@ func createClient(conf *Config) (c *Client, err error) {
 
 type ShardConfig = gateway.ShardConfig
 
+// ShardStatus is a snapshot of a single shard. See Client.ShardStatus.
+type ShardStatus = gateway.ShardStatus
+
+// GatewaySessionStore persists gateway sessions across restarts. See ShardConfig.SessionStore.
+type GatewaySessionStore = gateway.SessionStore
+
+// GatewaySessionState is the stored session of a single shard.
+type GatewaySessionState = gateway.SessionState
+
+// NewFileSessionStore creates a GatewaySessionStore that keeps one JSON file per shard in the given directory.
+//  client := disgord.New(disgord.Config{
+//    ShardConfig: disgord.ShardConfig{
+//      SessionStore: disgord.NewFileSessionStore("sessions"),
+//    },
+//  })
+func NewFileSessionStore(dir string) GatewaySessionStore {
+	return gateway.NewFileSessionStore(dir)
+}
+
+// GatewayRecorder writes the gateway traffic of every shard into a single JSONL file. See ShardConfig.Recorder.
+type GatewayRecorder = gateway.Recorder
+
+// NewGatewayRecorder creates a GatewayRecorder that writes one JSON line per payload to w.
+//  f, err := os.Create("session.jsonl")
+//  client := disgord.New(disgord.Config{
+//    ShardConfig: disgord.ShardConfig{
+//      Recorder: disgord.NewGatewayRecorder(f),
+//    },
+//  })
+func NewGatewayRecorder(w io.Writer) *GatewayRecorder {
+	return gateway.NewRecorder(w)
+}
+
+// GatewayConn is the websocket connection of a shard. See ShardConfig.NewConn.
+type GatewayConn = gateway.Conn
+
+// GatewayConnConfig holds the settings given when creating a GatewayConn.
+type GatewayConnConfig = gateway.ConnConfig
+
+// GatewayCloseErr must be returned by GatewayConn.Read when Discord closes the connection.
+type GatewayCloseErr = gateway.CloseErr
+
+// NewGatewayCloseErr creates a GatewayCloseErr with the websocket close code.
+func NewGatewayCloseErr(code int, info string) *GatewayCloseErr {
+	return gateway.NewCloseErr(code, info)
+}
+
+// NewNhooyrConn creates a GatewayConn using nhooyr.io/websocket.
+func NewNhooyrConn(conf GatewayConnConfig) (GatewayConn, error) {
+	return gateway.NewNhooyrConn(conf)
+}
+
+// NewGorillaConn creates a GatewayConn using github.com/gorilla/websocket.
+func NewGorillaConn(conf GatewayConnConfig) (GatewayConn, error) {
+	return gateway.NewGorillaConn(conf)
+}
+
+// GatewayReplay plays back a recording from a GatewayRecorder. See ShardConfig.Replay.
+type GatewayReplay = gateway.Replay
+
+// NewGatewayReplay loads a recording such that the Client can run against it without connecting to Discord.
+// Note that REST requests are still sent to Discord, unless a custom HTTPClient is used.
+//  f, err := os.Open("testdata/session.jsonl")
+//  replay, err := disgord.NewGatewayReplay(f)
+//  client := disgord.New(disgord.Config{
+//    ShardConfig: disgord.ShardConfig{
+//      Replay: replay,
+//    },
+//  })
+//  client.On(disgord.EvtMessageCreate, handler)
+//  client.Connect(ctx)
+//  <-replay.Done()
+func NewGatewayReplay(r io.Reader) (*GatewayReplay, error) {
+	return gateway.NewReplay(r)
+}
+
+// ShardCoordinator assigns shards and synchronizes identifies across several disgord processes.
+// See ShardConfig.Coordinator.
+type ShardCoordinator = gateway.ShardCoordinator
+
+// ShardCoordinatorConfig configures a ShardCoordinatorServer
+type ShardCoordinatorConfig = gateway.ShardCoordinatorConfig
+
+// ShardCoordinatorServer is the reference ShardCoordinator implementation, which the disgord
+// processes connects to over a local TCP or unix socket.
+type ShardCoordinatorServer = gateway.ShardCoordinatorServer
+
+// NewShardCoordinatorServer creates a coordinator that can serve several disgord processes.
+//  coordinator, err := disgord.NewShardCoordinatorServer(disgord.ShardCoordinatorConfig{
+//    ShardCount: 10,
+//    Instances:  []string{"instance-1", "instance-2"},
+//  })
+//  listener, err := net.Listen("unix", "/tmp/disgord.sock")
+//  go coordinator.Serve(listener)
+func NewShardCoordinatorServer(conf ShardCoordinatorConfig) (*ShardCoordinatorServer, error) {
+	return gateway.NewShardCoordinatorServer(conf)
+}
+
+// NewShardCoordinatorClient connects a disgord process to a ShardCoordinatorServer. The instance name
+// must be one of ShardCoordinatorConfig.Instances, and decides which shards the process owns.
+//  client := disgord.New(disgord.Config{
+//    ShardConfig: disgord.ShardConfig{
+//      Coordinator: disgord.NewShardCoordinatorClient("unix", "/tmp/disgord.sock", "instance-1"),
+//    },
+//  })
+func NewShardCoordinatorClient(network, address, instance string) ShardCoordinator {
+	return gateway.NewShardCoordinatorClient(network, address, instance)
+}
+
+// RetryPolicy decides which failed REST requests are sent again. See Config.RetryPolicy.
+//  client := disgord.New(disgord.Config{
+//    RetryPolicy: &disgord.RetryPolicy{
+//      MaxAttempts: 5,
+//      RetryOn:     disgord.RetryOnServerErrors | disgord.RetryOnNetworkErrors,
+//    },
+//  })
+type RetryPolicy = httd.RetryPolicy
+
+// RetryOn is a set of failures that are retried by a RetryPolicy
+type RetryOn = httd.RetryOn
+
+const (
+	RetryOnServerErrors  = httd.RetryOnServerErrors
+	RetryOnNetworkErrors = httd.RetryOnNetworkErrors
+	RetryOnRateLimits    = httd.RetryOnRateLimits
+)
+
+// RetryError is returned when a request failed after being retried, unless the error is a *ErrRest.
+type RetryError = httd.RetryError
+
+// RESTRequest describes a request to the Discord REST API
+type RESTRequest = httd.Request
+
+// RESTMiddleware hooks into every REST request, see Config.RESTMiddlewares.
+//  client := disgord.New(disgord.Config{
+//    RESTMiddlewares: []disgord.RESTMiddleware{
+//      {
+//        After: func(ctx context.Context, info *disgord.RESTRequestInfo) {
+//          log.Println(info.Request.Method, info.Request.Endpoint, info.Bucket, info.Latency, info.Err)
+//        },
+//      },
+//    },
+//  })
+type RESTMiddleware = httd.RESTMiddleware
+
+// RESTRequestInfo describes a finished REST request, and is given to RESTMiddleware.After
+type RESTRequestInfo = httd.RESTRequestInfo
+
+// RESTBucketStore holds the REST rate limits, and can be shared by several clients. See Config.RESTBucketStore.
+type RESTBucketStore = httd.RESTBucketStore
+
+// RESTBucketStoreServer holds the REST rate limits of several disgord processes, which connect to it over a
+// local TCP or unix socket using NewRESTBucketStoreClient.
+type RESTBucketStoreServer = httd.BucketStoreServer
+
+// NewMemoryRESTBucketStore creates a store for sharing the REST rate limits between clients in the same process.
+func NewMemoryRESTBucketStore() RESTBucketStore {
+	return httd.NewMemoryBucketStore()
+}
+
+// NewRESTBucketStoreServer creates a server that holds the REST rate limits of several disgord processes.
+//  server := disgord.NewRESTBucketStoreServer()
+//  listener, err := net.Listen("unix", "/tmp/disgord-rest.sock")
+//  go server.Serve(listener)
+func NewRESTBucketStoreServer() *RESTBucketStoreServer {
+	return httd.NewBucketStoreServer()
+}
+
+// NewRESTBucketStoreClient connects a disgord process to a RESTBucketStoreServer.
+//  client := disgord.New(disgord.Config{
+//    RESTBucketStore: disgord.NewRESTBucketStoreClient("unix", "/tmp/disgord-rest.sock"),
+//  })
+func NewRESTBucketStoreClient(network, address string) RESTBucketStore {
+	return httd.NewBucketStoreClient(network, address)
+}
+
 // Config Configuration for the Disgord Client
 type Config struct {
 	// ################################################
@@ -157,7 +338,7 @@ type Config struct {
 
 	// LoadMembersQuietly will start fetching members for all guilds in the background.
 	// There is currently no proper way to detect when the loading is done nor if it
-	// finished successfully.
+	// finished successfully. See Client.RequestGuildMembers to wait for the members of a guild.
 	LoadMembersQuietly bool
 
 	// Presence will automatically be emitted to discord on start up
@@ -173,6 +354,20 @@ type Config struct {
 	// disgord.DefaultLogger() can be used
 	Logger Logger
 
+	// RetryPolicy decides which failed REST requests are sent again, eg. when Discord responds with a 502.
+	// POST and PATCH requests are only retried when the RetryNonIdempotent flag is given.
+	// Requests are not retried when nil.
+	RetryPolicy *RetryPolicy
+
+	// RESTMiddlewares hooks into every REST request, eg. for logging, metrics or tracing. The Before hooks are
+	// called in order, and the After hooks in reverse order.
+	RESTMiddlewares []RESTMiddleware
+
+	// VoiceEncryptionModes is the preference order of voice encryption modes, eg. VoiceModeXSalsa20Poly1305Lite.
+	// The first mode offered by the voice server is used. Defaults to the lite, suffix and then the legacy
+	// xsalsa20_poly1305 mode.
+	VoiceEncryptionModes []string
+
 	// ################################################
 	// ##
 	// ## WARNING! For advanced users only.
@@ -184,6 +379,11 @@ type Config struct {
 	// ################################################
 	RESTBucketManager httd.RESTBucketManager
 
+	// RESTBucketStore shares the REST rate limits with other clients using the same bot token, such as the
+	// other processes of a sharded bot. See NewRESTBucketStoreClient. When the store fails, the error is logged
+	// and the rate limits known by this client are used instead.
+	RESTBucketStore RESTBucketStore
+
 	DisableCache bool
 	CacheConfig  *CacheConfig
 	ShardConfig  ShardConfig
@@ -196,7 +396,18 @@ type Config struct {
 	// them at all due to how the identify command was defined. eg. guildS_subscriptions
 	IgnoreEvents []string
 
+	// Intents decides which groups of events Discord sends. Every event is sent when no intents are given.
+	// Registering a handler for an event that is not covered by the intents logs an error, see StrictIntents.
 	Intents gateway.Intent
+
+	// StrictIntents makes Client.AddHandler return an error, and Client.On panic, instead of logging an error,
+	// when the handler can never be triggered because of the configured Intents.
+	StrictIntents bool
+
+	// DeriveIntents adds the intents required by the registered handlers to Intents when connecting.
+	// IntentGuilds and IntentGuildVoiceStates are always included, as Disgord depends on the guild events
+	// and Client.VoiceConnect on the voice states. See Client.RequiredIntents.
+	DeriveIntents bool
 }
 
 // Client is the main disgord Client to hold your state and data. You must always initiate it using the constructor
@@ -235,6 +446,15 @@ type Client struct {
 	connectedGuilds      []Snowflake
 	connectedGuildsMutex sync.RWMutex
 
+	// pending RequestGuildMembers calls, by nonce
+	memberRequests   map[string]*guildMembersRequest
+	memberRequestNr  uint
+	memberRequestsMu sync.Mutex
+
+	// intents that can trigger the handlers registered through On
+	handlerIntents   gateway.Intent
+	handlerIntentsMu sync.Mutex
+
 	cache *Cache
 
 	log Logger
@@ -322,6 +542,32 @@ func (c *Client) HeartbeatLatencies() (latencies map[uint]time.Duration, err err
 	return c.shardManager.HeartbeatLatencies()
 }
 
+// ShardStatus returns a snapshot of every shard run by this Client, sorted by shard ID. See EvtShardConnecting,
+// EvtShardReady, EvtShardResumed, EvtShardDisconnected and EvtShardZombied to be notified about changes.
+func (c *Client) ShardStatus() (statuses []ShardStatus, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	if c.shardManager == nil {
+		return nil, errors.New("you must connect before you can get the shard status")
+	}
+
+	statuses = c.shardManager.ShardStatus()
+	shardCount := c.shardManager.ShardCount()
+	index := make(map[uint]int, len(statuses))
+	for i := range statuses {
+		index[statuses[i].ShardID] = i
+	}
+
+	c.connectedGuildsMutex.RLock()
+	defer c.connectedGuildsMutex.RUnlock()
+	for _, guildID := range c.connectedGuilds {
+		if i, ok := index[gateway.GetShardForGuildID(guildID, shardCount)]; ok {
+			statuses[i].Guilds++
+		}
+	}
+	return statuses, nil
+}
+
 // Myself get the current user / connected user
 // Deprecated: use GetCurrentUser instead
 func (c *Client) Myself(ctx context.Context) (user *User, err error) {
@@ -379,11 +625,12 @@ func (c *Client) setupConnectEnv() {
 	// set the user ID upon connection
 	// only works with socket logic
 	if c.config.LoadMembersQuietly {
-		c.On(EvtReady, c.handlerLoadMembers)
+		c.on(EvtReady, c.handlerLoadMembers)
 	}
-	c.On(EvtUserUpdate, c.handlerUpdateSelfBot)
-	c.On(EvtGuildCreate, c.handlerAddToConnectedGuilds)
-	c.On(EvtGuildDelete, c.handlerRemoveFromConnectedGuilds)
+	c.on(EvtUserUpdate, c.handlerUpdateSelfBot)
+	c.on(EvtGuildMembersChunk, c.handlerCollectGuildMembers)
+	c.on(EvtGuildCreate, c.handlerAddToConnectedGuilds)
+	c.on(EvtGuildDelete, c.handlerRemoveFromConnectedGuilds)
 
 	// start demultiplexer which also trigger dispatching
 	var cache *Cache
@@ -404,11 +651,13 @@ func (c *Client) Connect(ctx context.Context) (err error) {
 	c.Lock()
 	defer c.Unlock()
 
-	var me *User
-	if me, err = c.GetCurrentUser(ctx); err != nil {
-		return err
+	if c.config.ShardConfig.Replay == nil {
+		var me *User
+		if me, err = c.GetCurrentUser(ctx); err != nil {
+			return err
+		}
+		c.myID = me.ID
 	}
-	c.myID = me.ID
 
 	if err = gateway.ConfigureShardConfig(ctx, c, &c.config.ShardConfig); err != nil {
 		return err
@@ -419,7 +668,7 @@ func (c *Client) Connect(ctx context.Context) (err error) {
 		Logger:       c.config.Logger,
 		ShutdownChan: c.config.shutdownChan,
 		IgnoreEvents: c.config.IgnoreEvents,
-		Intents:      c.config.Intents,
+		Intents:      c.intents(),
 		EventChan:    c.eventChan,
 		DisgordInfo:  LibraryInfo(),
 		ProjectName:  c.config.ProjectName,
@@ -564,12 +813,110 @@ func (c *Client) handlerLoadMembers(_ Session, evt *Ready) {
 	})
 }
 
+// guildMembersRequest receives the chunks of a RequestGuildMembers call
+type guildMembersRequest struct {
+	chunks chan *GuildMembersChunk
+	done   chan struct{}
+}
+
+// handlerCollectGuildMembers passes chunks on to the RequestGuildMembers call with the same nonce
+func (c *Client) handlerCollectGuildMembers(_ Session, evt *GuildMembersChunk) {
+	if evt.Nonce == "" {
+		return
+	}
+
+	c.memberRequestsMu.Lock()
+	req, ok := c.memberRequests[evt.Nonce]
+	c.memberRequestsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case req.chunks <- evt:
+	case <-req.done:
+	}
+}
+
 //////////////////////////////////////////////////////
 //
 // Socket utilities
 //
 //////////////////////////////////////////////////////
 
+// RequestGuildMembers requests guild members over the gateway, and waits until every
+// GuildMembersChunk of the request has been received. An error is returned if the context
+// closes before then.
+//
+// Use params.UserIDs to fetch specific members, or params.Query to fetch the members whose
+// username starts with the query. Every member is requested when neither is set, which requires
+// the GUILD_MEMBERS intent. The two can not be combined.
+//
+//  members, err := client.RequestGuildMembers(ctx, guildID, &disgord.RequestGuildMembersParams{
+//      UserIDs: []disgord.Snowflake{userID},
+//      Presences: true,
+//  })
+func (c *Client) RequestGuildMembers(ctx context.Context, guildID Snowflake, params *RequestGuildMembersParams) (*GuildMembers, error) {
+	if params == nil {
+		params = &RequestGuildMembersParams{}
+	}
+	if params.Query != "" && len(params.UserIDs) > 0 {
+		return nil, errors.New("query and user IDs can not be combined")
+	}
+
+	req := &guildMembersRequest{
+		chunks: make(chan *GuildMembersChunk),
+		done:   make(chan struct{}),
+	}
+	c.memberRequestsMu.Lock()
+	if c.memberRequests == nil {
+		c.memberRequests = map[string]*guildMembersRequest{}
+	}
+	c.memberRequestNr++
+	nonce := fmt.Sprint("disgord-", c.memberRequestNr)
+	c.memberRequests[nonce] = req
+	c.memberRequestsMu.Unlock()
+	defer func() {
+		c.memberRequestsMu.Lock()
+		delete(c.memberRequests, nonce)
+		c.memberRequestsMu.Unlock()
+		close(req.done)
+	}()
+
+	unhandled, err := c.Emit(RequestGuildMembers, &RequestGuildMembersPayload{
+		GuildIDs:  []Snowflake{guildID},
+		Query:     params.Query,
+		Limit:     params.Limit,
+		UserIDs:   params.UserIDs,
+		Presences: params.Presences,
+		Nonce:     nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(unhandled) > 0 {
+		return nil, errors.New("the guild is not handled by any of the local shards")
+	}
+
+	members := &GuildMembers{}
+	var received uint
+	for {
+		select {
+		case chunk := <-req.chunks:
+			// handlers run concurrently, so the chunks might arrive out of order
+			members.Members = append(members.Members, chunk.Members...)
+			members.NotFound = append(members.NotFound, chunk.NotFound...)
+			members.Presences = append(members.Presences, chunk.Presences...)
+			received++
+			if received >= chunk.ChunkCount {
+				return members, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
 // Ready triggers a given callback when all shards has gotten their first Ready event
 // Warning: Do not call Client.Connect before this.
 func (c *Client) Ready(cb func()) {
@@ -647,17 +994,82 @@ func (c *Client) GuildsReady(cb func()) {
 // If the HandlerCtrl.OnInsert returns an error, the related handlers are still added to the dispatcher.
 // But the error is logged to the injected logger instance (log.Error).
 //
+// When the event is not covered by Config.Intents the handlers can never be triggered. This is logged
+// as an error, or causes a panic when Config.StrictIntents is set. Use AddHandler to get the error instead.
+//
 // This ctrl feature was inspired by https://github.com/discordjs/discord.js
 func (c *Client) On(event string, inputs ...interface{}) {
-	if err := ValidateHandlerInputs(inputs...); err != nil {
+	if err := c.AddHandler(event, inputs...); err != nil {
 		panic(err)
 	}
+}
+
+// AddHandler registers handlers like On, but returns an error instead of panicking when the inputs are
+// invalid. When Config.StrictIntents is set, an error is also returned, and the handlers are not added,
+// if the event is not covered by Config.Intents.
+//  if err := Client.AddHandler(EvtPresenceUpdate, onPresence); err != nil {
+//    log.Fatal(err) // eg. IntentGuildPresences is missing
+//  }
+func (c *Client) AddHandler(event string, inputs ...interface{}) error {
+	if err := ValidateHandlerInputs(inputs...); err != nil {
+		return err
+	}
+	if err := c.addHandlerIntents(event); err != nil {
+		if c.config.StrictIntents {
+			return err
+		}
+		c.log.Error(err)
+	}
+
+	return c.dispatcher.register(event, inputs...)
+}
 
+// on registers handlers used by Disgord itself, which are not validated against the intents
+func (c *Client) on(event string, inputs ...interface{}) {
 	if err := c.dispatcher.register(event, inputs...); err != nil {
 		panic(err)
 	}
 }
 
+// addHandlerIntents records the intents required by the event, and returns an error if the
+// configured intents does not include any of them. Nothing is recorded for errors in strict mode,
+// as the handlers are not added.
+func (c *Client) addHandlerIntents(event string) (err error) {
+	required, ok := intentsByEvent[event]
+	if !ok {
+		return nil
+	}
+
+	// no intents means every event is sent
+	if c.config.Intents != 0 && !c.config.DeriveIntents && c.config.Intents&required == 0 {
+		err = errors.New("handlers for " + event + " are never triggered, as none of the required intents are configured")
+		if c.config.StrictIntents {
+			return err
+		}
+	}
+
+	c.handlerIntentsMu.Lock()
+	c.handlerIntents |= required
+	c.handlerIntentsMu.Unlock()
+	return err
+}
+
+// RequiredIntents returns every intent that can trigger the handlers registered so far. This can be used as
+// Config.Intents, see also Config.DeriveIntents.
+func (c *Client) RequiredIntents() gateway.Intent {
+	c.handlerIntentsMu.Lock()
+	defer c.handlerIntentsMu.Unlock()
+	return c.handlerIntents
+}
+
+// intents returns the intents to identify with
+func (c *Client) intents() gateway.Intent {
+	if !c.config.DeriveIntents {
+		return c.config.Intents
+	}
+	return c.config.Intents | c.RequiredIntents() | IntentGuilds | IntentGuildVoiceStates
+}
+
 // Emit sends a socket command directly to Discord.
 func (c *Client) Emit(name gatewayCmdName, payload gatewayCmdPayload) (unchandledGuildIDs []Snowflake, err error) {
 	c.RLock()
@@ -846,6 +1258,7 @@ func (c *Client) newRESTRequest(conf *httd.Request, flags []Flag) *rest {
 	}
 	r.init()
 	r.flags = mergeFlags(flags)
+	conf.RetryNonIdempotent = r.flags&RetryNonIdempotent > 0
 
 	return r
 }
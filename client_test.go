@@ -3,6 +3,7 @@
 package disgord
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/andersfylling/disgord/internal/logger"
 	"io/ioutil"
@@ -425,3 +426,185 @@ func TestInternalStateHandlers(t *testing.T) {
 		t.Errorf("Removing a connected guild should affect the internal state. Got %d, wants %d", len(c.GetConnectedGuilds()), 0)
 	}
 }
+
+type emitShardManagerMock struct {
+	gateway.ShardManager
+	emit func(cmd string, payload gateway.CmdPayload) ([]Snowflake, error)
+}
+
+func (s *emitShardManagerMock) Emit(cmd string, payload gateway.CmdPayload) ([]Snowflake, error) {
+	return s.emit(cmd, payload)
+}
+
+func TestClient_RequestGuildMembers(t *testing.T) {
+	c, err := NewClient(Config{
+		BotToken: "testing",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guildID := Snowflake(486833611564253184)
+	c.shardManager = &emitShardManagerMock{
+		emit: func(cmd string, payload gateway.CmdPayload) ([]Snowflake, error) {
+			p := payload.(*gateway.RequestGuildMembersPayload)
+			if p.Nonce == "" || !p.Presences || len(p.UserIDs) != 3 {
+				t.Errorf("incorrect payload. Got %+v", p)
+			}
+
+			// chunks of other requests must be ignored
+			c.handlerCollectGuildMembers(c, &GuildMembersChunk{Nonce: "other", ChunkCount: 1})
+			go c.handlerCollectGuildMembers(c, &GuildMembersChunk{
+				GuildID:    guildID,
+				Members:    []*Member{{UserID: 2}},
+				ChunkIndex: 1,
+				ChunkCount: 2,
+				NotFound:   []Snowflake{3},
+				Nonce:      p.Nonce,
+			})
+			go c.handlerCollectGuildMembers(c, &GuildMembersChunk{
+				GuildID:    guildID,
+				Members:    []*Member{{UserID: 1}},
+				ChunkIndex: 0,
+				ChunkCount: 2,
+				Presences:  []*PresenceUpdate{{Status: StatusOnline}},
+				Nonce:      p.Nonce,
+			})
+			return nil, nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	members, err := c.RequestGuildMembers(ctx, guildID, &RequestGuildMembersParams{
+		UserIDs:   []Snowflake{1, 2, 3},
+		Presences: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members.Members) != 2 || len(members.NotFound) != 1 || len(members.Presences) != 1 {
+		t.Errorf("not every chunk was collected. Got %+v", members)
+	}
+	if len(c.memberRequests) != 0 {
+		t.Error("request was not cleaned up")
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		c.shardManager = &emitShardManagerMock{
+			emit: func(cmd string, payload gateway.CmdPayload) ([]Snowflake, error) {
+				return nil, nil
+			},
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := c.RequestGuildMembers(ctx, guildID, nil); err != context.DeadlineExceeded {
+			t.Errorf("expected the request to time out. Got %v", err)
+		}
+	})
+
+	t.Run("query and user ids", func(t *testing.T) {
+		_, err := c.RequestGuildMembers(context.Background(), guildID, &RequestGuildMembersParams{
+			Query:   "a",
+			UserIDs: []Snowflake{1},
+		})
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+// errorCounter counts the logged errors
+type errorCounter struct {
+	logger.Empty
+	errors int
+}
+
+func (l *errorCounter) Error(v ...interface{}) {
+	l.errors++
+}
+
+func TestClient_On_Intents(t *testing.T) {
+	t.Run("missing intent", func(t *testing.T) {
+		log := &errorCounter{}
+		c := New(Config{
+			BotToken:     "testing",
+			DisableCache: true,
+			Logger:       log,
+			Intents:      IntentGuilds | IntentGuildMessages,
+		})
+
+		c.On(EvtMessageCreate, func(s Session, e *MessageCreate) {})
+		c.On(EvtReady, func(s Session, e *Ready) {})
+		if log.errors != 0 {
+			t.Errorf("expected no errors. Got %d", log.errors)
+		}
+
+		c.On(EvtPresenceUpdate, func(s Session, e *PresenceUpdate) {})
+		if log.errors != 1 {
+			t.Errorf("expected an error for a handler that can never be triggered. Got %d", log.errors)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		c := New(Config{
+			BotToken:      "testing",
+			DisableCache:  true,
+			Intents:       IntentGuilds,
+			StrictIntents: true,
+		})
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("expected a panic in strict mode")
+			}
+		}()
+		c.On(EvtTypingStart, func(s Session, e *TypingStart) {})
+	})
+
+	t.Run("strict error", func(t *testing.T) {
+		c := New(Config{
+			BotToken:      "testing",
+			DisableCache:  true,
+			Intents:       IntentGuilds,
+			StrictIntents: true,
+		})
+		if err := c.AddHandler(EvtTypingStart, func(s Session, e *TypingStart) {}); err == nil {
+			t.Error("expected an error in strict mode")
+		}
+		if err := c.AddHandler(EvtGuildCreate, func(s Session, e *GuildCreate) {}); err != nil {
+			t.Errorf("expected no error for a handler that can be triggered. Got %v", err)
+		}
+		if intents := c.RequiredIntents(); intents != IntentGuilds {
+			t.Errorf("the intents of a rejected handler were recorded. Got %d", intents)
+		}
+	})
+
+	t.Run("derive", func(t *testing.T) {
+		log := &errorCounter{}
+		c := New(Config{
+			BotToken:      "testing",
+			DisableCache:  true,
+			Logger:        log,
+			Intents:       IntentGuildBans,
+			DeriveIntents: true,
+		})
+		c.On(EvtMessageCreate, func(s Session, e *MessageCreate) {})
+		c.On(EvtPresenceUpdate, func(s Session, e *PresenceUpdate) {})
+		c.setupConnectEnv()
+
+		if log.errors != 0 {
+			t.Errorf("expected no errors when the intents are derived. Got %d", log.errors)
+		}
+		wants := IntentDirectMessages | IntentGuildMessages | IntentGuildPresences
+		if intents := c.RequiredIntents(); intents != wants {
+			t.Errorf("incorrect required intents. Got %d, wants %d", intents, wants)
+		}
+		// voice states are always needed by VoiceConnect
+		derived := wants | IntentGuildBans | IntentGuilds | IntentGuildVoiceStates
+		if intents := c.intents(); intents != derived {
+			t.Errorf("incorrect derived intents. Got %d, wants %d", intents, derived)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/andersfylling/disgord/internal/constant"
 
 	"github.com/andersfylling/disgord"
+	"github.com/andersfylling/disgord/disgordtest"
 )
 
 type keys struct {
@@ -44,8 +46,20 @@ func setupKeys() *keys {
 }
 
 func main() {
+	var httpClient *http.Client
+	if path := os.Getenv(constant.DisgordTestCassette); path != "" {
+		recorder := disgordtest.NewRecorder(path, nil)
+		defer func() {
+			if err := recorder.Save(); err != nil {
+				fmt.Println("unable to save cassette:", err)
+			}
+		}()
+		httpClient = &http.Client{Transport: recorder}
+	}
+
 	c := disgord.New(disgord.Config{
-		BotToken: os.Getenv("DISGORD_TOKEN"),
+		BotToken:   os.Getenv("DISGORD_TOKEN"),
+		HTTPClient: httpClient,
 	})
 	keys := setupKeys()
 
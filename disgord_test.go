@@ -138,6 +138,10 @@ func (g *mockerWSReceiveOnly) WriteJSON(v interface{}) (err error) {
 	return
 }
 
+func (g *mockerWSReceiveOnly) WriteBinary(data []byte) (err error) {
+	return
+}
+
 func (g *mockerWSReceiveOnly) Close() (err error) {
 	return
 }
@@ -0,0 +1,387 @@
+package disgordtest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redactedToken replaces the Authorization header in cassettes
+const redactedToken = "Bot REDACTED"
+
+// redactedWebhookToken replaces webhook tokens in the URLs and the "token" fields of JSON bodies in cassettes
+const redactedWebhookToken = "REDACTED"
+
+// Cassette holds recorded REST calls, in the order they were made
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and the response Discord gave
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+var regexpAPIVersion = regexp.MustCompile(`^/api/v[0-9]+`)
+var regexpWebhookToken = regexp.MustCompile(`(/webhooks/[0-9]+/)[^/?]+`)
+
+// redactURL replaces the token of webhook URLs, eg. /webhooks/{webhook.id}/{webhook.token}/slack
+func redactURL(rawURL string) string {
+	return regexpWebhookToken.ReplaceAllString(rawURL, "${1}"+redactedWebhookToken)
+}
+
+// redactTokens replaces every "token" field of a JSON body, such as the token of a webhook
+func redactTokens(contentType string, body []byte) []byte {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/json" || !bytes.Contains(body, []byte(`"token"`)) {
+		return body
+	}
+
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // keeps large integers intact
+	if err := decoder.Decode(&v); err != nil {
+		return body
+	}
+	redactTokenFields(v)
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+func redactTokenFields(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if _, isString := value.(string); isString && key == "token" {
+				v[key] = redactedWebhookToken
+				continue
+			}
+			redactTokenFields(value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			redactTokenFields(value)
+		}
+	}
+}
+
+// normalizedEndpoint removes the host, the API version and any webhook token of the request URL, and sorts
+// the query parameters
+func normalizedEndpoint(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	endpoint := redactURL(regexpAPIVersion.ReplaceAllString(u.Path, ""))
+	if query := u.Query(); len(query) > 0 {
+		endpoint += "?" + query.Encode() // Encode sorts by key
+	}
+	return endpoint
+}
+
+// normalizedBody removes the formatting of JSON bodies and the random boundary of multipart bodies, such that
+// equal bodies can be compared
+func normalizedBody(contentType, body string) string {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json":
+		var v interface{}
+		if err := json.Unmarshal([]byte(body), &v); err != nil {
+			return body
+		}
+		normalized, _ := json.Marshal(v) // map keys are sorted
+		return string(normalized)
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+		return strings.ReplaceAll(body, params["boundary"], "BOUNDARY")
+	default:
+		return body
+	}
+}
+
+func (r *CassetteRequest) key() string {
+	return r.Method + " " + normalizedEndpoint(r.URL) + "\n" + normalizedBody(r.Header.Get("Content-Type"), r.Body)
+}
+
+//////////////////////////////////////////////////////
+//
+// RECORDER
+//
+//////////////////////////////////////////////////////
+
+// NewRecorder creates a http.RoundTripper that records every REST call sent through the transport, which
+// defaults to http.DefaultTransport. Call Save to write the cassette to the path, eg. "testdata/rest.json".
+//
+// The bot token, webhook tokens in URLs and "token" fields of JSON response bodies are redacted, such that
+// cassettes can be committed.
+//  recorder := disgordtest.NewRecorder("testdata/rest.json", nil)
+//  defer recorder.Save()
+//  client := disgord.New(disgord.Config{
+//    BotToken:   os.Getenv("DISGORD_TOKEN"),
+//    HTTPClient: &http.Client{Transport: recorder},
+//  })
+func NewRecorder(path string, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{
+		path:      path,
+		transport: transport,
+	}
+}
+
+// Recorder records REST calls to a cassette, see NewRecorder
+type Recorder struct {
+	path      string
+	transport http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+var _ http.RoundTripper = (*Recorder)(nil)
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// the cassette stores the decompressed body, such that it can be read and edited
+	header := resp.Header.Clone()
+	if header.Get("Content-Encoding") == "gzip" {
+		if body, err = gunzip(body); err != nil {
+			return nil, err
+		}
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+	}
+
+	reqHeader := req.Header.Clone()
+	if reqHeader.Get("Authorization") != "" {
+		reqHeader.Set("Authorization", redactedToken)
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Request: CassetteRequest{
+			Method: req.Method,
+			URL:    redactURL(req.URL.String()),
+			Header: reqHeader,
+			Body:   string(reqBody),
+		},
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       string(redactTokens(header.Get("Content-Type"), body)),
+		},
+	})
+	r.mu.Unlock()
+
+	resp.Header = header
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Save writes the recorded REST calls to the cassette file, and creates the directory if needed
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	data, err := json.MarshalIndent(&r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, data, 0644)
+}
+
+//////////////////////////////////////////////////////
+//
+// REPLAYER
+//
+//////////////////////////////////////////////////////
+
+// NewReplayer loads a cassette written by a Recorder. The replayer is a http.RoundTripper that responds to
+// requests with the recorded responses, without any network access.
+//  replayer, err := disgordtest.NewReplayer("testdata/rest.json")
+//  client := disgord.New(disgord.Config{
+//    BotToken:   "any",
+//    HTTPClient: &http.Client{Transport: replayer},
+//  })
+func NewReplayer(path string) (*Replayer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cassette := &Cassette{}
+	if err = json.Unmarshal(data, cassette); err != nil {
+		return nil, err
+	}
+	return NewCassetteReplayer(cassette), nil
+}
+
+// NewCassetteReplayer creates a replayer for a cassette in memory, see NewReplayer
+func NewCassetteReplayer(cassette *Cassette) *Replayer {
+	r := &Replayer{
+		interactions: map[string][]*Interaction{},
+		now:          time.Now,
+	}
+	for _, interaction := range cassette.Interactions {
+		key := interaction.Request.key()
+		r.interactions[key] = append(r.interactions[key], interaction)
+	}
+	return r
+}
+
+// Replayer replays the responses of a cassette. Requests are matched by the method, the normalized endpoint and
+// the body. Webhook tokens are not compared, as the Recorder redacts them. Equal requests are given the recorded
+// responses in the order they were recorded, such that a resource can be fetched before and after it is modified.
+//
+// The Date and X-RateLimit-Reset headers are moved to the time of the replay, such that the rate limit buckets
+// behave as they did when the cassette was recorded.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions map[string][]*Interaction // request key => unused interactions
+	now          func() time.Time
+}
+
+var _ http.RoundTripper = (*Replayer)(nil)
+
+// ErrNoInteraction is returned by the Replayer when no recorded response matches a request
+var ErrNoInteraction = errors.New("no recorded interaction matches the request")
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+	}
+
+	recorded := &CassetteRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header,
+		Body:   string(body),
+	}
+	key := recorded.key()
+
+	r.mu.Lock()
+	interactions := r.interactions[key]
+	if len(interactions) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, normalizedEndpoint(recorded.URL))
+	}
+	interaction := interactions[0]
+	r.interactions[key] = interactions[1:]
+	r.mu.Unlock()
+
+	header := r.shiftTime(interaction.Response.Header.Clone())
+	return &http.Response{
+		Status:        strconv.Itoa(interaction.Response.StatusCode) + " " + http.StatusText(interaction.Response.StatusCode),
+		StatusCode:    interaction.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(interaction.Response.Body)),
+		ContentLength: int64(len(interaction.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// shiftTime moves the Date and X-RateLimit-Reset headers by the time passed since the cassette was recorded
+func (r *Replayer) shiftTime(header http.Header) http.Header {
+	if header == nil {
+		return http.Header{}
+	}
+
+	recordedAt, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return header
+	}
+	now := r.now()
+	offset := now.Sub(recordedAt)
+	header.Set("Date", now.UTC().Format(http.TimeFormat))
+
+	if reset := header.Get("X-RateLimit-Reset"); reset != "" {
+		if epoch, err := strconv.ParseFloat(reset, 64); err == nil {
+			epoch += offset.Seconds()
+			header.Set("X-RateLimit-Reset", strconv.FormatFloat(epoch, 'f', 3, 64))
+		}
+	}
+	return header
+}
+
+// Unused returns the number of recorded interactions that has not been replayed
+func (r *Replayer) Unused() (n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, interactions := range r.interactions {
+		n += len(interactions)
+	}
+	return n
+}
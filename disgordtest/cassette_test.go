@@ -0,0 +1,203 @@
+// +build !integration
+
+package disgordtest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andersfylling/disgord"
+)
+
+const cassetteUserID = 140413331470024704
+
+// newTestClient creates a client that sends every REST request through the transport
+func newTestClient(t *testing.T, transport http.RoundTripper) *disgord.Client {
+	client, err := disgord.NewClient(disgord.Config{
+		BotToken:     "replay",
+		HTTPClient:   &http.Client{Transport: transport},
+		DisableCache: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body bytes.Buffer
+		gz := gzip.NewWriter(&body)
+		_, _ = gz.Write([]byte(`{"id":"140413331470024704","username":"test"}`))
+		_ = gz.Close()
+
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body.Bytes())
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "disgordtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "testdata", "rest.json")
+
+	recorder := NewRecorder(path, nil)
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v6/users/140413331470024704", nil)
+	req.Header.Set("Authorization", "Bot secret-token")
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := (&http.Client{Transport: recorder}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if err = recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-token") {
+		t.Error("the bot token was saved to the cassette")
+	}
+	if !strings.Contains(string(data), `\"username\":\"test\"`) {
+		t.Errorf("expected the response body to be stored uncompressed. Got %s", data)
+	}
+
+	// the recorded request is replayed for the Client, even though it was recorded from another host
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := newTestClient(t, replayer).GetUser(context.Background(), cassetteUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "test" {
+		t.Errorf("expected the recorded user. Got %+v", user)
+	}
+	if replayer.Unused() != 0 {
+		t.Errorf("expected every interaction to be replayed. %d are unused", replayer.Unused())
+	}
+}
+
+func TestRecorder_webhookToken(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	_, channelID := fake.AddGuild("test")
+
+	dir, err := ioutil.TempDir("", "disgordtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rest.json")
+
+	recorder := NewRecorder(path, fake.HTTPClient().Transport)
+	client := newTestClient(t, recorder)
+
+	ctx := context.Background()
+	webhook, err := client.CreateWebhook(ctx, channelID, &disgord.CreateWebhookParams{Name: "hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if webhook.Token == "" || webhook.Token == redactedWebhookToken {
+		t.Fatalf("expected the client to be given the webhook token. Got %q", webhook.Token)
+	}
+	params := &disgord.ExecuteWebhookParams{
+		WebhookID: webhook.ID,
+		Token:     webhook.Token,
+		Content:   "from a webhook",
+	}
+	if _, err = client.ExecuteWebhook(ctx, params, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), webhook.Token) {
+		t.Errorf("the webhook token was saved to the cassette. Got %s", data)
+	}
+
+	// the redacted request is still matched when replayed with the real token
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = newTestClient(t, replayer)
+	if _, err = client.CreateWebhook(ctx, channelID, &disgord.CreateWebhookParams{Name: "hook"}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := client.ExecuteWebhook(ctx, params, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content != "from a webhook" {
+		t.Errorf("expected the recorded message. Got %+v", msg)
+	}
+}
+
+func TestReplayer(t *testing.T) {
+	recordedAt := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	response := func(username, remaining string) CassetteResponse {
+		return CassetteResponse{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Content-Type":          {"application/json"},
+				"Date":                  {recordedAt.Format(http.TimeFormat)},
+				"X-Ratelimit-Bucket":    {"f56681194ebea036dd1297f1184bf7bd"},
+				"X-Ratelimit-Limit":     {"2"},
+				"X-Ratelimit-Remaining": {remaining},
+				"X-Ratelimit-Reset":     {"1577880000.300"}, // 300ms after the response
+			},
+			Body: `{"id":"140413331470024704","username":"` + username + `"}`,
+		}
+	}
+	request := CassetteRequest{Method: http.MethodGet, URL: "https://discord.com/api/v6/users/140413331470024704"}
+
+	replayer := NewCassetteReplayer(&Cassette{
+		Interactions: []*Interaction{
+			{Request: request, Response: response("first", "0")},
+			{Request: request, Response: response("second", "1")},
+		},
+	})
+	client := newTestClient(t, replayer)
+
+	start := time.Now()
+	for _, expected := range []string{"first", "second"} {
+		user, err := client.GetUser(context.Background(), cassetteUserID, disgord.IgnoreCache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Username != expected {
+			t.Errorf("expected the %s response. Got %s", expected, user.Username)
+		}
+	}
+	if time.Since(start) < 250*time.Millisecond {
+		t.Error("expected the second request to wait for the replayed rate limit to reset")
+	}
+
+	_, err := client.GetUser(context.Background(), cassetteUserID, disgord.IgnoreCache)
+	if !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("expected the cassette to be out of responses. Got %v", err)
+	}
+}
@@ -0,0 +1,648 @@
+// Package disgordtest holds in-process fakes of the Discord services, such that the Disgord client
+// can be tested end to end without a bot token or network access.
+package disgordtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+
+	"github.com/andersfylling/disgord/internal/constant"
+	"github.com/andersfylling/disgord/internal/gateway/opcode"
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+type Snowflake = util.Snowflake
+
+const defaultHeartbeatInterval = 41250 * time.Millisecond
+
+// intentGuildVoiceStates enables VOICE_STATE_UPDATE, see gateway.IntentGuildVoiceStates
+const intentGuildVoiceStates = 1 << 7
+
+// close codes sent by the gateway
+const (
+	CloseUnknownError         = 4000
+	CloseDecodeError          = 4002
+	CloseNotAuthenticated     = 4003
+	CloseAuthenticationFailed = 4004
+	CloseInvalidShard         = 4010
+	CloseShardingRequired     = 4011
+	CloseGoingAway            = 1001
+)
+
+// GatewayConfig decides how the fake gateway behaves. The zero value accepts any token and a single shard.
+type GatewayConfig struct {
+	// Token is the bot token the shards must identify with. Any token is accepted when empty,
+	// otherwise the connection is closed with 4004.
+	Token string
+
+	// ShardCount is the number of shards the gateway requires. Shards that identify with a lower
+	// shard count are closed with 4011. Defaults to 1.
+	ShardCount uint
+
+	// HeartbeatInterval is sent in HELLO. Defaults to 41.25 seconds.
+	HeartbeatInterval time.Duration
+
+	// Guilds are sent as unavailable guilds in READY, followed by a GUILD_CREATE for each of them,
+	// to the shard that owns the guild.
+	Guilds []Snowflake
+
+	// Script is dispatched, in order, to every new session after the guilds have been created.
+	Script []Dispatch
+
+	// UserID is the ID of the bot user, which is sent in READY and in voice states. Defaults to 1.
+	UserID Snowflake
+
+	// VoiceEndpoint is sent in VOICE_SERVER_UPDATE when a shard joins a voice channel.
+	// Defaults to an address that refuses connections.
+	VoiceEndpoint string
+}
+
+// Dispatch is a gateway event sent by the fake gateway
+type Dispatch struct {
+	Name string
+	Data interface{}
+}
+
+// NewGateway starts a fake Discord gateway. Point ShardConfig.URL at Gateway.URL to connect the
+// shards to it. Remember to Close it.
+//
+// The fake only speaks JSON without transport compression, and keeps every session resumable until
+// it is invalidated with InvalidateSession.
+func NewGateway(conf *GatewayConfig) *Gateway {
+	g := &Gateway{
+		shards:   map[uint]*gatewayConn{},
+		sessions: map[string]*session{},
+		changed:  make(chan struct{}),
+	}
+	if conf != nil {
+		g.conf = *conf
+	}
+	if g.conf.ShardCount == 0 {
+		g.conf.ShardCount = 1
+	}
+	if g.conf.HeartbeatInterval == 0 {
+		g.conf.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if g.conf.UserID.IsZero() {
+		g.conf.UserID = 1
+	}
+	if g.conf.VoiceEndpoint == "" {
+		g.conf.VoiceEndpoint = "127.0.0.1:1"
+	}
+
+	g.server = httptest.NewServer(g)
+	return g
+}
+
+// Gateway is a fake Discord gateway, see NewGateway
+type Gateway struct {
+	server *httptest.Server
+
+	mu         sync.Mutex
+	conf       GatewayConfig
+	shards     map[uint]*gatewayConn
+	sessions   map[string]*session
+	identifies int
+	resumes    int
+	sessionNr  int
+
+	// droppedAcks is the number of heartbeats left that are not acknowledged
+	droppedAcks int
+
+	// changed is closed and replaced every time a shard becomes ready
+	changed chan struct{}
+}
+
+var _ http.Handler = (*Gateway)(nil)
+
+type session struct {
+	id      string
+	shardID uint
+	seq     uint
+
+	// intents given in identify, where nil means every event is sent
+	intents *uint64
+
+	// events holds every dispatched payload, such that they can be replayed on resume
+	events [][]byte
+}
+
+type gatewayConn struct {
+	ws      *websocket.Conn
+	session *session
+}
+
+type gatewayPayload struct {
+	Op   opcode.OpCode `json:"op"`
+	Data interface{}   `json:"d"`
+	Seq  uint          `json:"s,omitempty"`
+	Name string        `json:"t,omitempty"`
+}
+
+type helloData struct {
+	HeartbeatInterval int64 `json:"heartbeat_interval"`
+}
+
+type readyData struct {
+	Version   int          `json:"v"`
+	User      *userData    `json:"user"`
+	SessionID string       `json:"session_id"`
+	Guilds    []*guildData `json:"guilds"`
+	Shard     [2]uint      `json:"shard"`
+}
+
+type userData struct {
+	ID            Snowflake `json:"id"`
+	Username      string    `json:"username"`
+	Discriminator string    `json:"discriminator"`
+	Bot           bool      `json:"bot"`
+}
+
+type guildData struct {
+	ID          Snowflake `json:"id"`
+	Name        string    `json:"name,omitempty"`
+	Unavailable bool      `json:"unavailable,omitempty"`
+}
+
+type voiceStateData struct {
+	GuildID   Snowflake       `json:"guild_id"`
+	ChannelID json.RawMessage `json:"channel_id"`
+	UserID    Snowflake       `json:"user_id"`
+	SessionID string          `json:"session_id"`
+	Deaf      bool            `json:"deaf"`
+	Mute      bool            `json:"mute"`
+	SelfDeaf  bool            `json:"self_deaf"`
+	SelfMute  bool            `json:"self_mute"`
+	Suppress  bool            `json:"suppress"`
+}
+
+type voiceServerData struct {
+	Token    string    `json:"token"`
+	GuildID  Snowflake `json:"guild_id"`
+	Endpoint string    `json:"endpoint"`
+}
+
+type gatewayBotData struct {
+	URL               string `json:"url"`
+	Shards            uint   `json:"shards"`
+	SessionStartLimit struct {
+		Total          uint `json:"total"`
+		Remaining      uint `json:"remaining"`
+		ResetAfter     uint `json:"reset_after"`
+		MaxConcurrency uint `json:"max_concurrency"`
+	} `json:"session_start_limit"`
+}
+
+type clientPayload struct {
+	Op   opcode.OpCode   `json:"op"`
+	Data json.RawMessage `json:"d"`
+}
+
+// URL returns the websocket endpoint of the gateway
+func (g *Gateway) URL() string {
+	return "ws" + strings.TrimPrefix(g.server.URL, "http")
+}
+
+// Close disconnects every shard and stops the gateway
+func (g *Gateway) Close() {
+	g.mu.Lock()
+	conns := g.shards
+	g.shards = map[uint]*gatewayConn{}
+	g.mu.Unlock()
+
+	for _, conn := range conns {
+		_ = conn.ws.Close(websocket.StatusGoingAway, "gateway is shutting down")
+	}
+	g.server.Close()
+}
+
+// ShardCount returns the number of shards the gateway requires
+func (g *Gateway) ShardCount() uint {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.conf.ShardCount
+}
+
+// SetShardCount changes the number of shards the gateway requires. Existing connections are not
+// affected, see CloseShard to ask a shard to scale with 4011.
+func (g *Gateway) SetShardCount(shardCount uint) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.conf.ShardCount = shardCount
+}
+
+// Identifies returns the number of sessions that have been created
+func (g *Gateway) Identifies() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.identifies
+}
+
+// DropHeartbeatAcks skips the ACK of the next n heartbeats received on any connection. The shard
+// should then consider the connection zombied, and resume on a new one.
+func (g *Gateway) DropHeartbeatAcks(n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.droppedAcks = n
+}
+
+func (g *Gateway) dropHeartbeatAck() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.droppedAcks == 0 {
+		return false
+	}
+	g.droppedAcks--
+	return true
+}
+
+// Resumes returns the number of sessions that have been resumed
+func (g *Gateway) Resumes() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resumes
+}
+
+// WaitForShard blocks until the shard has identified or resumed on its current connection.
+func (g *Gateway) WaitForShard(ctx context.Context, shardID uint) error {
+	for {
+		g.mu.Lock()
+		_, ready := g.shards[shardID]
+		changed := g.changed
+		g.mu.Unlock()
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Dispatch sends an event to a connected shard. The event is replayed if the shard later resumes
+// from an older sequence number.
+func (g *Gateway) Dispatch(shardID uint, name string, data interface{}) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	conn, ok := g.shards[shardID]
+	if !ok {
+		return errors.New("shard " + strconv.Itoa(int(shardID)) + " is not connected")
+	}
+	return g.dispatch(conn, name, data)
+}
+
+// Reconnect asks the shard to reconnect and resume, by sending opcode 7
+func (g *Gateway) Reconnect(shardID uint) error {
+	return g.send(shardID, &gatewayPayload{Op: opcode.EventReconnect})
+}
+
+// InvalidateSession drops the session of the shard, and sends opcode 9 such that the shard must identify again
+func (g *Gateway) InvalidateSession(shardID uint) error {
+	g.mu.Lock()
+	conn, ok := g.shards[shardID]
+	if ok {
+		delete(g.sessions, conn.session.id)
+		delete(g.shards, shardID)
+	}
+	g.mu.Unlock()
+	if !ok {
+		return errors.New("shard " + strconv.Itoa(int(shardID)) + " is not connected")
+	}
+
+	return conn.write(&gatewayPayload{Op: opcode.EventInvalidSession, Data: false})
+}
+
+// CloseShard closes the connection of a shard with the given close code, eg. 4004, 4011 or 1001.
+// The session can still be resumed.
+func (g *Gateway) CloseShard(shardID uint, code int, reason string) error {
+	g.mu.Lock()
+	conn, ok := g.shards[shardID]
+	if ok {
+		delete(g.shards, shardID)
+	}
+	g.mu.Unlock()
+	if !ok {
+		return errors.New("shard " + strconv.Itoa(int(shardID)) + " is not connected")
+	}
+
+	// the close frame is sent before the handshake, which fails whenever the shard is mid-send
+	// as the connection is still being read by serveConn. The connection is closed either way.
+	err := conn.ws.Close(websocket.StatusCode(code), reason)
+	if err != nil && strings.Contains(err.Error(), "failed to wait for peer close frame") {
+		return nil
+	}
+	return err
+}
+
+func (g *Gateway) send(shardID uint, payload *gatewayPayload) error {
+	g.mu.Lock()
+	conn, ok := g.shards[shardID]
+	g.mu.Unlock()
+	if !ok {
+		return errors.New("shard " + strconv.Itoa(int(shardID)) + " is not connected")
+	}
+	return conn.write(payload)
+}
+
+// dispatch expects the lock to be held, such that the sequence numbers arrive in order
+func (g *Gateway) dispatch(conn *gatewayConn, name string, data interface{}) error {
+	conn.session.seq++
+	payload, err := util.Marshal(&gatewayPayload{
+		Op:   opcode.EventDiscordEvent,
+		Data: data,
+		Seq:  conn.session.seq,
+		Name: name,
+	})
+	if err != nil {
+		return err
+	}
+	conn.session.events = append(conn.session.events, payload)
+	return conn.ws.Write(context.Background(), websocket.MessageText, payload)
+}
+
+func (c *gatewayConn) write(payload *gatewayPayload) error {
+	data, err := util.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.ws.Write(context.Background(), websocket.MessageText, data)
+}
+
+// ServeHTTP upgrades the request to a gateway connection. It also replies to /gateway/bot, such that
+// the fake gateway can be discovered.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/gateway/bot") || strings.HasSuffix(r.URL.Path, "/gateway") {
+		g.serveGatewayBot(w)
+		return
+	}
+
+	query := r.URL.Query()
+	if encoding := query.Get("encoding"); encoding != "" && encoding != constant.JSONEncoding {
+		http.Error(w, "disgordtest only supports json encoding", http.StatusBadRequest)
+		return
+	}
+	if query.Get("compress") != "" {
+		http.Error(w, "disgordtest does not support transport compression", http.StatusBadRequest)
+		return
+	}
+
+	ws, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	ws.SetReadLimit(32768 * 10000)
+	g.serveConn(r.Context(), &gatewayConn{ws: ws})
+}
+
+func (g *Gateway) serveGatewayBot(w http.ResponseWriter) {
+	g.mu.Lock()
+	bot := &gatewayBotData{URL: g.URL(), Shards: g.conf.ShardCount}
+	g.mu.Unlock()
+	bot.SessionStartLimit.Total = 1000
+	bot.SessionStartLimit.Remaining = 1000
+	bot.SessionStartLimit.MaxConcurrency = 1
+
+	data, err := util.Marshal(bot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func (g *Gateway) serveConn(ctx context.Context, conn *gatewayConn) {
+	defer func() {
+		g.mu.Lock()
+		if conn.session != nil && g.shards[conn.session.shardID] == conn {
+			delete(g.shards, conn.session.shardID)
+		}
+		g.mu.Unlock()
+	}()
+
+	g.mu.Lock()
+	interval := g.conf.HeartbeatInterval
+	g.mu.Unlock()
+	err := conn.write(&gatewayPayload{
+		Op:   opcode.EventHello,
+		Data: &helloData{HeartbeatInterval: interval.Milliseconds()},
+	})
+	if err != nil {
+		return
+	}
+
+	for {
+		_, data, err := conn.ws.Read(ctx)
+		if err != nil {
+			return
+		}
+
+		payload := &clientPayload{}
+		if err = util.Unmarshal(data, payload); err != nil {
+			_ = conn.ws.Close(CloseDecodeError, "Decode error.")
+			return
+		}
+
+		switch payload.Op {
+		case opcode.EventHeartbeat:
+			if !g.dropHeartbeatAck() {
+				err = conn.write(&gatewayPayload{Op: opcode.EventHeartbeatAck})
+			}
+		case opcode.EventIdentify:
+			err = g.identify(conn, payload.Data)
+		case opcode.EventResume:
+			err = g.resume(conn, payload.Data)
+		case opcode.EventVoiceStateUpdate:
+			err = g.voiceStateUpdate(conn, payload.Data)
+		default:
+			if conn.session == nil {
+				_ = conn.ws.Close(CloseNotAuthenticated, "Not authenticated.")
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (g *Gateway) identify(conn *gatewayConn, data []byte) error {
+	identify := struct {
+		Token   string   `json:"token"`
+		Shard   *[2]uint `json:"shard"`
+		Intents *uint64  `json:"intents"`
+	}{}
+	if err := util.Unmarshal(data, &identify); err != nil {
+		return conn.ws.Close(CloseDecodeError, "Decode error.")
+	}
+	shard := [2]uint{0, 1}
+	if identify.Shard != nil {
+		shard = *identify.Shard
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.conf.Token != "" && g.conf.Token != identify.Token {
+		return conn.ws.Close(CloseAuthenticationFailed, "Authentication failed.")
+	}
+	if shard[0] >= shard[1] {
+		return conn.ws.Close(CloseInvalidShard, "Invalid shard.")
+	}
+	if shard[1] < g.conf.ShardCount {
+		return conn.ws.Close(CloseShardingRequired, "Sharding required.")
+	}
+
+	g.identifies++
+	g.sessionNr++
+	conn.session = &session{
+		id:      "disgordtest-" + strconv.Itoa(g.sessionNr),
+		shardID: shard[0],
+		intents: identify.Intents,
+	}
+	g.sessions[conn.session.id] = conn.session
+
+	var guilds []Snowflake
+	for _, id := range g.conf.Guilds {
+		if uint(id>>22)%shard[1] == shard[0] {
+			guilds = append(guilds, id)
+		}
+	}
+	ready := &readyData{
+		Version: constant.DiscordVersion,
+		User: &userData{
+			ID:            g.conf.UserID,
+			Username:      "disgordtest",
+			Discriminator: "0000",
+			Bot:           true,
+		},
+		SessionID: conn.session.id,
+		Guilds:    make([]*guildData, 0, len(guilds)),
+		Shard:     shard,
+	}
+	for _, id := range guilds {
+		ready.Guilds = append(ready.Guilds, &guildData{ID: id, Unavailable: true})
+	}
+	if err := g.dispatch(conn, "READY", ready); err != nil {
+		return err
+	}
+	for _, id := range guilds {
+		guild := &guildData{ID: id, Name: "disgordtest " + id.String()}
+		if err := g.dispatch(conn, "GUILD_CREATE", guild); err != nil {
+			return err
+		}
+	}
+	for _, evt := range g.conf.Script {
+		if err := g.dispatch(conn, evt.Name, evt.Data); err != nil {
+			return err
+		}
+	}
+
+	g.ready(conn)
+	return nil
+}
+
+func (g *Gateway) resume(conn *gatewayConn, data []byte) error {
+	resume := struct {
+		Token     string `json:"token"`
+		SessionID string `json:"session_id"`
+		Seq       uint   `json:"seq"`
+	}{}
+	if err := util.Unmarshal(data, &resume); err != nil {
+		return conn.ws.Close(CloseDecodeError, "Decode error.")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.conf.Token != "" && g.conf.Token != resume.Token {
+		return conn.ws.Close(CloseAuthenticationFailed, "Authentication failed.")
+	}
+	s, ok := g.sessions[resume.SessionID]
+	if !ok || resume.Seq > s.seq {
+		return conn.write(&gatewayPayload{Op: opcode.EventInvalidSession, Data: false})
+	}
+	if old, ok := g.shards[s.shardID]; ok && old.session == s {
+		// the session moved to a new connection
+		delete(g.shards, s.shardID)
+		go old.ws.Close(CloseGoingAway, "Session resumed on a new connection.")
+	}
+
+	g.resumes++
+	conn.session = s
+	for _, payload := range s.events[resume.Seq:] {
+		if err := conn.ws.Write(context.Background(), websocket.MessageText, payload); err != nil {
+			return err
+		}
+	}
+	if err := g.dispatch(conn, "RESUMED", struct{}{}); err != nil {
+		return err
+	}
+
+	g.ready(conn)
+	return nil
+}
+
+// voiceStateUpdate replies to a shard that joins or leaves a voice channel. Like Discord, VOICE_STATE_UPDATE
+// is only sent to sessions that identified with the GUILD_VOICE_STATES intent.
+func (g *Gateway) voiceStateUpdate(conn *gatewayConn, data []byte) error {
+	update := struct {
+		GuildID   Snowflake       `json:"guild_id"`
+		ChannelID json.RawMessage `json:"channel_id"`
+		SelfMute  bool            `json:"self_mute"`
+		SelfDeaf  bool            `json:"self_deaf"`
+	}{}
+	if err := util.Unmarshal(data, &update); err != nil {
+		return conn.ws.Close(CloseDecodeError, "Decode error.")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if conn.session == nil {
+		return conn.ws.Close(CloseNotAuthenticated, "Not authenticated.")
+	}
+	if intents := conn.session.intents; intents == nil || *intents&intentGuildVoiceStates > 0 {
+		state := &voiceStateData{
+			GuildID:   update.GuildID,
+			ChannelID: update.ChannelID,
+			UserID:    g.conf.UserID,
+			SessionID: conn.session.id,
+			SelfMute:  update.SelfMute,
+			SelfDeaf:  update.SelfDeaf,
+		}
+		if err := g.dispatch(conn, "VOICE_STATE_UPDATE", state); err != nil {
+			return err
+		}
+	}
+	if string(update.ChannelID) == "null" {
+		return nil
+	}
+
+	server := &voiceServerData{
+		Token:    "disgordtest",
+		GuildID:  update.GuildID,
+		Endpoint: g.conf.VoiceEndpoint,
+	}
+	return g.dispatch(conn, "VOICE_SERVER_UPDATE", server)
+}
+
+// ready expects the lock to be held
+func (g *Gateway) ready(conn *gatewayConn) {
+	g.shards[conn.session.shardID] = conn
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
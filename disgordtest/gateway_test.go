@@ -0,0 +1,150 @@
+// +build !integration
+
+package disgordtest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+
+	"github.com/andersfylling/disgord"
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+func TestGateway_GatewayBot(t *testing.T) {
+	gw := NewGateway(&GatewayConfig{ShardCount: 3})
+	defer gw.Close()
+
+	resp, err := http.Get("http" + strings.TrimPrefix(gw.URL(), "ws") + "/gateway/bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bot := &gatewayBotData{}
+	if err = util.Unmarshal(body, bot); err != nil {
+		t.Fatal(err)
+	}
+	if bot.URL != gw.URL() || bot.Shards != 3 {
+		t.Errorf("incorrect gateway bot info. Got %+v", bot)
+	}
+}
+
+// identify connects to the gateway and sends an identify packet
+func identify(ctx context.Context, t *testing.T, gw *Gateway, payload string) *websocket.Conn {
+	ws, _, err := websocket.Dial(ctx, gw.URL()+"?v=6&encoding=json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, hello, err := ws.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(hello), `"heartbeat_interval":41250`) {
+		t.Errorf("unexpected hello. Got %s", hello)
+	}
+
+	if err = ws.Write(ctx, websocket.MessageText, []byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func expectClose(ctx context.Context, t *testing.T, ws *websocket.Conn, code int) {
+	_, _, err := ws.Read(ctx)
+	var closeErr websocket.CloseError
+	if !errors.As(err, &closeErr) || int(closeErr.Code) != code {
+		t.Errorf("expected close code %d. Got %v", code, err)
+	}
+}
+
+func TestGateway_AuthenticationFailed(t *testing.T) {
+	gw := NewGateway(&GatewayConfig{Token: "test"})
+	defer gw.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ws := identify(ctx, t, gw, `{"op":2,"d":{"token":"wrong","shard":[0,1]}}`)
+	defer ws.Close(websocket.StatusNormalClosure, "")
+
+	expectClose(ctx, t, ws, CloseAuthenticationFailed)
+	if gw.Identifies() != 0 {
+		t.Error("gateway accepted an incorrect token")
+	}
+}
+
+func TestGateway_ShardingRequired(t *testing.T) {
+	gw := NewGateway(&GatewayConfig{ShardCount: 2})
+	defer gw.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ws := identify(ctx, t, gw, `{"op":2,"d":{"token":"test","shard":[0,1]}}`)
+	defer ws.Close(websocket.StatusNormalClosure, "")
+
+	expectClose(ctx, t, ws, CloseShardingRequired)
+	if gw.Identifies() != 0 {
+		t.Error("gateway accepted a session with too few shards")
+	}
+}
+
+// gatewayBotTransport sends /gateway/bot to the fake gateway, and every other REST request to the fake REST API
+type gatewayBotTransport struct {
+	gateway *Gateway
+	rest    http.RoundTripper
+}
+
+func (t *gatewayBotTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/gateway/bot") {
+		return t.rest.RoundTrip(req)
+	}
+	return (&restTransport{target: "http" + strings.TrimPrefix(t.gateway.URL(), "ws"), transport: http.DefaultTransport}).RoundTrip(req)
+}
+
+func TestGateway_VoiceConnect_DeriveIntents(t *testing.T) {
+	rest := NewREST(nil)
+	defer rest.Close()
+	guildID, _ := rest.AddGuild("test")
+	gw := NewGateway(&GatewayConfig{UserID: rest.BotID(), Guilds: []Snowflake{guildID}})
+	defer gw.Close()
+
+	client, err := disgord.NewClient(disgord.Config{
+		BotToken:      "test",
+		HTTPClient:    &http.Client{Transport: &gatewayBotTransport{gateway: gw, rest: rest.HTTPClient().Transport}},
+		DisableCache:  true,
+		DeriveIntents: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.On(disgord.EvtMessageCreate, func(s disgord.Session, evt *disgord.MessageCreate) {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	if err = gw.WaitForShard(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fake voice endpoint refuses the connection, which happens after the voice state and server are received
+	_, err = client.VoiceConnect(guildID, 140413331470024704)
+	if err == nil || strings.Contains(err.Error(), "timeout on receiving voice channel information") {
+		t.Errorf("expected the voice state to be sent, as the derived intents must include voice states. Got %v", err)
+	}
+}
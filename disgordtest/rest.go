@@ -0,0 +1,420 @@
+package disgordtest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSON error codes returned by the fake REST API
+const (
+	CodeGeneralError       = 0
+	CodeUnknownChannel     = 10003
+	CodeUnknownGuild       = 10004
+	CodeUnknownInvite      = 10006
+	CodeUnknownMember      = 10007
+	CodeUnknownMessage     = 10008
+	CodeUnknownOverwrite   = 10009
+	CodeUnknownRole        = 10011
+	CodeUnknownUser        = 10013
+	CodeUnknownEmoji       = 10014
+	CodeUnknownWebhook     = 10015
+	CodeUnknownBan         = 10026
+	CodeEmptyMessage       = 50006
+	CodeInvalidFormBody    = 50035
+	CodeBulkDeleteMessages = 50016
+)
+
+// discordEpoch is the first millisecond of 2015, which snowflakes are relative to
+const discordEpoch = 1420070400000
+
+// RESTConfig decides how the fake REST API behaves. The zero value accepts any token.
+type RESTConfig struct {
+	// Token is the bot token every request must be authorized with. Any token is accepted when empty,
+	// otherwise requests are rejected with 401.
+	Token string
+
+	// Username of the bot user, which is the author of every message created. Defaults to "disgordtest".
+	Username string
+
+	// RateLimit is the number of requests that can be sent to a bucket before it must reset. Defaults to 5.
+	RateLimit int
+
+	// RateLimitReset is how long it takes for a bucket to reset after the first request. Defaults to 1 second.
+	RateLimitReset time.Duration
+}
+
+// NewREST starts a fake Discord REST API, which keeps its guilds, channels, messages and other resources in
+// memory. Use REST.HTTPClient as Config.HTTPClient to send the requests of the Disgord client to it.
+// Remember to Close it.
+//
+// Every response has rate limit headers, where each route has its own bucket per channel, guild or webhook.
+// Requests beyond the rate limit are answered with 429.
+func NewREST(conf *RESTConfig) *REST {
+	r := &REST{
+		users:    map[Snowflake]object{},
+		guilds:   map[Snowflake]*restGuild{},
+		channels: map[Snowflake]*restChannel{},
+		invites:  map[string]object{},
+		webhooks: map[Snowflake]object{},
+		buckets:  map[string]*restBucket{},
+	}
+	if conf != nil {
+		r.conf = *conf
+	}
+	if r.conf.Username == "" {
+		r.conf.Username = "disgordtest"
+	}
+	if r.conf.RateLimit == 0 {
+		r.conf.RateLimit = 5
+	}
+	if r.conf.RateLimitReset == 0 {
+		r.conf.RateLimitReset = time.Second
+	}
+
+	r.botID = r.newID()
+	r.users[r.botID] = newUserObject(r.botID, r.conf.Username, true)
+	r.routes = r.newRoutes()
+
+	r.server = httptest.NewServer(r)
+	return r
+}
+
+// REST is a fake Discord REST API, see NewREST
+type REST struct {
+	server *httptest.Server
+	routes []*restRoute
+
+	mu       sync.Mutex
+	conf     RESTConfig
+	lastID   Snowflake
+	botID    Snowflake
+	users    map[Snowflake]object
+	guilds   map[Snowflake]*restGuild
+	channels map[Snowflake]*restChannel
+	invites  map[string]object
+	webhooks map[Snowflake]object
+	buckets  map[string]*restBucket
+	requests int
+}
+
+var _ http.Handler = (*REST)(nil)
+
+// object is a Discord resource, as it is sent over the REST API
+type object = map[string]interface{}
+
+type restBucket struct {
+	remaining int
+	reset     time.Time
+}
+
+// URL returns the base URL of the REST API, which corresponds to https://discord.com/api
+func (r *REST) URL() string {
+	return r.server.URL + "/api"
+}
+
+// Close stops the REST API
+func (r *REST) Close() {
+	r.server.Close()
+}
+
+// HTTPClient returns a http client that sends every request to the fake REST API, no matter the host
+func (r *REST) HTTPClient() *http.Client {
+	return &http.Client{Transport: &restTransport{target: r.server.URL, transport: r.server.Client().Transport}}
+}
+
+type restTransport struct {
+	target    string
+	transport http.RoundTripper
+}
+
+func (t *restTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, err := url.Parse(t.target)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+	req.Host = target.Host
+	return t.transport.RoundTrip(req)
+}
+
+// BotID returns the user ID of the bot
+func (r *REST) BotID() Snowflake {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.botID
+}
+
+// Requests returns the number of requests the REST API has received, including rate limited ones
+func (r *REST) Requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+// AddUser creates a user that can be added to guilds, eg. with Client.AddGuildMember
+func (r *REST) AddUser(username string) Snowflake {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := r.newID()
+	r.users[id] = newUserObject(id, username, false)
+	return id
+}
+
+// AddGuild creates a guild owned by the bot, with an @everyone role and a #general text channel
+func (r *REST) AddGuild(name string) (guildID, channelID Snowflake) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	guild := r.createGuild(object{"name": name})
+	return guild.id, guild.channels[0]
+}
+
+// newID returns an unique snowflake, which holds the current time such as those made by Discord
+func (r *REST) newID() Snowflake {
+	id := Snowflake(uint64(time.Now().UnixNano()/int64(time.Millisecond)-discordEpoch) << 22)
+	if id <= r.lastID {
+		id = r.lastID + 1
+	}
+	r.lastID = id
+	return id
+}
+
+//////////////////////////////////////////////////////
+//
+// ROUTING
+//
+//////////////////////////////////////////////////////
+
+type restRoute struct {
+	method   string
+	pattern  string
+	segments []string
+	bucket   string // discord bucket hash
+	handle   func(req *restRequest)
+}
+
+// restRequest is a request matched to a route, which is handled while the REST lock is held
+type restRequest struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	params map[string]string
+	body   []byte
+}
+
+var regexpRESTVersion = regexp.MustCompile(`^/api(/v[0-9]+)?`)
+
+func (r *REST) route(method, pattern string, handle func(req *restRequest)) *restRoute {
+	sum := md5.Sum([]byte(method + " " + pattern))
+	return &restRoute{
+		method:   method,
+		pattern:  pattern,
+		segments: strings.Split(strings.Trim(pattern, "/"), "/"),
+		bucket:   hex.EncodeToString(sum[:]),
+		handle:   handle,
+	}
+}
+
+// match returns the params of the path, or nil when the path does not match the route
+func (route *restRoute) match(segments []string) map[string]string {
+	if len(segments) != len(route.segments) {
+		return nil
+	}
+
+	params := map[string]string{}
+	for i, segment := range route.segments {
+		if strings.HasPrefix(segment, "{") {
+			params[strings.Trim(segment, "{}")] = segments[i]
+		} else if segment != segments[i] {
+			return nil
+		}
+	}
+	return params
+}
+
+// majorParam is the ID that gives a route its own bucket per channel, guild or webhook
+func (route *restRoute) majorParam(params map[string]string) string {
+	switch route.segments[0] {
+	case "channels", "guilds", "webhooks":
+		if len(route.segments) > 1 {
+			return params[strings.Trim(route.segments[1], "{}")]
+		}
+	}
+	return ""
+}
+
+func (r *REST) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := regexpRESTVersion.ReplaceAllString(req.URL.EscapedPath(), "")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range segments {
+		segments[i], _ = url.PathUnescape(segments[i])
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeGeneralError, "400: Bad Request")
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+
+	if r.conf.Token != "" && req.Header.Get("Authorization") != "Bot "+r.conf.Token {
+		writeError(w, http.StatusUnauthorized, CodeGeneralError, "401: Unauthorized")
+		return
+	}
+
+	var methodNotAllowed bool
+	for _, route := range r.routes {
+		params := route.match(segments)
+		if params == nil {
+			continue
+		}
+		if route.method != req.Method {
+			methodNotAllowed = true
+			continue
+		}
+
+		if !r.rateLimit(w, route, route.majorParam(params)) {
+			return
+		}
+		route.handle(&restRequest{w: w, r: req, params: params, body: body})
+		return
+	}
+
+	if methodNotAllowed {
+		writeError(w, http.StatusMethodNotAllowed, CodeGeneralError, "405: Method Not Allowed")
+	} else {
+		writeError(w, http.StatusNotFound, CodeGeneralError, "404: Not Found")
+	}
+}
+
+// rateLimit takes a request from the bucket of the route and writes the rate limit headers. A 429 is written
+// when the bucket is exhausted, in which case false is returned.
+func (r *REST) rateLimit(w http.ResponseWriter, route *restRoute, majorParam string) bool {
+	now := time.Now()
+	key := route.bucket + ":" + majorParam
+	bucket, ok := r.buckets[key]
+	if !ok || !now.Before(bucket.reset) {
+		bucket = &restBucket{remaining: r.conf.RateLimit, reset: now.Add(r.conf.RateLimitReset)}
+		r.buckets[key] = bucket
+	}
+
+	limited := bucket.remaining == 0
+	if !limited {
+		bucket.remaining--
+	}
+
+	resetAfter := bucket.reset.Sub(now)
+	header := w.Header()
+	header.Set("X-RateLimit-Bucket", route.bucket)
+	header.Set("X-RateLimit-Limit", strconv.Itoa(r.conf.RateLimit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(bucket.remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatFloat(float64(bucket.reset.UnixNano())/float64(time.Second), 'f', 3, 64))
+	header.Set("X-RateLimit-Reset-After", strconv.FormatFloat(resetAfter.Seconds(), 'f', 3, 64))
+	if !limited {
+		return true
+	}
+
+	retryAfter := int64(math.Ceil(float64(resetAfter) / float64(time.Millisecond)))
+	header.Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	writeJSON(w, http.StatusTooManyRequests, object{
+		"message":     "You are being rate limited.",
+		"retry_after": retryAfter,
+		"global":      false,
+	})
+	return false
+}
+
+//////////////////////////////////////////////////////
+//
+// RESPONSES
+//
+//////////////////////////////////////////////////////
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, code int, message string) {
+	writeJSON(w, status, object{"code": code, "message": message})
+}
+
+func (req *restRequest) json(v interface{}) {
+	writeJSON(req.w, http.StatusOK, v)
+}
+
+func (req *restRequest) created(v interface{}) {
+	writeJSON(req.w, http.StatusCreated, v)
+}
+
+func (req *restRequest) noContent() {
+	req.w.WriteHeader(http.StatusNoContent)
+}
+
+func (req *restRequest) notFound(code int, message string) {
+	writeError(req.w, http.StatusNotFound, code, message)
+}
+
+func (req *restRequest) invalidForm(message string) {
+	writeError(req.w, http.StatusBadRequest, CodeInvalidFormBody, "Invalid Form Body: "+message)
+}
+
+// decode reads the JSON body, and writes a 400 response when it is invalid
+func (req *restRequest) decode(v interface{}) bool {
+	if len(req.body) == 0 {
+		return true
+	}
+	if err := json.Unmarshal(req.body, v); err != nil {
+		req.invalidForm(err.Error())
+		return false
+	}
+	return true
+}
+
+// id parses a snowflake param. Invalid snowflakes are given as 0, which never matches a resource.
+func (req *restRequest) id(name string) Snowflake {
+	id, _ := strconv.ParseUint(req.params[name], 10, 64)
+	return Snowflake(id)
+}
+
+// query returns an integer query parameter, or the default when it is missing
+func (req *restRequest) queryInt(name string, def int) int {
+	v, err := strconv.Atoi(req.r.URL.Query().Get(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func (req *restRequest) queryID(name string) Snowflake {
+	id, _ := strconv.ParseUint(req.r.URL.Query().Get(name), 10, 64)
+	return Snowflake(id)
+}
+
+// parseID parses the snowflake of a resource, which is stored as a string
+func parseID(s string) Snowflake {
+	id, _ := strconv.ParseUint(s, 10, 64)
+	return Snowflake(id)
+}
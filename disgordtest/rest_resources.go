@@ -0,0 +1,1729 @@
+package disgordtest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// channel types
+const (
+	channelGuildText = 0
+	channelDM        = 1
+)
+
+type restGuild struct {
+	id       Snowflake
+	obj      object
+	channels []Snowflake
+	roles    []object
+	members  map[Snowflake]object
+	joined   []Snowflake // member IDs in the order they joined
+	bans     map[Snowflake]object
+	emojis   []object
+}
+
+type restChannel struct {
+	id       Snowflake
+	guildID  Snowflake
+	obj      object
+	messages []object // oldest first
+	pins     []Snowflake
+
+	// reactions holds the users that reacted with each emoji, per message
+	reactions map[Snowflake]map[string][]Snowflake
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+func randomToken(size int) string {
+	b := make([]byte, size)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func newUserObject(id Snowflake, username string, bot bool) object {
+	return object{
+		"id":            id.String(),
+		"username":      username,
+		"discriminator": "0001",
+		"avatar":        nil,
+		"bot":           bot,
+	}
+}
+
+// update copies the fields of a PATCH body into the resource, except for the fields that can not change
+func update(obj, fields object) {
+	for k, v := range fields {
+		switch k {
+		case "id", "guild_id", "channel_id", "author", "user":
+			continue
+		}
+		obj[k] = v
+	}
+}
+
+func (r *REST) newRoutes() []*restRoute {
+	return []*restRoute{
+		// channels
+		r.route(http.MethodGet, "/channels/{channel}", r.getChannel),
+		r.route(http.MethodPatch, "/channels/{channel}", r.updateChannel),
+		r.route(http.MethodDelete, "/channels/{channel}", r.deleteChannel),
+		r.route(http.MethodPost, "/channels/{channel}/typing", r.triggerTyping),
+		r.route(http.MethodPut, "/channels/{channel}/permissions/{overwrite}", r.updateOverwrite),
+		r.route(http.MethodDelete, "/channels/{channel}/permissions/{overwrite}", r.deleteOverwrite),
+		r.route(http.MethodGet, "/channels/{channel}/invites", r.getChannelInvites),
+		r.route(http.MethodPost, "/channels/{channel}/invites", r.createInvite),
+		r.route(http.MethodGet, "/channels/{channel}/webhooks", r.getChannelWebhooks),
+		r.route(http.MethodPost, "/channels/{channel}/webhooks", r.createWebhook),
+
+		// messages
+		r.route(http.MethodGet, "/channels/{channel}/messages", r.getMessages),
+		r.route(http.MethodPost, "/channels/{channel}/messages", r.createMessage),
+		r.route(http.MethodPost, "/channels/{channel}/messages/bulk-delete", r.bulkDeleteMessages),
+		r.route(http.MethodGet, "/channels/{channel}/messages/{message}", r.getMessage),
+		r.route(http.MethodPatch, "/channels/{channel}/messages/{message}", r.updateMessage),
+		r.route(http.MethodDelete, "/channels/{channel}/messages/{message}", r.deleteMessage),
+		r.route(http.MethodGet, "/channels/{channel}/pins", r.getPins),
+		r.route(http.MethodPut, "/channels/{channel}/pins/{message}", r.pinMessage),
+		r.route(http.MethodDelete, "/channels/{channel}/pins/{message}", r.unpinMessage),
+		r.route(http.MethodDelete, "/channels/{channel}/messages/{message}/reactions", r.deleteAllReactions),
+		r.route(http.MethodGet, "/channels/{channel}/messages/{message}/reactions/{emoji}", r.getReactions),
+		r.route(http.MethodPut, "/channels/{channel}/messages/{message}/reactions/{emoji}/{user}", r.createReaction),
+		r.route(http.MethodDelete, "/channels/{channel}/messages/{message}/reactions/{emoji}/{user}", r.deleteReaction),
+
+		// guilds
+		r.route(http.MethodPost, "/guilds", r.createGuildRoute),
+		r.route(http.MethodGet, "/guilds/{guild}", r.getGuild),
+		r.route(http.MethodPatch, "/guilds/{guild}", r.updateGuild),
+		r.route(http.MethodDelete, "/guilds/{guild}", r.deleteGuild),
+		r.route(http.MethodGet, "/guilds/{guild}/channels", r.getGuildChannels),
+		r.route(http.MethodPost, "/guilds/{guild}/channels", r.createGuildChannel),
+		r.route(http.MethodPatch, "/guilds/{guild}/channels", r.updateGuildChannelPositions),
+		r.route(http.MethodGet, "/guilds/{guild}/audit-logs", r.getAuditLogs),
+		r.route(http.MethodGet, "/guilds/{guild}/invites", r.getGuildInvites),
+		r.route(http.MethodGet, "/guilds/{guild}/webhooks", r.getGuildWebhooks),
+
+		// members
+		r.route(http.MethodGet, "/guilds/{guild}/members", r.getMembers),
+		r.route(http.MethodPatch, "/guilds/{guild}/members/@me/nick", r.updateNick),
+		r.route(http.MethodGet, "/guilds/{guild}/members/{user}", r.getMember),
+		r.route(http.MethodPut, "/guilds/{guild}/members/{user}", r.addMember),
+		r.route(http.MethodPatch, "/guilds/{guild}/members/{user}", r.updateMember),
+		r.route(http.MethodDelete, "/guilds/{guild}/members/{user}", r.kickMember),
+		r.route(http.MethodPut, "/guilds/{guild}/members/{user}/roles/{role}", r.addMemberRole),
+		r.route(http.MethodDelete, "/guilds/{guild}/members/{user}/roles/{role}", r.removeMemberRole),
+		r.route(http.MethodGet, "/guilds/{guild}/bans", r.getBans),
+		r.route(http.MethodGet, "/guilds/{guild}/bans/{user}", r.getBan),
+		r.route(http.MethodPut, "/guilds/{guild}/bans/{user}", r.ban),
+		r.route(http.MethodDelete, "/guilds/{guild}/bans/{user}", r.unban),
+
+		// roles
+		r.route(http.MethodGet, "/guilds/{guild}/roles", r.getRoles),
+		r.route(http.MethodPost, "/guilds/{guild}/roles", r.createRole),
+		r.route(http.MethodPatch, "/guilds/{guild}/roles", r.updateRolePositions),
+		r.route(http.MethodPatch, "/guilds/{guild}/roles/{role}", r.updateRole),
+		r.route(http.MethodDelete, "/guilds/{guild}/roles/{role}", r.deleteRole),
+
+		// emojis
+		r.route(http.MethodGet, "/guilds/{guild}/emojis", r.getEmojis),
+		r.route(http.MethodPost, "/guilds/{guild}/emojis", r.createEmoji),
+		r.route(http.MethodGet, "/guilds/{guild}/emojis/{emoji}", r.getEmoji),
+		r.route(http.MethodPatch, "/guilds/{guild}/emojis/{emoji}", r.updateEmoji),
+		r.route(http.MethodDelete, "/guilds/{guild}/emojis/{emoji}", r.deleteEmoji),
+
+		// invites
+		r.route(http.MethodGet, "/invites/{code}", r.getInvite),
+		r.route(http.MethodDelete, "/invites/{code}", r.deleteInvite),
+
+		// webhooks
+		r.route(http.MethodGet, "/webhooks/{webhook}", r.getWebhook),
+		r.route(http.MethodPatch, "/webhooks/{webhook}", r.updateWebhook),
+		r.route(http.MethodDelete, "/webhooks/{webhook}", r.deleteWebhook),
+		r.route(http.MethodGet, "/webhooks/{webhook}/{token}", r.getWebhook),
+		r.route(http.MethodPatch, "/webhooks/{webhook}/{token}", r.updateWebhook),
+		r.route(http.MethodDelete, "/webhooks/{webhook}/{token}", r.deleteWebhook),
+		r.route(http.MethodPost, "/webhooks/{webhook}/{token}", r.executeWebhook),
+
+		// users
+		r.route(http.MethodGet, "/users/@me", r.getCurrentUser),
+		r.route(http.MethodPatch, "/users/@me", r.updateCurrentUser),
+		r.route(http.MethodGet, "/users/@me/guilds", r.getCurrentUserGuilds),
+		r.route(http.MethodDelete, "/users/@me/guilds/{guild}", r.leaveGuild),
+		r.route(http.MethodPost, "/users/@me/channels", r.createDM),
+		r.route(http.MethodGet, "/users/@me/connections", r.getConnections),
+		r.route(http.MethodGet, "/users/{user}", r.getUser),
+		r.route(http.MethodGet, "/voice/regions", r.getVoiceRegions),
+	}
+}
+
+//////////////////////////////////////////////////////
+//
+// LOOKUPS
+//
+//////////////////////////////////////////////////////
+
+func (r *REST) guild(req *restRequest) *restGuild {
+	guild, ok := r.guilds[req.id("guild")]
+	if !ok {
+		req.notFound(CodeUnknownGuild, "Unknown Guild")
+		return nil
+	}
+	return guild
+}
+
+func (r *REST) channel(req *restRequest) *restChannel {
+	channel, ok := r.channels[req.id("channel")]
+	if !ok {
+		req.notFound(CodeUnknownChannel, "Unknown Channel")
+		return nil
+	}
+	return channel
+}
+
+func (r *REST) message(req *restRequest) (*restChannel, int) {
+	channel := r.channel(req)
+	if channel == nil {
+		return nil, -1
+	}
+
+	id := req.id("message").String()
+	for i := range channel.messages {
+		if channel.messages[i]["id"] == id {
+			return channel, i
+		}
+	}
+	req.notFound(CodeUnknownMessage, "Unknown Message")
+	return nil, -1
+}
+
+func (r *REST) user(req *restRequest, id Snowflake) object {
+	user, ok := r.users[id]
+	if !ok {
+		req.notFound(CodeUnknownUser, "Unknown User")
+		return nil
+	}
+	return user
+}
+
+func (r *REST) member(req *restRequest) (*restGuild, object) {
+	guild := r.guild(req)
+	if guild == nil {
+		return nil, nil
+	}
+
+	member, ok := guild.members[req.id("user")]
+	if !ok {
+		req.notFound(CodeUnknownMember, "Unknown Member")
+		return nil, nil
+	}
+	return guild, member
+}
+
+func indexOf(objects []object, id Snowflake) int {
+	for i := range objects {
+		if objects[i]["id"] == id.String() {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *restGuild) role(req *restRequest) int {
+	i := indexOf(g.roles, req.id("role"))
+	if i == -1 {
+		req.notFound(CodeUnknownRole, "Unknown Role")
+	}
+	return i
+}
+
+func (g *restGuild) emoji(req *restRequest) int {
+	i := indexOf(g.emojis, req.id("emoji"))
+	if i == -1 {
+		req.notFound(CodeUnknownEmoji, "Unknown Emoji")
+	}
+	return i
+}
+
+//////////////////////////////////////////////////////
+//
+// CHANNELS
+//
+//////////////////////////////////////////////////////
+
+func (r *REST) createChannel(guildID Snowflake, fields object) *restChannel {
+	id := r.newID()
+	obj := object{
+		"id":                    id.String(),
+		"type":                  channelGuildText,
+		"name":                  "",
+		"position":              0,
+		"permission_overwrites": []interface{}{},
+		"nsfw":                  false,
+	}
+	update(obj, fields)
+	if !guildID.IsZero() {
+		obj["guild_id"] = guildID.String()
+	}
+
+	channel := &restChannel{id: id, guildID: guildID, obj: obj, reactions: map[Snowflake]map[string][]Snowflake{}}
+	r.channels[id] = channel
+	if guild, ok := r.guilds[guildID]; ok {
+		obj["position"] = len(guild.channels)
+		guild.channels = append(guild.channels, id)
+	}
+	return channel
+}
+
+func (r *REST) deleteChannelState(channel *restChannel) {
+	delete(r.channels, channel.id)
+	if guild, ok := r.guilds[channel.guildID]; ok {
+		for i := range guild.channels {
+			if guild.channels[i] == channel.id {
+				guild.channels = append(guild.channels[:i], guild.channels[i+1:]...)
+				break
+			}
+		}
+	}
+	for code, invite := range r.invites {
+		if invite["channel"].(object)["id"] == channel.id.String() {
+			delete(r.invites, code)
+		}
+	}
+	for id, webhook := range r.webhooks {
+		if webhook["channel_id"] == channel.id.String() {
+			delete(r.webhooks, id)
+		}
+	}
+}
+
+func (r *REST) getChannel(req *restRequest) {
+	if channel := r.channel(req); channel != nil {
+		req.json(channel.obj)
+	}
+}
+
+func (r *REST) updateChannel(req *restRequest) {
+	channel := r.channel(req)
+	if channel == nil {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	update(channel.obj, fields)
+	req.json(channel.obj)
+}
+
+func (r *REST) deleteChannel(req *restRequest) {
+	channel := r.channel(req)
+	if channel == nil {
+		return
+	}
+
+	r.deleteChannelState(channel)
+	req.json(channel.obj)
+}
+
+func (r *REST) triggerTyping(req *restRequest) {
+	if channel := r.channel(req); channel != nil {
+		req.noContent()
+	}
+}
+
+func (r *REST) updateOverwrite(req *restRequest) {
+	channel := r.channel(req)
+	if channel == nil {
+		return
+	}
+
+	overwrite := object{}
+	if !req.decode(&overwrite) {
+		return
+	}
+	overwrite["id"] = req.id("overwrite").String()
+
+	overwrites := []interface{}{overwrite}
+	for _, o := range channel.obj["permission_overwrites"].([]interface{}) {
+		if o.(object)["id"] != overwrite["id"] {
+			overwrites = append(overwrites, o)
+		}
+	}
+	channel.obj["permission_overwrites"] = overwrites
+	req.noContent()
+}
+
+func (r *REST) deleteOverwrite(req *restRequest) {
+	channel := r.channel(req)
+	if channel == nil {
+		return
+	}
+
+	var overwrites []interface{}
+	for _, o := range channel.obj["permission_overwrites"].([]interface{}) {
+		if o.(object)["id"] != req.id("overwrite").String() {
+			overwrites = append(overwrites, o)
+		}
+	}
+	if len(overwrites) == len(channel.obj["permission_overwrites"].([]interface{})) {
+		req.notFound(CodeUnknownOverwrite, "Unknown Overwrite")
+		return
+	}
+	if overwrites == nil {
+		overwrites = []interface{}{}
+	}
+	channel.obj["permission_overwrites"] = overwrites
+	req.noContent()
+}
+
+//////////////////////////////////////////////////////
+//
+// MESSAGES
+//
+//////////////////////////////////////////////////////
+
+func (r *REST) newMessage(channel *restChannel, author object, fields object) object {
+	id := r.newID()
+	msg := object{
+		"id":               id.String(),
+		"channel_id":       channel.id.String(),
+		"author":           author,
+		"content":          "",
+		"timestamp":        timestamp(),
+		"edited_timestamp": nil,
+		"tts":              false,
+		"mention_everyone": false,
+		"mentions":         []interface{}{},
+		"mention_roles":    []interface{}{},
+		"attachments":      []interface{}{},
+		"embeds":           []interface{}{},
+		"pinned":           false,
+		"type":             0,
+	}
+	if !channel.guildID.IsZero() {
+		msg["guild_id"] = channel.guildID.String()
+	}
+	for _, k := range []string{"content", "tts", "nonce"} {
+		if v, ok := fields[k]; ok {
+			msg[k] = v
+		}
+	}
+	if embed, ok := fields["embed"]; ok && embed != nil {
+		msg["embeds"] = []interface{}{embed}
+	}
+	if embeds, ok := fields["embeds"]; ok && embeds != nil {
+		msg["embeds"] = embeds
+	}
+
+	channel.messages = append(channel.messages, msg)
+	channel.obj["last_message_id"] = id.String()
+	return msg
+}
+
+// messageFields reads the JSON body of a message, or the payload_json and files of a multipart body
+func (r *REST) messageFields(req *restRequest) (fields object, attachments []interface{}, ok bool) {
+	fields = object{}
+	mediaType, params, _ := mime.ParseMediaType(req.r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return fields, nil, req.decode(&fields)
+	}
+
+	form, err := multipart.NewReader(bytes.NewReader(req.body), params["boundary"]).ReadForm(32 << 20)
+	if err != nil {
+		req.invalidForm(err.Error())
+		return nil, nil, false
+	}
+	if payload := form.Value["payload_json"]; len(payload) > 0 {
+		if err = json.Unmarshal([]byte(payload[0]), &fields); err != nil {
+			req.invalidForm(err.Error())
+			return nil, nil, false
+		}
+	}
+
+	var names []string
+	for name := range form.File {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, file := range form.File[name] {
+			id := r.newID()
+			attachments = append(attachments, object{
+				"id":       id.String(),
+				"filename": file.Filename,
+				"size":     file.Size,
+				"url":      "https://cdn.discordapp.com/attachments/" + req.params["channel"] + "/" + id.String() + "/" + file.Filename,
+			})
+		}
+	}
+	return fields, attachments, true
+}
+
+func (r *REST) createMessage(req *restRequest) {
+	channel := r.channel(req)
+	if channel == nil {
+		return
+	}
+
+	fields, attachments, ok := r.messageFields(req)
+	if !ok {
+		return
+	}
+	content, _ := fields["content"].(string)
+	embed := fields["embed"]
+	if content == "" && embed == nil && len(attachments) == 0 {
+		writeError(req.w, http.StatusBadRequest, CodeEmptyMessage, "Cannot send an empty message")
+		return
+	}
+	if len(content) > 2000 {
+		req.invalidForm("content: Must be 2000 or fewer in length.")
+		return
+	}
+
+	msg := r.newMessage(channel, r.users[r.botID], fields)
+	if attachments != nil {
+		msg["attachments"] = attachments
+	}
+	req.json(msg)
+}
+
+func (r *REST) getMessages(req *restRequest) {
+	channel := r.channel(req)
+	if channel == nil {
+		return
+	}
+
+	limit := req.queryInt("limit", 50)
+	if limit < 1 || limit > 100 {
+		req.invalidForm("limit: int value should be between 1 and 100.")
+		return
+	}
+
+	// messages are stored oldest first, and returned newest first
+	messages := channel.messages
+	var selected []object
+	if before := req.queryID("before"); !before.IsZero() {
+		for i := len(messages) - 1; i >= 0 && len(selected) < limit; i-- {
+			if messageID(messages[i]) < before {
+				selected = append(selected, messages[i])
+			}
+		}
+	} else if after := req.queryID("after"); !after.IsZero() {
+		for i := 0; i < len(messages) && len(selected) < limit; i++ {
+			if messageID(messages[i]) > after {
+				selected = append([]object{messages[i]}, selected...)
+			}
+		}
+	} else if around := req.queryID("around"); !around.IsZero() {
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messageID(messages[i]) <= around {
+				start := i - limit/2
+				if start < 0 {
+					start = 0
+				}
+				end := start + limit
+				if end > len(messages) {
+					end = len(messages)
+				}
+				for j := end - 1; j >= start; j-- {
+					selected = append(selected, messages[j])
+				}
+				break
+			}
+		}
+	} else {
+		for i := len(messages) - 1; i >= 0 && len(selected) < limit; i-- {
+			selected = append(selected, messages[i])
+		}
+	}
+
+	if selected == nil {
+		selected = []object{}
+	}
+	req.json(selected)
+}
+
+func messageID(msg object) Snowflake {
+	return parseID(msg["id"].(string))
+}
+
+func (r *REST) getMessage(req *restRequest) {
+	if channel, i := r.message(req); channel != nil {
+		req.json(channel.messages[i])
+	}
+}
+
+func (r *REST) updateMessage(req *restRequest) {
+	channel, i := r.message(req)
+	if channel == nil {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	msg := channel.messages[i]
+	if content, ok := fields["content"]; ok {
+		msg["content"] = content
+	}
+	if embed, ok := fields["embed"]; ok {
+		msg["embeds"] = []interface{}{}
+		if embed != nil {
+			msg["embeds"] = []interface{}{embed}
+		}
+	}
+	msg["edited_timestamp"] = timestamp()
+	req.json(msg)
+}
+
+func (r *REST) deleteMessage(req *restRequest) {
+	channel, i := r.message(req)
+	if channel == nil {
+		return
+	}
+
+	channel.removeMessage(i)
+	req.noContent()
+}
+
+func (c *restChannel) removeMessage(i int) {
+	id := messageID(c.messages[i])
+	c.messages = append(c.messages[:i], c.messages[i+1:]...)
+	delete(c.reactions, id)
+	for j := range c.pins {
+		if c.pins[j] == id {
+			c.pins = append(c.pins[:j], c.pins[j+1:]...)
+			break
+		}
+	}
+}
+
+func (r *REST) bulkDeleteMessages(req *restRequest) {
+	channel := r.channel(req)
+	if channel == nil {
+		return
+	}
+
+	body := &struct {
+		Messages []Snowflake `json:"messages"`
+	}{}
+	if !req.decode(body) {
+		return
+	}
+	if len(body.Messages) < 2 || len(body.Messages) > 100 {
+		req.invalidForm("messages: Must be between 2 and 100 in length.")
+		return
+	}
+
+	// messages older than 2 weeks can not be bulk deleted
+	twoWeeksAgo := time.Now().Add(-14 * 24 * time.Hour)
+	for _, id := range body.Messages {
+		if time.Unix(0, int64(uint64(id)>>22+discordEpoch)*int64(time.Millisecond)).Before(twoWeeksAgo) {
+			writeError(req.w, http.StatusBadRequest, CodeBulkDeleteMessages, "You can only bulk delete messages that are under 14 days old.")
+			return
+		}
+	}
+	for _, id := range body.Messages {
+		for i := range channel.messages {
+			if messageID(channel.messages[i]) == id {
+				channel.removeMessage(i)
+				break
+			}
+		}
+	}
+	req.noContent()
+}
+
+func (r *REST) getPins(req *restRequest) {
+	channel := r.channel(req)
+	if channel == nil {
+		return
+	}
+
+	pinned := []object{}
+	for i := len(channel.messages) - 1; i >= 0; i-- {
+		if channel.messages[i]["pinned"] == true {
+			pinned = append(pinned, channel.messages[i])
+		}
+	}
+	req.json(pinned)
+}
+
+func (r *REST) pinMessage(req *restRequest) {
+	channel, i := r.message(req)
+	if channel == nil {
+		return
+	}
+
+	if channel.messages[i]["pinned"] != true {
+		channel.messages[i]["pinned"] = true
+		channel.pins = append(channel.pins, messageID(channel.messages[i]))
+	}
+	req.noContent()
+}
+
+func (r *REST) unpinMessage(req *restRequest) {
+	channel, i := r.message(req)
+	if channel == nil {
+		return
+	}
+
+	channel.messages[i]["pinned"] = false
+	for j := range channel.pins {
+		if channel.pins[j] == messageID(channel.messages[i]) {
+			channel.pins = append(channel.pins[:j], channel.pins[j+1:]...)
+			break
+		}
+	}
+	req.noContent()
+}
+
+// reactionUser returns the user of a reaction route, where @me is the bot
+func (r *REST) reactionUser(req *restRequest) Snowflake {
+	if req.params["user"] == "@me" {
+		return r.botID
+	}
+	return req.id("user")
+}
+
+// updateReactions writes the reaction counts of the message
+func (r *REST) updateReactions(channel *restChannel, i int) {
+	id := messageID(channel.messages[i])
+	var emojis []string
+	for emoji := range channel.reactions[id] {
+		emojis = append(emojis, emoji)
+	}
+	sort.Strings(emojis)
+
+	reactions := []interface{}{}
+	for _, emoji := range emojis {
+		users := channel.reactions[id][emoji]
+		var me bool
+		for _, user := range users {
+			me = me || user == r.botID
+		}
+		reactions = append(reactions, object{
+			"count": len(users),
+			"me":    me,
+			"emoji": object{"id": nil, "name": emoji},
+		})
+	}
+	channel.messages[i]["reactions"] = reactions
+}
+
+func (r *REST) createReaction(req *restRequest) {
+	channel, i := r.message(req)
+	if channel == nil {
+		return
+	}
+	if req.params["user"] != "@me" {
+		writeError(req.w, http.StatusMethodNotAllowed, CodeGeneralError, "405: Method Not Allowed")
+		return
+	}
+
+	id, emoji := messageID(channel.messages[i]), req.params["emoji"]
+	if channel.reactions[id] == nil {
+		channel.reactions[id] = map[string][]Snowflake{}
+	}
+	for _, user := range channel.reactions[id][emoji] {
+		if user == r.botID {
+			req.noContent()
+			return
+		}
+	}
+	channel.reactions[id][emoji] = append(channel.reactions[id][emoji], r.botID)
+	r.updateReactions(channel, i)
+	req.noContent()
+}
+
+func (r *REST) deleteReaction(req *restRequest) {
+	channel, i := r.message(req)
+	if channel == nil {
+		return
+	}
+
+	id, emoji, userID := messageID(channel.messages[i]), req.params["emoji"], r.reactionUser(req)
+	users := channel.reactions[id][emoji]
+	for j := range users {
+		if users[j] == userID {
+			users = append(users[:j], users[j+1:]...)
+			break
+		}
+	}
+	if len(users) == 0 {
+		delete(channel.reactions[id], emoji)
+	} else {
+		channel.reactions[id][emoji] = users
+	}
+	r.updateReactions(channel, i)
+	req.noContent()
+}
+
+func (r *REST) deleteAllReactions(req *restRequest) {
+	channel, i := r.message(req)
+	if channel == nil {
+		return
+	}
+
+	delete(channel.reactions, messageID(channel.messages[i]))
+	r.updateReactions(channel, i)
+	req.noContent()
+}
+
+func (r *REST) getReactions(req *restRequest) {
+	channel, i := r.message(req)
+	if channel == nil {
+		return
+	}
+
+	users := []object{}
+	for _, userID := range channel.reactions[messageID(channel.messages[i])][req.params["emoji"]] {
+		if user, ok := r.users[userID]; ok {
+			users = append(users, user)
+		}
+	}
+	req.json(users)
+}
+
+//////////////////////////////////////////////////////
+//
+// GUILDS
+//
+//////////////////////////////////////////////////////
+
+func (r *REST) createGuild(fields object) *restGuild {
+	id := r.newID()
+	obj := object{
+		"id":                 id.String(),
+		"name":               "",
+		"icon":               nil,
+		"region":             "europe",
+		"owner_id":           r.botID.String(),
+		"verification_level": 0,
+		"features":           []interface{}{},
+	}
+	update(obj, fields)
+	delete(obj, "roles")
+	delete(obj, "channels")
+
+	guild := &restGuild{
+		id:      id,
+		obj:     obj,
+		members: map[Snowflake]object{},
+		bans:    map[Snowflake]object{},
+		roles: []object{{
+			"id":          id.String(), // @everyone shares the ID of the guild
+			"name":        "@everyone",
+			"color":       0,
+			"hoist":       false,
+			"position":    0,
+			"permissions": 104324673,
+			"managed":     false,
+			"mentionable": false,
+		}},
+		emojis: []object{},
+	}
+	r.guilds[id] = guild
+
+	r.createChannel(id, object{"name": "general"})
+	guild.addMember(r.users[r.botID])
+	return guild
+}
+
+// object returns the guild with its roles and emojis
+func (g *restGuild) object() object {
+	obj := object{}
+	for k, v := range g.obj {
+		obj[k] = v
+	}
+	obj["roles"] = g.roles
+	obj["emojis"] = g.emojis
+	return obj
+}
+
+func (g *restGuild) addMember(user object) object {
+	id := parseID(user["id"].(string))
+	member := object{
+		"user":      user,
+		"nick":      nil,
+		"roles":     []interface{}{},
+		"joined_at": timestamp(),
+		"deaf":      false,
+		"mute":      false,
+	}
+	g.members[id] = member
+	g.joined = append(g.joined, id)
+	return member
+}
+
+func (g *restGuild) removeMember(id Snowflake) {
+	delete(g.members, id)
+	for i := range g.joined {
+		if g.joined[i] == id {
+			g.joined = append(g.joined[:i], g.joined[i+1:]...)
+			break
+		}
+	}
+}
+
+func (r *REST) createGuildRoute(req *restRequest) {
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	if name, _ := fields["name"].(string); len(name) < 2 || len(name) > 100 {
+		req.invalidForm("name: Must be between 2 and 100 in length.")
+		return
+	}
+	req.created(r.createGuild(fields).object())
+}
+
+func (r *REST) getGuild(req *restRequest) {
+	if guild := r.guild(req); guild != nil {
+		req.json(guild.object())
+	}
+}
+
+func (r *REST) updateGuild(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	delete(fields, "roles")
+	delete(fields, "emojis")
+	update(guild.obj, fields)
+	req.json(guild.object())
+}
+
+func (r *REST) deleteGuild(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	for _, id := range append([]Snowflake(nil), guild.channels...) {
+		r.deleteChannelState(r.channels[id])
+	}
+	delete(r.guilds, guild.id)
+	req.noContent()
+}
+
+func (r *REST) getGuildChannels(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	channels := []object{}
+	for _, id := range guild.channels {
+		channels = append(channels, r.channels[id].obj)
+	}
+	req.json(channels)
+}
+
+func (r *REST) createGuildChannel(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	if name, _ := fields["name"].(string); len(name) < 2 || len(name) > 100 {
+		req.invalidForm("name: Must be between 2 and 100 in length.")
+		return
+	}
+	req.created(r.createChannel(guild.id, fields).obj)
+}
+
+func (r *REST) updateGuildChannelPositions(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	var positions []struct {
+		ID       Snowflake `json:"id"`
+		Position int       `json:"position"`
+	}
+	if !req.decode(&positions) {
+		return
+	}
+	for _, p := range positions {
+		if channel, ok := r.channels[p.ID]; ok && channel.guildID == guild.id {
+			channel.obj["position"] = p.Position
+		}
+	}
+	req.noContent()
+}
+
+func (r *REST) getAuditLogs(req *restRequest) {
+	if guild := r.guild(req); guild != nil {
+		req.json(object{
+			"audit_log_entries": []interface{}{},
+			"users":             []interface{}{},
+			"webhooks":          []interface{}{},
+			"integrations":      []interface{}{},
+		})
+	}
+}
+
+//////////////////////////////////////////////////////
+//
+// MEMBERS
+//
+//////////////////////////////////////////////////////
+
+func (r *REST) getMembers(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	limit := req.queryInt("limit", 1)
+	if limit < 1 || limit > 1000 {
+		req.invalidForm("limit: int value should be between 1 and 1000.")
+		return
+	}
+
+	// members are listed by user ID
+	ids := append([]Snowflake(nil), guild.joined...)
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	after := req.queryID("after")
+	members := []object{}
+	for _, id := range ids {
+		if id > after && len(members) < limit {
+			members = append(members, guild.members[id])
+		}
+	}
+	req.json(members)
+}
+
+func (r *REST) getMember(req *restRequest) {
+	if _, member := r.member(req); member != nil {
+		req.json(member)
+	}
+}
+
+func (r *REST) addMember(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+	user := r.user(req, req.id("user"))
+	if user == nil {
+		return
+	}
+	if _, exists := guild.members[req.id("user")]; exists {
+		req.noContent()
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	member := guild.addMember(user)
+	for _, k := range []string{"nick", "roles", "mute", "deaf"} {
+		if v, ok := fields[k]; ok {
+			member[k] = v
+		}
+	}
+	req.created(member)
+}
+
+func (r *REST) updateMember(req *restRequest) {
+	_, member := r.member(req)
+	if member == nil {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	for _, k := range []string{"nick", "roles", "mute", "deaf"} {
+		if v, ok := fields[k]; ok {
+			member[k] = v
+		}
+	}
+	req.noContent()
+}
+
+func (r *REST) updateNick(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	fields := &struct {
+		Nick *string `json:"nick"`
+	}{}
+	if !req.decode(fields) {
+		return
+	}
+	guild.members[r.botID]["nick"] = fields.Nick
+	req.json(object{"nick": fields.Nick})
+}
+
+func (r *REST) kickMember(req *restRequest) {
+	guild, member := r.member(req)
+	if member == nil {
+		return
+	}
+
+	guild.removeMember(req.id("user"))
+	req.noContent()
+}
+
+func (r *REST) addMemberRole(req *restRequest) {
+	guild, member := r.member(req)
+	if member == nil || guild.role(req) == -1 {
+		return
+	}
+
+	roleID := req.id("role").String()
+	roles := member["roles"].([]interface{})
+	for _, id := range roles {
+		if id == roleID {
+			req.noContent()
+			return
+		}
+	}
+	member["roles"] = append(roles, roleID)
+	req.noContent()
+}
+
+func (r *REST) removeMemberRole(req *restRequest) {
+	guild, member := r.member(req)
+	if member == nil || guild.role(req) == -1 {
+		return
+	}
+
+	roles := []interface{}{}
+	for _, id := range member["roles"].([]interface{}) {
+		if id != req.id("role").String() {
+			roles = append(roles, id)
+		}
+	}
+	member["roles"] = roles
+	req.noContent()
+}
+
+func (r *REST) getBans(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	bans := []object{}
+	for _, ban := range guild.bans {
+		bans = append(bans, ban)
+	}
+	req.json(bans)
+}
+
+func (r *REST) getBan(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	ban, ok := guild.bans[req.id("user")]
+	if !ok {
+		req.notFound(CodeUnknownBan, "Unknown Ban")
+		return
+	}
+	req.json(ban)
+}
+
+func (r *REST) ban(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+	user := r.user(req, req.id("user"))
+	if user == nil {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	reason, _ := fields["reason"].(string)
+	if reason == "" {
+		reason = req.r.URL.Query().Get("reason")
+	}
+
+	guild.bans[req.id("user")] = object{"reason": reason, "user": user}
+	guild.removeMember(req.id("user"))
+	req.noContent()
+}
+
+func (r *REST) unban(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	if _, ok := guild.bans[req.id("user")]; !ok {
+		req.notFound(CodeUnknownBan, "Unknown Ban")
+		return
+	}
+	delete(guild.bans, req.id("user"))
+	req.noContent()
+}
+
+//////////////////////////////////////////////////////
+//
+// ROLES
+//
+//////////////////////////////////////////////////////
+
+func (r *REST) getRoles(req *restRequest) {
+	if guild := r.guild(req); guild != nil {
+		req.json(guild.roles)
+	}
+}
+
+func (r *REST) createRole(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	role := object{
+		"id":          r.newID().String(),
+		"name":        "new role",
+		"color":       0,
+		"hoist":       false,
+		"position":    len(guild.roles),
+		"permissions": 0,
+		"managed":     false,
+		"mentionable": false,
+	}
+	update(role, fields)
+	guild.roles = append(guild.roles, role)
+	req.json(role)
+}
+
+func (r *REST) updateRolePositions(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	var positions []struct {
+		ID       Snowflake `json:"id"`
+		Position int       `json:"position"`
+	}
+	if !req.decode(&positions) {
+		return
+	}
+	for _, p := range positions {
+		if i := indexOf(guild.roles, p.ID); i != -1 {
+			guild.roles[i]["position"] = p.Position
+		}
+	}
+	req.json(guild.roles)
+}
+
+func (r *REST) updateRole(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+	i := guild.role(req)
+	if i == -1 {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	update(guild.roles[i], fields)
+	req.json(guild.roles[i])
+}
+
+func (r *REST) deleteRole(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+	i := guild.role(req)
+	if i == -1 {
+		return
+	}
+
+	roleID := req.id("role").String()
+	guild.roles = append(guild.roles[:i], guild.roles[i+1:]...)
+	for _, member := range guild.members {
+		roles := []interface{}{}
+		for _, id := range member["roles"].([]interface{}) {
+			if id != roleID {
+				roles = append(roles, id)
+			}
+		}
+		member["roles"] = roles
+	}
+	req.noContent()
+}
+
+//////////////////////////////////////////////////////
+//
+// EMOJIS
+//
+//////////////////////////////////////////////////////
+
+func (r *REST) getEmojis(req *restRequest) {
+	if guild := r.guild(req); guild != nil {
+		req.json(guild.emojis)
+	}
+}
+
+func (r *REST) getEmoji(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+	if i := guild.emoji(req); i != -1 {
+		req.json(guild.emojis[i])
+	}
+}
+
+func (r *REST) createEmoji(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	if name, _ := fields["name"].(string); len(name) < 2 || len(name) > 32 {
+		req.invalidForm("name: Must be between 2 and 32 in length.")
+		return
+	}
+	if image, _ := fields["image"].(string); image == "" {
+		req.invalidForm("image: This field is required")
+		return
+	}
+
+	emoji := object{
+		"id":             r.newID().String(),
+		"name":           fields["name"],
+		"roles":          []interface{}{},
+		"user":           r.users[r.botID],
+		"require_colons": true,
+		"managed":        false,
+		"animated":       false,
+	}
+	if roles, ok := fields["roles"]; ok && roles != nil {
+		emoji["roles"] = roles
+	}
+	guild.emojis = append(guild.emojis, emoji)
+	req.created(emoji)
+}
+
+func (r *REST) updateEmoji(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+	i := guild.emoji(req)
+	if i == -1 {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	for _, k := range []string{"name", "roles"} {
+		if v, ok := fields[k]; ok {
+			guild.emojis[i][k] = v
+		}
+	}
+	req.json(guild.emojis[i])
+}
+
+func (r *REST) deleteEmoji(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+	if i := guild.emoji(req); i != -1 {
+		guild.emojis = append(guild.emojis[:i], guild.emojis[i+1:]...)
+		req.noContent()
+	}
+}
+
+//////////////////////////////////////////////////////
+//
+// INVITES
+//
+//////////////////////////////////////////////////////
+
+func (r *REST) createInvite(req *restRequest) {
+	channel := r.channel(req)
+	if channel == nil {
+		return
+	}
+	guild, ok := r.guilds[channel.guildID]
+	if !ok {
+		req.notFound(CodeUnknownChannel, "Unknown Channel")
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	invite := object{
+		"code":       randomToken(4),
+		"guild":      object{"id": guild.id.String(), "name": guild.obj["name"]},
+		"channel":    object{"id": channel.id.String(), "name": channel.obj["name"], "type": channel.obj["type"]},
+		"inviter":    r.users[r.botID],
+		"uses":       0,
+		"max_uses":   0,
+		"max_age":    86400,
+		"temporary":  false,
+		"created_at": timestamp(),
+	}
+	for _, k := range []string{"max_uses", "max_age", "temporary"} {
+		if v, ok := fields[k]; ok {
+			invite[k] = v
+		}
+	}
+	r.invites[invite["code"].(string)] = invite
+	req.json(invite)
+}
+
+func (r *REST) invitesWhere(match func(invite object) bool) []object {
+	invites := []object{}
+	for _, invite := range r.invites {
+		if match(invite) {
+			invites = append(invites, invite)
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i]["code"].(string) < invites[j]["code"].(string)
+	})
+	return invites
+}
+
+func (r *REST) getChannelInvites(req *restRequest) {
+	if channel := r.channel(req); channel != nil {
+		req.json(r.invitesWhere(func(invite object) bool {
+			return invite["channel"].(object)["id"] == channel.id.String()
+		}))
+	}
+}
+
+func (r *REST) getGuildInvites(req *restRequest) {
+	if guild := r.guild(req); guild != nil {
+		req.json(r.invitesWhere(func(invite object) bool {
+			return invite["guild"].(object)["id"] == guild.id.String()
+		}))
+	}
+}
+
+func (r *REST) getInvite(req *restRequest) {
+	invite, ok := r.invites[req.params["code"]]
+	if !ok {
+		req.notFound(CodeUnknownInvite, "Unknown Invite")
+		return
+	}
+	req.json(invite)
+}
+
+func (r *REST) deleteInvite(req *restRequest) {
+	invite, ok := r.invites[req.params["code"]]
+	if !ok {
+		req.notFound(CodeUnknownInvite, "Unknown Invite")
+		return
+	}
+	delete(r.invites, req.params["code"])
+	req.json(invite)
+}
+
+//////////////////////////////////////////////////////
+//
+// WEBHOOKS
+//
+//////////////////////////////////////////////////////
+
+func (r *REST) webhook(req *restRequest) object {
+	webhook, ok := r.webhooks[req.id("webhook")]
+	if !ok || (req.params["token"] != "" && req.params["token"] != webhook["token"]) {
+		req.notFound(CodeUnknownWebhook, "Unknown Webhook")
+		return nil
+	}
+	return webhook
+}
+
+func (r *REST) createWebhook(req *restRequest) {
+	channel := r.channel(req)
+	if channel == nil {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	if name, _ := fields["name"].(string); len(name) < 1 || len(name) > 80 {
+		req.invalidForm("name: Must be between 1 and 80 in length.")
+		return
+	}
+
+	id := r.newID()
+	webhook := object{
+		"id":         id.String(),
+		"type":       1,
+		"channel_id": channel.id.String(),
+		"user":       r.users[r.botID],
+		"name":       fields["name"],
+		"avatar":     fields["avatar"],
+		"token":      randomToken(16),
+	}
+	if !channel.guildID.IsZero() {
+		webhook["guild_id"] = channel.guildID.String()
+	}
+	r.webhooks[id] = webhook
+	req.json(webhook)
+}
+
+func (r *REST) webhooksWhere(field, id string) []object {
+	webhooks := []object{}
+	for _, webhook := range r.webhooks {
+		if webhook[field] == id {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i]["id"].(string) < webhooks[j]["id"].(string)
+	})
+	return webhooks
+}
+
+func (r *REST) getChannelWebhooks(req *restRequest) {
+	if channel := r.channel(req); channel != nil {
+		req.json(r.webhooksWhere("channel_id", channel.id.String()))
+	}
+}
+
+func (r *REST) getGuildWebhooks(req *restRequest) {
+	if guild := r.guild(req); guild != nil {
+		req.json(r.webhooksWhere("guild_id", guild.id.String()))
+	}
+}
+
+func (r *REST) getWebhook(req *restRequest) {
+	if webhook := r.webhook(req); webhook != nil {
+		req.json(webhook)
+	}
+}
+
+func (r *REST) updateWebhook(req *restRequest) {
+	webhook := r.webhook(req)
+	if webhook == nil {
+		return
+	}
+
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	for _, k := range []string{"name", "avatar"} {
+		if v, ok := fields[k]; ok {
+			webhook[k] = v
+		}
+	}
+	if channelID, ok := fields["channel_id"].(string); ok && req.params["token"] == "" {
+		if _, exists := r.channels[parseID(channelID)]; !exists {
+			req.notFound(CodeUnknownChannel, "Unknown Channel")
+			return
+		}
+		webhook["channel_id"] = channelID
+	}
+	req.json(webhook)
+}
+
+func (r *REST) deleteWebhook(req *restRequest) {
+	if webhook := r.webhook(req); webhook != nil {
+		delete(r.webhooks, req.id("webhook"))
+		req.noContent()
+	}
+}
+
+func (r *REST) executeWebhook(req *restRequest) {
+	webhook := r.webhook(req)
+	if webhook == nil {
+		return
+	}
+	channel, ok := r.channels[parseID(webhook["channel_id"].(string))]
+	if !ok {
+		req.notFound(CodeUnknownChannel, "Unknown Channel")
+		return
+	}
+
+	fields, attachments, ok := r.messageFields(req)
+	if !ok {
+		return
+	}
+	content, _ := fields["content"].(string)
+	if content == "" && fields["embeds"] == nil && len(attachments) == 0 {
+		writeError(req.w, http.StatusBadRequest, CodeEmptyMessage, "Cannot send an empty message")
+		return
+	}
+
+	username, _ := fields["username"].(string)
+	if username == "" {
+		username, _ = webhook["name"].(string)
+	}
+	author := newUserObject(parseID(webhook["id"].(string)), username, true)
+	msg := r.newMessage(channel, author, fields)
+	msg["webhook_id"] = webhook["id"]
+	if attachments != nil {
+		msg["attachments"] = attachments
+	}
+
+	if req.r.URL.Query().Get("wait") == "true" {
+		req.json(msg)
+	} else {
+		req.noContent()
+	}
+}
+
+//////////////////////////////////////////////////////
+//
+// USERS
+//
+//////////////////////////////////////////////////////
+
+func (r *REST) getCurrentUser(req *restRequest) {
+	req.json(r.users[r.botID])
+}
+
+func (r *REST) updateCurrentUser(req *restRequest) {
+	fields := object{}
+	if !req.decode(&fields) {
+		return
+	}
+	for _, k := range []string{"username", "avatar"} {
+		if v, ok := fields[k]; ok {
+			r.users[r.botID][k] = v
+		}
+	}
+	req.json(r.users[r.botID])
+}
+
+func (r *REST) getUser(req *restRequest) {
+	if user := r.user(req, req.id("user")); user != nil {
+		req.json(user)
+	}
+}
+
+func (r *REST) getCurrentUserGuilds(req *restRequest) {
+	var ids []Snowflake
+	for id, guild := range r.guilds {
+		if _, member := guild.members[r.botID]; member {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	guilds := []object{}
+	for _, id := range ids {
+		guild := r.guilds[id]
+		guilds = append(guilds, object{
+			"id":          id.String(),
+			"name":        guild.obj["name"],
+			"icon":        guild.obj["icon"],
+			"owner":       guild.obj["owner_id"] == r.botID.String(),
+			"permissions": 2147483647,
+		})
+	}
+	req.json(guilds)
+}
+
+func (r *REST) leaveGuild(req *restRequest) {
+	guild := r.guild(req)
+	if guild == nil {
+		return
+	}
+
+	guild.removeMember(r.botID)
+	req.noContent()
+}
+
+func (r *REST) createDM(req *restRequest) {
+	fields := &struct {
+		RecipientID Snowflake `json:"recipient_id"`
+	}{}
+	if !req.decode(fields) {
+		return
+	}
+	recipient := r.user(req, fields.RecipientID)
+	if recipient == nil {
+		return
+	}
+
+	for _, channel := range r.channels {
+		if channel.obj["type"] == channelDM && channel.obj["recipients"].([]interface{})[0].(object)["id"] == recipient["id"] {
+			req.json(channel.obj)
+			return
+		}
+	}
+	channel := r.createChannel(0, object{
+		"type":       channelDM,
+		"recipients": []interface{}{recipient},
+	})
+	delete(channel.obj, "name")
+	delete(channel.obj, "position")
+	delete(channel.obj, "permission_overwrites")
+	delete(channel.obj, "nsfw")
+	req.json(channel.obj)
+}
+
+func (r *REST) getConnections(req *restRequest) {
+	req.json([]object{})
+}
+
+func (r *REST) getVoiceRegions(req *restRequest) {
+	req.json([]object{
+		{"id": "europe", "name": "Europe", "vip": false, "optimal": true, "deprecated": false, "custom": false},
+		{"id": "us-east", "name": "US East", "vip": false, "optimal": false, "deprecated": false, "custom": false},
+	})
+}
@@ -0,0 +1,495 @@
+// +build !integration
+
+package disgordtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andersfylling/disgord"
+)
+
+func TestREST_Messages(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	_, channelID := fake.AddGuild("test")
+
+	ctx := context.Background()
+	for _, content := range []string{"first", "second"} {
+		msg, err := client.CreateMessage(ctx, channelID, &disgord.CreateMessageParams{Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Content != content || msg.ChannelID != channelID || msg.Author == nil || msg.Author.ID != fake.BotID() {
+			t.Errorf("expected the message to be created by the bot. Got %+v", msg)
+		}
+	}
+
+	messages, err := client.GetMessages(ctx, channelID, &disgord.GetMessagesParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Content != "second" || messages[1].Content != "first" {
+		t.Fatalf("expected the created messages, newest first. Got %+v", messages)
+	}
+
+	if err = client.DeleteMessage(ctx, channelID, messages[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.GetMessage(ctx, channelID, messages[0].ID); err == nil {
+		t.Error("expected the deleted message to be gone")
+	}
+}
+
+func TestREST_Errors(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	_, channelID := fake.AddGuild("test")
+
+	_, err := client.GetChannel(context.Background(), 140413331470024704)
+	var restErr *disgord.ErrRest
+	if !errors.As(err, &restErr) || restErr.Code != CodeUnknownChannel || restErr.HTTPCode != http.StatusNotFound {
+		t.Errorf("expected an unknown channel error. Got %v", err)
+	}
+
+	_, err = client.CreateMessage(context.Background(), channelID, &disgord.CreateMessageParams{})
+	expectRESTCode(t, err, CodeEmptyMessage)
+}
+
+func TestREST_RateLimit(t *testing.T) {
+	fake := NewREST(&RESTConfig{
+		Token:          "test",
+		RateLimit:      2,
+		RateLimitReset: time.Minute,
+	})
+	defer fake.Close()
+	_, channelID := fake.AddGuild("test")
+
+	get := func(token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, fake.URL()+"/v6/channels/"+channelID.String(), nil)
+		req.Header.Set("Authorization", "Bot "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	if resp := get("wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an invalid token to be rejected. Got %d", resp.StatusCode)
+	}
+
+	for _, remaining := range []string{"1", "0"} {
+		resp := get("test")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected the channel. Got %d", resp.StatusCode)
+		}
+		if resp.Header.Get("X-RateLimit-Limit") != "2" || resp.Header.Get("X-RateLimit-Remaining") != remaining {
+			t.Errorf("expected %s remaining requests. Got headers %v", remaining, resp.Header)
+		}
+		if resp.Header.Get("X-RateLimit-Bucket") == "" || resp.Header.Get("X-RateLimit-Reset") == "" {
+			t.Errorf("expected the bucket and reset headers. Got %v", resp.Header)
+		}
+	}
+
+	resp := get("test")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("expected the exhausted bucket to respond with 429. Got %d", resp.StatusCode)
+	}
+	if fake.Requests() != 4 {
+		t.Errorf("expected 4 requests. Got %d", fake.Requests())
+	}
+}
+
+func TestREST_Multipart(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	_, channelID := fake.AddGuild("test")
+
+	msg, err := client.CreateMessage(context.Background(), channelID, &disgord.CreateMessageParams{
+		Content: "with a file",
+		Files:   []disgord.CreateMessageFileParams{{Reader: strings.NewReader("hello"), FileName: "hello.txt"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Filename != "hello.txt" || msg.Attachments[0].Size != 5 {
+		t.Errorf("expected the file to be attached. Got %+v", msg.Attachments)
+	}
+}
+
+func expectRESTCode(t *testing.T, err error, code int) {
+	t.Helper()
+	var restErr *disgord.ErrRest
+	if !errors.As(err, &restErr) || restErr.Code != code {
+		t.Errorf("expected the error code %d. Got %v", code, err)
+	}
+}
+
+func TestREST_Guilds(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	guildID, channelID := fake.AddGuild("test")
+
+	ctx := context.Background()
+	guild, err := client.UpdateGuild(ctx, guildID).SetName("renamed").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guild.Name != "renamed" {
+		t.Errorf("expected the guild to be renamed. Got %s", guild.Name)
+	}
+	if guild, err = client.GetGuild(ctx, guildID); err != nil {
+		t.Fatal(err)
+	}
+	if guild.ID != guildID || guild.Name != "renamed" {
+		t.Errorf("expected the updated guild. Got %+v", guild)
+	}
+
+	channel, err := client.CreateGuildChannel(ctx, guildID, "second", &disgord.CreateGuildChannelParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel.GuildID != guildID || channel.Name != "second" {
+		t.Errorf("expected the channel to be created in the guild. Got %+v", channel)
+	}
+	channels, err := client.GetGuildChannels(ctx, guildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 2 || channels[0].ID != channelID || channels[1].ID != channel.ID {
+		t.Errorf("expected both channels. Got %+v", channels)
+	}
+
+	if err = client.DeleteGuild(ctx, guildID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetGuild(ctx, guildID)
+	expectRESTCode(t, err, CodeUnknownGuild)
+}
+
+func TestREST_Members(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	guildID, _ := fake.AddGuild("test")
+	userID := fake.AddUser("member")
+
+	ctx := context.Background()
+	member, err := client.AddGuildMember(ctx, guildID, userID, "oauth2", &disgord.AddGuildMemberParams{Nick: "nick"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if member.User == nil || member.User.ID != userID || member.Nick != "nick" {
+		t.Errorf("expected the member to be added. Got %+v", member)
+	}
+
+	if err = client.UpdateGuildMember(ctx, guildID, userID).SetNick("renamed").Execute(); err != nil {
+		t.Fatal(err)
+	}
+	members, err := client.GetMembers(ctx, guildID, &disgord.GetMembersParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, m := range members {
+		found = found || (m.User != nil && m.User.ID == userID && m.Nick == "renamed")
+	}
+	if !found {
+		t.Errorf("expected the renamed member in the guild. Got %+v", members)
+	}
+
+	if err = client.KickMember(ctx, guildID, userID, "test"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetMember(ctx, guildID, userID)
+	expectRESTCode(t, err, CodeUnknownMember)
+}
+
+func TestREST_Roles(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	guildID, _ := fake.AddGuild("test")
+
+	ctx := context.Background()
+	role, err := client.CreateGuildRole(ctx, guildID, &disgord.CreateGuildRoleParams{Name: "moderator", Hoist: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.Name != "moderator" || !role.Hoist {
+		t.Errorf("expected the role to be created. Got %+v", role)
+	}
+
+	botID := fake.BotID()
+	if err = client.AddGuildMemberRole(ctx, guildID, botID, role.ID); err != nil {
+		t.Fatal(err)
+	}
+	member, err := client.GetMember(ctx, guildID, botID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(member.Roles) != 1 || member.Roles[0] != role.ID {
+		t.Errorf("expected the member to have the role. Got %+v", member.Roles)
+	}
+
+	if err = client.RemoveGuildMemberRole(ctx, guildID, botID, role.ID); err != nil {
+		t.Fatal(err)
+	}
+	if member, err = client.GetMember(ctx, guildID, botID); err != nil {
+		t.Fatal(err)
+	}
+	if len(member.Roles) != 0 {
+		t.Errorf("expected the role to be removed from the member. Got %+v", member.Roles)
+	}
+
+	if err = client.DeleteGuildRole(ctx, guildID, role.ID); err != nil {
+		t.Fatal(err)
+	}
+	roles, err := client.GetGuildRoles(ctx, guildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range roles {
+		if r.ID == role.ID {
+			t.Error("expected the role to be deleted")
+		}
+	}
+	err = client.AddGuildMemberRole(ctx, guildID, botID, role.ID)
+	expectRESTCode(t, err, CodeUnknownRole)
+}
+
+func TestREST_Emojis(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	guildID, _ := fake.AddGuild("test")
+
+	ctx := context.Background()
+	emoji, err := client.CreateGuildEmoji(ctx, guildID, &disgord.CreateGuildEmojiParams{
+		Name:  "smile",
+		Image: "data:image/png;base64,iVBORw0KGgo=",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emoji.Name != "smile" || emoji.ID.IsZero() {
+		t.Errorf("expected the emoji to be created. Got %+v", emoji)
+	}
+
+	got, err := client.GetGuildEmoji(ctx, guildID, emoji.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != emoji.ID || got.Name != "smile" {
+		t.Errorf("expected the created emoji. Got %+v", got)
+	}
+	emojis, err := client.GetGuildEmojis(ctx, guildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emojis) != 1 || emojis[0].ID != emoji.ID {
+		t.Errorf("expected the guild to have the emoji. Got %+v", emojis)
+	}
+
+	if err = client.DeleteGuildEmoji(ctx, guildID, emoji.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetGuildEmoji(ctx, guildID, emoji.ID)
+	expectRESTCode(t, err, CodeUnknownEmoji)
+}
+
+func TestREST_Webhooks(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	_, channelID := fake.AddGuild("test")
+
+	ctx := context.Background()
+	webhook, err := client.CreateWebhook(ctx, channelID, &disgord.CreateWebhookParams{Name: "hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if webhook.Name != "hook" || webhook.ChannelID != channelID || webhook.Token == "" {
+		t.Errorf("expected the webhook to be created with a token. Got %+v", webhook)
+	}
+
+	msg, err := client.ExecuteWebhook(ctx, &disgord.ExecuteWebhookParams{
+		WebhookID: webhook.ID,
+		Token:     webhook.Token,
+		Content:   "from a webhook",
+	}, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg == nil || msg.Content != "from a webhook" || msg.ChannelID != channelID {
+		t.Errorf("expected the webhook to create a message. Got %+v", msg)
+	}
+	messages, err := client.GetMessages(ctx, channelID, &disgord.GetMessagesParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].ID != msg.ID {
+		t.Errorf("expected the webhook message in the channel. Got %+v", messages)
+	}
+
+	if got, err := client.GetWebhook(ctx, webhook.ID); err != nil || got.ID != webhook.ID {
+		t.Errorf("expected the webhook. Got %+v, %v", got, err)
+	}
+	if err = client.DeleteWebhook(ctx, webhook.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetWebhook(ctx, webhook.ID)
+	expectRESTCode(t, err, CodeUnknownWebhook)
+}
+
+func TestREST_Invites(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	guildID, channelID := fake.AddGuild("test")
+
+	ctx := context.Background()
+	invite, err := client.CreateChannelInvites(ctx, channelID, &disgord.CreateChannelInvitesParams{MaxUses: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invite.Code == "" || invite.MaxUses != 5 {
+		t.Errorf("expected the invite to be created. Got %+v", invite)
+	}
+
+	got, err := client.GetInvite(ctx, invite.Code, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != invite.Code || got.Guild == nil || got.Guild.ID != guildID || got.Channel == nil || got.Channel.ID != channelID {
+		t.Errorf("expected the invite to the channel. Got %+v", got)
+	}
+	invites, err := client.GetChannelInvites(ctx, channelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invites) != 1 || invites[0].Code != invite.Code {
+		t.Errorf("expected the channel to have the invite. Got %+v", invites)
+	}
+
+	if _, err = client.DeleteInvite(ctx, invite.Code); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetInvite(ctx, invite.Code, nil)
+	expectRESTCode(t, err, CodeUnknownInvite)
+}
+
+func TestREST_Pins(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	_, channelID := fake.AddGuild("test")
+
+	ctx := context.Background()
+	msg, err := client.CreateMessage(ctx, channelID, &disgord.CreateMessageParams{Content: "pin me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.PinMessageID(ctx, channelID, msg.ID); err != nil {
+		t.Fatal(err)
+	}
+	pins, err := client.GetPinnedMessages(ctx, channelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].ID != msg.ID || !pins[0].Pinned {
+		t.Errorf("expected the message to be pinned. Got %+v", pins)
+	}
+
+	if err = client.UnpinMessageID(ctx, channelID, msg.ID); err != nil {
+		t.Fatal(err)
+	}
+	if pins, err = client.GetPinnedMessages(ctx, channelID); err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 0 {
+		t.Errorf("expected the message to be unpinned. Got %+v", pins)
+	}
+}
+
+func TestREST_Reactions(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	_, channelID := fake.AddGuild("test")
+
+	ctx := context.Background()
+	msg, err := client.CreateMessage(ctx, channelID, &disgord.CreateMessageParams{Content: "react to me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateReaction(ctx, channelID, msg.ID, "👍"); err != nil {
+		t.Fatal(err)
+	}
+	users, err := client.GetReaction(ctx, channelID, msg.ID, "👍", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != fake.BotID() {
+		t.Errorf("expected the bot to have reacted. Got %+v", users)
+	}
+	if msg, err = client.GetMessage(ctx, channelID, msg.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Reactions) != 1 || msg.Reactions[0].Count != 1 || !msg.Reactions[0].Me {
+		t.Errorf("expected the message to have the reaction. Got %+v", msg.Reactions)
+	}
+
+	if err = client.DeleteOwnReaction(ctx, channelID, msg.ID, "👍"); err != nil {
+		t.Fatal(err)
+	}
+	if users, err = client.GetReaction(ctx, channelID, msg.ID, "👍", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Errorf("expected the reaction to be removed. Got %+v", users)
+	}
+}
+
+func TestREST_Bans(t *testing.T) {
+	fake := NewREST(nil)
+	defer fake.Close()
+	client := newTestClient(t, fake.HTTPClient().Transport)
+	guildID, _ := fake.AddGuild("test")
+	userID := fake.AddUser("banned")
+
+	ctx := context.Background()
+	if err := client.BanMember(ctx, guildID, userID, &disgord.BanMemberParams{Reason: "spam"}); err != nil {
+		t.Fatal(err)
+	}
+	ban, err := client.GetGuildBan(ctx, guildID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ban.User == nil || ban.User.ID != userID || ban.Reason != "spam" {
+		t.Errorf("expected the user to be banned. Got %+v", ban)
+	}
+	bans, err := client.GetGuildBans(ctx, guildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bans) != 1 {
+		t.Errorf("expected one ban. Got %+v", bans)
+	}
+
+	if err = client.UnbanMember(ctx, guildID, userID, "appealed"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetGuildBan(ctx, guildID, userID)
+	expectRESTCode(t, err, CodeUnknownBan)
+}
@@ -536,10 +536,15 @@ type GuildMemberUpdate struct {
 
 // GuildMembersChunk response to Request Guild Members
 type GuildMembersChunk struct {
-	GuildID Snowflake       `json:"guild_id"`
-	Members []*Member       `json:"members"`
-	Ctx     context.Context `json:"-"`
-	ShardID uint            `json:"-"`
+	GuildID    Snowflake         `json:"guild_id"`
+	Members    []*Member         `json:"members"`
+	ChunkIndex uint              `json:"chunk_index"`
+	ChunkCount uint              `json:"chunk_count"`
+	NotFound   []Snowflake       `json:"not_found"`
+	Presences  []*PresenceUpdate `json:"presences"`
+	Nonce      string            `json:"nonce"`
+	Ctx        context.Context   `json:"-"`
+	ShardID    uint              `json:"-"`
 }
 
 var _ internalUpdater = (*GuildMembersChunk)(nil)
@@ -702,3 +707,48 @@ type InviteCreate struct {
 	Ctx     context.Context `json:"-"`
 	ShardID uint            `json:"-"`
 }
+
+// ---------------------------
+
+// ShardConnecting a shard started connecting to the gateway
+type ShardConnecting struct {
+	Ctx     context.Context `json:"-"`
+	ShardID uint            `json:"-"`
+}
+
+// ---------------------------
+
+// ShardReady a shard received its READY event
+type ShardReady struct {
+	Ctx     context.Context `json:"-"`
+	ShardID uint            `json:"-"`
+}
+
+// ---------------------------
+
+// ShardResumed a shard resumed its session
+type ShardResumed struct {
+	Ctx     context.Context `json:"-"`
+	ShardID uint            `json:"-"`
+}
+
+// ---------------------------
+
+// ShardDisconnected a shard lost its connection to the gateway
+type ShardDisconnected struct {
+	// Code is the websocket close code, or 0 if the connection was lost without one
+	Code int `json:"code"`
+
+	Reason string `json:"reason"`
+
+	Ctx     context.Context `json:"-"`
+	ShardID uint            `json:"-"`
+}
+
+// ---------------------------
+
+// ShardZombied a shard did not receive a heartbeat ACK in time and is resuming on a new connection
+type ShardZombied struct {
+	Ctx     context.Context `json:"-"`
+	ShardID uint            `json:"-"`
+}
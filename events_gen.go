@@ -72,6 +72,16 @@ func AllEvents(except ...string) []string {
 
 		EvtResumed: 0,
 
+		EvtShardConnecting: 0,
+
+		EvtShardDisconnected: 0,
+
+		EvtShardReady: 0,
+
+		EvtShardResumed: 0,
+
+		EvtShardZombied: 0,
+
 		EvtTypingStart: 0,
 
 		EvtUserUpdate: 0,
@@ -972,6 +982,137 @@ func (c *Client) OnResumed(mdlws []Middleware, handlers []HandlerResumed, ctrl .
 
 // ---------------------------
 
+// EvtShardConnecting Sent by Disgord when a shard starts connecting to the Discord gateway. This is not a Discord event.
+const EvtShardConnecting = event.ShardConnecting
+
+func (h *ShardConnecting) registerContext(ctx context.Context) { h.Ctx = ctx }
+func (h *ShardConnecting) setShardID(id uint)                  { h.ShardID = id }
+
+type HandlerShardConnecting = func(Session, *ShardConnecting)
+
+func (c *Client) OnShardConnecting(mdlws []Middleware, handlers []HandlerShardConnecting, ctrl ...HandlerCtrl) {
+	var inputs []interface{}
+	for mdlw := range mdlws {
+		inputs = append(inputs, mdlw)
+	}
+	for handler := range handlers {
+		inputs = append(inputs, handler)
+	}
+	if len(ctrl) > 0 {
+		inputs = append(inputs, ctrl[0])
+	}
+
+	c.On(EvtShardConnecting, inputs...)
+}
+
+// ---------------------------
+
+// EvtShardDisconnected Sent by Disgord when a shard lost its connection to the Discord gateway. The shard will try to
+// reconnect unless the close code tells otherwise. This is not a Discord event.
+//  Fields:
+//  - Code   int
+//  - Reason string
+//
+const EvtShardDisconnected = event.ShardDisconnected
+
+func (h *ShardDisconnected) registerContext(ctx context.Context) { h.Ctx = ctx }
+func (h *ShardDisconnected) setShardID(id uint)                  { h.ShardID = id }
+
+type HandlerShardDisconnected = func(Session, *ShardDisconnected)
+
+func (c *Client) OnShardDisconnected(mdlws []Middleware, handlers []HandlerShardDisconnected, ctrl ...HandlerCtrl) {
+	var inputs []interface{}
+	for mdlw := range mdlws {
+		inputs = append(inputs, mdlw)
+	}
+	for handler := range handlers {
+		inputs = append(inputs, handler)
+	}
+	if len(ctrl) > 0 {
+		inputs = append(inputs, ctrl[0])
+	}
+
+	c.On(EvtShardDisconnected, inputs...)
+}
+
+// ---------------------------
+
+// EvtShardReady Sent by Disgord when a shard has identified and received its READY event. This is not a Discord event.
+const EvtShardReady = event.ShardReady
+
+func (h *ShardReady) registerContext(ctx context.Context) { h.Ctx = ctx }
+func (h *ShardReady) setShardID(id uint)                  { h.ShardID = id }
+
+type HandlerShardReady = func(Session, *ShardReady)
+
+func (c *Client) OnShardReady(mdlws []Middleware, handlers []HandlerShardReady, ctrl ...HandlerCtrl) {
+	var inputs []interface{}
+	for mdlw := range mdlws {
+		inputs = append(inputs, mdlw)
+	}
+	for handler := range handlers {
+		inputs = append(inputs, handler)
+	}
+	if len(ctrl) > 0 {
+		inputs = append(inputs, ctrl[0])
+	}
+
+	c.On(EvtShardReady, inputs...)
+}
+
+// ---------------------------
+
+// EvtShardResumed Sent by Disgord when a shard has resumed its session after a reconnect. This is not a Discord event.
+const EvtShardResumed = event.ShardResumed
+
+func (h *ShardResumed) registerContext(ctx context.Context) { h.Ctx = ctx }
+func (h *ShardResumed) setShardID(id uint)                  { h.ShardID = id }
+
+type HandlerShardResumed = func(Session, *ShardResumed)
+
+func (c *Client) OnShardResumed(mdlws []Middleware, handlers []HandlerShardResumed, ctrl ...HandlerCtrl) {
+	var inputs []interface{}
+	for mdlw := range mdlws {
+		inputs = append(inputs, mdlw)
+	}
+	for handler := range handlers {
+		inputs = append(inputs, handler)
+	}
+	if len(ctrl) > 0 {
+		inputs = append(inputs, ctrl[0])
+	}
+
+	c.On(EvtShardResumed, inputs...)
+}
+
+// ---------------------------
+
+// EvtShardZombied Sent by Disgord when Discord did not acknowledge the last heartbeat of a shard, and the shard
+// is forced to resume on a new connection. This is not a Discord event.
+const EvtShardZombied = event.ShardZombied
+
+func (h *ShardZombied) registerContext(ctx context.Context) { h.Ctx = ctx }
+func (h *ShardZombied) setShardID(id uint)                  { h.ShardID = id }
+
+type HandlerShardZombied = func(Session, *ShardZombied)
+
+func (c *Client) OnShardZombied(mdlws []Middleware, handlers []HandlerShardZombied, ctrl ...HandlerCtrl) {
+	var inputs []interface{}
+	for mdlw := range mdlws {
+		inputs = append(inputs, mdlw)
+	}
+	for handler := range handlers {
+		inputs = append(inputs, handler)
+	}
+	if len(ctrl) > 0 {
+		inputs = append(inputs, ctrl[0])
+	}
+
+	c.On(EvtShardZombied, inputs...)
+}
+
+// ---------------------------
+
 // EvtTypingStart Sent when a user starts typing in a channel.
 //  Fields:
 //  - ChannelID     Snowflake
@@ -1145,6 +1286,11 @@ type SocketHandlerRegistrators interface {
 	OnPresenceUpdate([]Middleware, []HandlerPresenceUpdate, ...HandlerCtrl)
 	OnReady([]Middleware, []HandlerReady, ...HandlerCtrl)
 	OnResumed([]Middleware, []HandlerResumed, ...HandlerCtrl)
+	OnShardConnecting([]Middleware, []HandlerShardConnecting, ...HandlerCtrl)
+	OnShardDisconnected([]Middleware, []HandlerShardDisconnected, ...HandlerCtrl)
+	OnShardReady([]Middleware, []HandlerShardReady, ...HandlerCtrl)
+	OnShardResumed([]Middleware, []HandlerShardResumed, ...HandlerCtrl)
+	OnShardZombied([]Middleware, []HandlerShardZombied, ...HandlerCtrl)
 	OnTypingStart([]Middleware, []HandlerTypingStart, ...HandlerCtrl)
 	OnUserUpdate([]Middleware, []HandlerUserUpdate, ...HandlerCtrl)
 	OnVoiceServerUpdate([]Middleware, []HandlerVoiceServerUpdate, ...HandlerCtrl)
@@ -32,6 +32,10 @@ const (
 	// ordering
 	OrderAscending // default when sorting
 	OrderDescending
+
+	// RetryNonIdempotent allows a POST or PATCH request, such as CreateMessage, to be retried by the
+	// Config.RetryPolicy. Note that the request might be handled twice by Discord.
+	RetryNonIdempotent
 )
 
 func mergeFlags(flags []Flag) (f Flag) {
@@ -17,6 +17,7 @@ func _() {
 	_ = x[SortByChannelID-64]
 	_ = x[OrderAscending-128]
 	_ = x[OrderDescending-256]
+	_ = x[RetryNonIdempotent-512]
 }
 
 const (
@@ -28,6 +29,7 @@ const (
 	_Flag_name_5 = "SortByChannelID"
 	_Flag_name_6 = "OrderAscending"
 	_Flag_name_7 = "OrderDescending"
+	_Flag_name_8 = "RetryNonIdempotent"
 )
 
 var (
@@ -53,6 +55,8 @@ func (i Flag) String() string {
 		return _Flag_name_6
 	case i == 256:
 		return _Flag_name_7
+	case i == 512:
+		return _Flag_name_8
 	default:
 		return "Flag(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
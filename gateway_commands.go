@@ -38,10 +38,12 @@ func prepareGatewayCommand(payload gatewayCmdPayload) (x gateway.CmdPayload, err
 	switch t := payload.(type) {
 	case *RequestGuildMembersPayload:
 		x = &gateway.RequestGuildMembersPayload{
-			GuildIDs: t.GuildIDs,
-			Query:    t.Query,
-			Limit:    t.Limit,
-			UserIDs:  t.UserIDs,
+			GuildIDs:  t.GuildIDs,
+			Query:     t.Query,
+			Limit:     t.Limit,
+			UserIDs:   t.UserIDs,
+			Presences: t.Presences,
+			Nonce:     t.Nonce,
 		}
 	case *UpdateVoiceStatePayload:
 		x = &gateway.UpdateVoiceStatePayload{
@@ -89,12 +91,45 @@ type RequestGuildMembersPayload struct {
 
 	// UserIDs used to specify which users you wish to fetch
 	UserIDs []Snowflake
+
+	// Presences used to specify if we want the presences of the matched members
+	Presences bool
+
+	// Nonce is returned in the GuildMembersChunk events of this request, see Client.RequestGuildMembers
+	// for a request that waits for every chunk
+	Nonce string
 }
 
 var _ gatewayCmdPayload = (*RequestGuildMembersPayload)(nil)
 
 func (r *RequestGuildMembersPayload) isGatewayCmdPayload() bool { return true }
 
+// RequestGuildMembersParams filters the members of Client.RequestGuildMembers
+type RequestGuildMembersParams struct {
+	// Query string that username starts with, or an empty string to return all members
+	Query string
+
+	// Limit maximum number of members to send or 0 to request all members matched
+	Limit uint
+
+	// UserIDs used to specify which users you wish to fetch
+	UserIDs []Snowflake
+
+	// Presences used to specify if we want the presences of the matched members
+	Presences bool
+}
+
+// GuildMembers holds every GuildMembersChunk of a Client.RequestGuildMembers call
+type GuildMembers struct {
+	Members []*Member
+
+	// NotFound holds the requested user IDs that are not members of the guild
+	NotFound []Snowflake
+
+	// Presences is only populated when requested
+	Presences []*PresenceUpdate
+}
+
 // #################################################################
 
 // UpdateVoiceStatePayload payload for socket command UPDATE_VOICE_STATE.
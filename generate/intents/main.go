@@ -9,11 +9,23 @@ import (
 	"io/ioutil"
 	"path"
 	"sort"
+	"strings"
 	"text/template"
 )
 
+// EventIntents holds the intents that enable an event
+type EventIntents struct {
+	Event   string
+	Intents []string
+}
+
+type templateData struct {
+	Intents []string
+	Events  []*EventIntents
+}
+
 func main() {
-	file, err := parser.ParseFile(token.NewFileSet(), "internal/gateway/intents.go", nil, 0)
+	file, err := parser.ParseFile(token.NewFileSet(), "internal/gateway/intents.go", nil, parser.ParseComments)
 	if err != nil {
 		panic(err)
 	}
@@ -33,16 +45,69 @@ func main() {
 	})
 
 	// And finally pass the event information to different templates to generate some files
-	makeFile(intents, "generate/intents/intents.gohtml", "intents_gen.go")
+	makeFile(&templateData{
+		Intents: intents,
+		Events:  eventIntents(file),
+	}, "generate/intents/intents.gohtml", "intents_gen.go")
+}
+
+// eventIntents finds the events listed in the doc comment of each intent, eg. "// - GUILD_CREATE"
+func eventIntents(file *ast.File) []*EventIntents {
+	events := map[string]*EventIntents{}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			value := spec.(*ast.ValueSpec)
+			if value.Doc == nil {
+				continue
+			}
+			for _, comment := range value.Doc.List {
+				name := strings.TrimPrefix(comment.Text, "// - ")
+				if name == comment.Text {
+					continue
+				}
+
+				evt := toEvtName(name)
+				if _, exists := events[evt]; !exists {
+					events[evt] = &EventIntents{Event: evt}
+				}
+				for i := range value.Names {
+					events[evt].Intents = append(events[evt].Intents, value.Names[i].Name)
+				}
+			}
+		}
+	}
+
+	var sorted []*EventIntents
+	for _, evt := range events {
+		sort.Strings(evt.Intents)
+		sorted = append(sorted, evt)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Event < sorted[j].Event
+	})
+	return sorted
+}
+
+// toEvtName converts a Discord event name to the Disgord event constant. eg. GUILD_CREATE => EvtGuildCreate
+func toEvtName(name string) string {
+	words := strings.Split(strings.ToLower(name), "_")
+	for i := range words {
+		words[i] = strings.Title(words[i])
+	}
+	return "Evt" + strings.Join(words, "")
 }
 
-func makeFile(intents []string, tplFile, target string) {
+func makeFile(data *templateData, tplFile, target string) {
 	// Open & parse our template
 	tpl := template.Must(template.New(path.Base(tplFile)).ParseFiles(tplFile))
 
 	// Execute the template, inserting all the event information
 	var b bytes.Buffer
-	if err := tpl.Execute(&b, intents); err != nil {
+	if err := tpl.Execute(&b, data); err != nil {
 		panic(err)
 	}
 
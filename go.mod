@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	github.com/andersfylling/snowflake/v4 v4.0.2
+	github.com/gorilla/websocket v1.4.2
 	github.com/json-iterator/go v1.1.9
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.1 // indirect
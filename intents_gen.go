@@ -54,3 +54,38 @@ func AllIntents(except ...gateway.Intent) gateway.Intent {
 	}
 	return intents
 }
+
+// intentsByEvent holds the intents that enable each event, where any one of them is enough.
+// Events that are not listed are sent regardless of the intents.
+var intentsByEvent = map[string]gateway.Intent{
+	EvtChannelCreate:            IntentGuilds,
+	EvtChannelDelete:            IntentGuilds,
+	EvtChannelPinsUpdate:        IntentDirectMessages | IntentGuilds,
+	EvtChannelUpdate:            IntentGuilds,
+	EvtGuildBanAdd:              IntentGuildBans,
+	EvtGuildBanRemove:           IntentGuildBans,
+	EvtGuildCreate:              IntentGuilds,
+	EvtGuildDelete:              IntentGuilds,
+	EvtGuildEmojisUpdate:        IntentGuildEmojis,
+	EvtGuildIntegrationsUpdate:  IntentGuildIntegrations,
+	EvtGuildMemberAdd:           IntentGuildMembers,
+	EvtGuildMemberRemove:        IntentGuildMembers,
+	EvtGuildMemberUpdate:        IntentGuildMembers,
+	EvtGuildRoleCreate:          IntentGuilds,
+	EvtGuildRoleDelete:          IntentGuilds,
+	EvtGuildRoleUpdate:          IntentGuilds,
+	EvtGuildUpdate:              IntentGuilds,
+	EvtInviteCreate:             IntentGuildInvites,
+	EvtInviteDelete:             IntentGuildInvites,
+	EvtMessageCreate:            IntentDirectMessages | IntentGuildMessages,
+	EvtMessageDelete:            IntentDirectMessages | IntentGuildMessages,
+	EvtMessageDeleteBulk:        IntentGuildMessages,
+	EvtMessageReactionAdd:       IntentDirectMessageReactions | IntentGuildMessageReactions,
+	EvtMessageReactionRemove:    IntentDirectMessageReactions | IntentGuildMessageReactions,
+	EvtMessageReactionRemoveAll: IntentDirectMessageReactions | IntentGuildMessageReactions,
+	EvtMessageUpdate:            IntentDirectMessages | IntentGuildMessages,
+	EvtPresenceUpdate:           IntentGuildPresences,
+	EvtTypingStart:              IntentDirectMessageTyping | IntentGuildMessageTyping,
+	EvtVoiceStateUpdate:         IntentGuildVoiceStates,
+	EvtWebhooksUpdate:           IntentGuildWebhooks,
+}
@@ -5,3 +5,6 @@ const DiscordVersion = 6
 
 // JSONEncoding the json encoding identifier
 const JSONEncoding = "json"
+
+// ETFEncoding the erlang term format encoding identifier
+const ETFEncoding = "etf"
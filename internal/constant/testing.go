@@ -17,3 +17,7 @@ const DisgordTestGuildDefaultEmojiSnowflake = "DISGORD_TEST_GUILD_DEFAULT_EMOJI_
 // DisgordTestLive set to true to properly test the functionality against
 // Discord before a release is drafted
 const DisgordTestLive = "DISGORD_TEST_LIVE"
+
+// DisgordTestCassette is the path of a cassette, where the REST calls of a test run is recorded such
+// that they can be replayed offline with disgordtest.NewReplayer. Eg. "testdata/rest.json"
+const DisgordTestCassette = "DISGORD_TEST_CASSETTE"
@@ -213,3 +213,23 @@ const WebhooksUpdate = "WEBHOOKS_UPDATE"
 //  - ApproximatePresenceCount int
 //  - ApproximateMemberCount int
 const InviteCreate = "INVITE_CREATE"
+
+// ShardConnecting Sent by Disgord when a shard starts connecting to the Discord gateway. This is not a Discord event.
+const ShardConnecting = "SHARD_CONNECTING"
+
+// ShardReady Sent by Disgord when a shard has identified and received its READY event. This is not a Discord event.
+const ShardReady = "SHARD_READY"
+
+// ShardResumed Sent by Disgord when a shard has resumed its session after a reconnect. This is not a Discord event.
+const ShardResumed = "SHARD_RESUMED"
+
+// ShardDisconnected Sent by Disgord when a shard lost its connection to the Discord gateway. The shard will try to
+// reconnect unless the close code tells otherwise. This is not a Discord event.
+//  Fields:
+//  - Code   int
+//  - Reason string
+const ShardDisconnected = "SHARD_DISCONNECTED"
+
+// ShardZombied Sent by Disgord when Discord did not acknowledge the last heartbeat of a shard, and the shard
+// is forced to resume on a new connection. This is not a Discord event.
+const ShardZombied = "SHARD_ZOMBIED"
@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/andersfylling/disgord/internal/gateway/event"
 	"github.com/andersfylling/disgord/internal/gateway/opcode"
 	"github.com/andersfylling/disgord/internal/util"
 
@@ -42,18 +43,30 @@ type Link interface {
 type connectQueue = func(shardID uint, cb func() error) error
 type connectSignature = func() (evt interface{}, err error)
 type discordErrListener = func(code int, reason string)
+type lifecycleListener = func(name string, data interface{})
 
 // newClient ...
 func newClient(shardID uint, conf *config, connect connectSignature) (c *client, err error) {
 	var ws Conn
 	if conf.conn == nil {
-		ws, err = newConn(conf.HTTPClient)
+		create := conf.newConn
+		if create == nil {
+			create = newConn
+		}
+		ws, err = create(ConnConfig{
+			ShardID:              shardID,
+			HTTPClient:           conf.HTTPClient,
+			TransportCompression: conf.transportCompression,
+		})
 		if err != nil {
 			return nil, err
 		}
 	} else {
 		ws = conf.conn
 	}
+	if conf.recorder != nil {
+		ws = conf.recorder.wrap(shardID, ws)
+	}
 
 	var queueLimit int
 	if conf.messageQueueLimit == 0 {
@@ -92,6 +105,9 @@ type config struct {
 	// for testing only
 	conn Conn
 
+	// newConn creates the websocket connection. Defaults to newConn when nil
+	newConn NewConnFunc
+
 	// Endpoint for establishing socket connection. Either endpoints, `Gateway` or `Gateway Bot`, is used to retrieve
 	// a valid socket endpoint from Discord
 	Endpoint string
@@ -102,9 +118,24 @@ type config struct {
 
 	discordErrListener discordErrListener
 
+	// lifecycleListener is notified about connection changes, see event.ShardDisconnected
+	lifecycleListener lifecycleListener
+
 	// messageQueueLimit number of outgoing messages that can be queued and sent correctly.
 	messageQueueLimit uint
 
+	// transportCompression enables zlib-stream compression for the websocket connection
+	transportCompression bool
+
+	// encoding of the gateway payloads, json or etf. Defaults to json when empty.
+	encoding string
+
+	// recorder records the traffic of the connection, when set
+	recorder *Recorder
+
+	// haltOnScalingRequired stops reconnecting after a 4011 close code, see client.resumeAfterScaling
+	haltOnScalingRequired bool
+
 	SystemShutdown chan interface{}
 }
 
@@ -120,8 +151,7 @@ type client struct {
 	conf        *config
 	lastRestart atomic.Int64 // unix nano
 
-	pulsating          uint8
-	pulseMutex         sync.Mutex
+	pulse              handover
 	heartbeatLatency   time.Duration
 	heartbeatInterval  uint
 	lastHeartbeatAck   time.Time
@@ -148,12 +178,16 @@ type client struct {
 	isConnected       atomic.Bool
 	haveConnectedOnce atomic.Bool
 	isReconnecting    atomic.Bool
-	isReceiving       atomic.Bool // has the go routine started
-	isEmitting        atomic.Bool // has the go routine started
+	receiving         handover
+	emitting          handover
 	onceChannels      onceChannels
 
 	isRestarting atomic.Bool
 
+	// metrics
+	reconnects atomic.Uint32
+	zombies    atomic.Uint32
+
 	// identify timeout on invalid session
 	// useful in unit tests when you want to drop any actual timeouts
 	timeoutMultiplier int
@@ -175,6 +209,12 @@ type client struct {
 
 	// receiver gets closed when the connection is lost
 	requestedDisconnect atomic.Bool
+
+	// keepSession closes the connection without invalidating the Discord session, when supported
+	keepSession atomic.Bool
+
+	// haltedForScaling is set when reconnecting stopped after a 4011 close code, see config.haltOnScalingRequired
+	haltedForScaling atomic.Bool
 }
 
 type behaviorActions map[interface{}]actionFunc
@@ -207,6 +247,13 @@ func (c *client) startBehaviors(ctx context.Context) {
 func (c *client) operationHandlers(ctx context.Context) {
 	c.log.Debug(c.getLogPrefix(), "Ready to receive operation codes...")
 	for {
+		// a reconnect might have happened while handling the last packet, and the
+		// packets of the new connection must be left for the new handler
+		if ctx.Err() != nil {
+			c.log.Debug(c.getLogPrefix(), "closing operations handler")
+			return
+		}
+
 		var p *DiscordPacket
 		var open bool
 		select {
@@ -233,6 +280,31 @@ func (c *client) operationHandlers(ctx context.Context) {
 	}
 }
 
+//////////////////////////////////////////////////////
+//
+// ENCODING
+//
+//////////////////////////////////////////////////////
+
+func (c *client) write(msg *clientPacket) error {
+	if c.conf.encoding != encodingETF {
+		return c.conn.WriteJSON(msg)
+	}
+
+	data, err := etfMarshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.conn.WriteBinary(data)
+}
+
+func (c *client) unmarshal(packet []byte, evt *DiscordPacket) error {
+	if c.conf.encoding != encodingETF {
+		return util.Unmarshal(packet, evt)
+	}
+	return evt.UnmarshalETF(packet)
+}
+
 func (c *client) inactivityDetector() {
 	// make sure that websocket is connecting, connect or reconnecting.
 }
@@ -266,6 +338,12 @@ func (c *client) getLogPrefix() string {
 // LINKING: CONNECTING / DISCONNECTING / RECONNECTING
 //
 //////////////////////////////////////////////////////
+func (c *client) notifyLifecycle(name string, data interface{}) {
+	if c.conf.lifecycleListener != nil {
+		c.conf.lifecycleListener(name, data)
+	}
+}
+
 func (c *client) IsDisconnected() bool {
 	return !c.isConnected.Load()
 }
@@ -282,7 +360,11 @@ func (c *client) disconnect() (err error) {
 	}
 
 	// use the emitter to dispatch the close message
-	err = c.conn.Close()
+	if keeper, ok := c.conn.(sessionKeeper); ok && c.keepSession.Load() {
+		err = keeper.CloseKeepSession()
+	} else {
+		err = c.conn.Close()
+	}
 	// a typical err here is that the pipe is closed. Err is returned later
 
 	// c.Emit(event.Close, nil)
@@ -303,14 +385,31 @@ func (c *client) Disconnect() (err error) {
 }
 
 func (c *client) reconnect() (err error) {
+	return c.restart(false)
+}
+
+// resume reconnects without invalidating the Discord session, such that the session can be resumed
+func (c *client) resume() (err error) {
+	return c.restart(true)
+}
+
+func (c *client) restart(keepSession bool) (err error) {
 	if !c.isReconnecting.CAS(false, true) {
 		return
 	}
 	c.lastRestart.Store(time.Now().UnixNano())
+	c.reconnects.Inc()
 	defer c.isReconnecting.Store(false)
 
 	c.log.Debug(c.getLogPrefix(), "is reconnecting")
-	if err := c.disconnect(); err != nil {
+	if keepSession {
+		c.keepSession.Store(true)
+	}
+	err = c.disconnect()
+	if keepSession {
+		c.keepSession.Store(false)
+	}
+	if err != nil {
 		c.log.Debug(c.getLogPrefix(), "reconnecting failed: ", err.Error())
 		c.RLock()
 		if c.requestedDisconnect.Load() {
@@ -324,6 +423,19 @@ func (c *client) reconnect() (err error) {
 	return c.reconnectLoop()
 }
 
+// resumeAfterScaling reconnects a connection that was halted by a 4011 close code, in case the
+// scaling did not replace it.
+func (c *client) resumeAfterScaling() {
+	if !c.haltedForScaling.CAS(true, false) {
+		return
+	}
+	go func() {
+		if err := c.reconnectLoop(); err != nil {
+			c.log.Error(c.getLogPrefix(), "reconnecting after scaling failed: ", err)
+		}
+	}()
+}
+
 func (c *client) reconnectLoop() (err error) {
 	var try uint
 	var delay = 3 * time.Second
@@ -383,15 +495,8 @@ func (c *client) queueRequest(command string, data CmdPayload) (err error) {
 		Data:    data,
 		CmdName: command,
 	}
-	if accepted := c.ratelimit.Request(command); !accepted {
-		// we might be rate limited.. but lets see if there is another
-		// presence update in the queue; then it can be overwritten
-		if err := c.messageQueue.AddByOverwrite(p); err != nil {
-			return errors.New("rate limited")
-		} else {
-			return nil
-		}
-	}
+
+	// the rate limit is applied once the message is sent, see the emitter
 	return c.messageQueue.Add(p)
 }
 
@@ -411,10 +516,11 @@ func (c *client) emit(command string, data interface{}) (err error) {
 // emitter holds the actually dispatching logic for sending data to the Discord Gateway.
 // client#Emit depends on this.
 func (c *client) emitter(ctx context.Context) {
-	if !c.isEmitting.CAS(false, true) {
+	release, ok := c.emitting.takeOver(ctx)
+	if !ok {
 		return
 	}
-	defer c.isEmitting.Store(false)
+	defer release()
 	c.log.Debug(c.getLogPrefix(), "starting emitter")
 
 	internal, cancel := context.WithCancel(context.Background())
@@ -425,12 +531,15 @@ func (c *client) emitter(ctx context.Context) {
 		// build tag: disgord_diagnosews
 		saveOutgoingPacket(c, msg)
 
-		if err := c.conn.WriteJSON(msg); err != nil {
+		if err := c.write(msg); err != nil {
 			once.Do(cancel)
 			return err
 		}
 		return nil
 	}
+	allowed := func(msg *clientPacket) bool {
+		return c.ratelimit.Request(msg.CmdName)
+	}
 
 	for {
 		var insight string
@@ -447,15 +556,20 @@ func (c *client) emitter(ctx context.Context) {
 			return
 		case <-time.After(300 * time.Millisecond): // TODO: don't use fixed timeout
 			if !c.messageQueue.IsEmpty() {
-				// try to write the message
+				// try to write the next message, by priority, that is not rate limited.
 				// on failure the message is put back into the queue
-				err = c.messageQueue.Try(write)
+				err = c.messageQueue.TryNext(allowed, write)
 			}
 		case msg, open := <-c.internalEmitChan:
+			// internal messages keep the connection alive and never wait for the queue. The
+			// rate limit reserves headroom for them instead.
 			if !open {
 				err = errors.New("emitter channel is closed")
-			} else if err = write(msg); err != nil {
-				insight = fmt.Sprintf("%v", *msg)
+			} else {
+				c.ratelimit.Record(msg.CmdName)
+				if err = write(msg); err != nil {
+					insight = fmt.Sprintf("%v", *msg)
+				}
 			}
 		}
 
@@ -477,10 +591,11 @@ func (c *client) receive() <-chan *DiscordPacket {
 }
 
 func (c *client) receiver(ctx context.Context) {
-	if !c.isReceiving.CAS(false, true) {
+	release, ok := c.receiving.takeOver(ctx)
+	if !ok {
 		return
 	}
-	defer c.isReceiving.Store(false)
+	defer release()
 	c.log.Debug(c.getLogPrefix(), "starting receiver")
 
 	var noopCounter int
@@ -516,11 +631,30 @@ func (c *client) receiver(ctx context.Context) {
 			reconnect := true
 			var closeErr *CloseErr
 			isCloseErr := errors.As(err, &closeErr)
-			if isCloseErr {
-				if c.conf.discordErrListener != nil && closeErr.code >= 4000 && closeErr.code < 5000 {
-					go c.conf.discordErrListener(closeErr.code, closeErr.info)
+			if ctx.Err() == nil {
+				lost := &shardDisconnected{Reason: err.Error()}
+				if isCloseErr {
+					lost.Code, lost.Reason = closeErr.code, closeErr.info
 				}
+				c.notifyLifecycle(event.ShardDisconnected, lost)
+			}
+			if isCloseErr {
 				switch closeErr.code {
+				case discordErrShardScalingRequired:
+					if !c.conf.haltOnScalingRequired {
+						break
+					}
+					// the shard is replaced by zero downtime scaling, and would only re-identify to get 4011 again
+					c.log.Info(c.getLogPrefix(), "discord requires more shards - reconnecting is halted while scaling")
+					c.haltedForScaling.Store(true)
+					_ = c.Disconnect()
+					reconnect = false
+				case 4006:
+					// Session no longer valid: the voice session can not be resumed. Should not reconnect.
+					if c.clientType != clientTypeVoice {
+						break
+					}
+					fallthrough
 				case 4014:
 					// Disconnected: Either the channel was deleted or you were kicked. Should not reconnect.
 					// https://discord.com/developers/docs/topics/opcodes-and-status-codes#voice-voice-close-event-codes
@@ -530,6 +664,9 @@ func (c *client) receiver(ctx context.Context) {
 					reconnect = false
 				default:
 				}
+				if c.conf.discordErrListener != nil && closeErr.code >= 4000 && closeErr.code < 5000 {
+					go c.conf.discordErrListener(closeErr.code, closeErr.info)
+				}
 			}
 
 			select {
@@ -548,7 +685,7 @@ func (c *client) receiver(ctx context.Context) {
 		evt := c.poolDiscordPkt.Get().(*DiscordPacket)
 		evt.reset()
 		//err = evt.UnmarshalJSON(packet) // custom unmarshal
-		if err = util.Unmarshal(packet, evt); err != nil {
+		if err = c.unmarshal(packet, evt); err != nil {
 			c.log.Error(c.getLogPrefix(), err, "SKIPPED ERRONEOUS PACKET CONTENT:", string(packet))
 			c.poolDiscordPkt.Put(evt)
 
@@ -578,35 +715,14 @@ func (c *client) receiver(ctx context.Context) {
 //
 //////////////////////////////////////////////////////
 
-// AllowedToStartPulsating you must notify when you are done pulsating!
-func (c *client) AllowedToStartPulsating(serviceID uint8) bool {
-	c.pulseMutex.Lock()
-	defer c.pulseMutex.Unlock()
-
-	if c.pulsating == 0 {
-		c.pulsating = serviceID
-	}
-
-	return c.pulsating == serviceID
-}
-
-// StopPulsating stops sending heartbeats to Discord
-func (c *client) StopPulsating(serviceID uint8) {
-	c.pulseMutex.Lock()
-	defer c.pulseMutex.Unlock()
-
-	if c.pulsating == serviceID {
-		c.pulsating = 0
-	}
-}
-
 func (c *client) prepareHeartbeating(ctx context.Context) {
-	serviceID := uint8(rand.Intn(254) + 1) // uint8 cap
-	if !c.AllowedToStartPulsating(serviceID) {
+	// the pulse of the previous connection might not have stopped yet
+	release, ok := c.pulse.takeOver(ctx)
+	if !ok {
 		c.log.Debug(c.getLogPrefix(), "tried to start an additional pulse")
 		return
 	}
-	defer c.StopPulsating(serviceID)
+	defer release()
 
 	select {
 	case <-ctx.Done():
@@ -624,6 +740,17 @@ func (c *client) pulsate(ctx context.Context) {
 	c.lastHeartbeatAck = time.Now()
 	interval := time.Millisecond * time.Duration(c.heartbeatInterval)
 	c.RUnlock()
+	c.ratelimit.SetHeartbeatInterval(interval)
+
+	// the first heartbeat is sent after a random part of the interval, as recommended by Discord,
+	// such that shards that connect at the same time do not heartbeat at the same time
+	jitter := time.Duration(rand.Float64()*float64(interval)) * time.Duration(c.timeoutMultiplier)
+	select {
+	case <-time.After(jitter):
+	case <-ctx.Done():
+		c.log.Debug(c.getLogPrefix(), "stopping pulse")
+		return
+	}
 
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -636,10 +763,13 @@ func (c *client) pulsate(ctx context.Context) {
 		lastSent = c.lastHeartbeatSent
 		c.RUnlock()
 
-		// make sure that Discord replied to the last heartbeat signal (heartbeat ack)
+		// make sure that Discord replied to the last heartbeat signal (heartbeat ack). Otherwise
+		// the connection is zombied, and Discord expects a new connection that resumes the session.
 		if lastSent.After(lastAck) {
-			c.log.Info(c.getLogPrefix(), "heartbeat ACK was not received, forcing reconnect")
-			go c.reconnect()
+			c.log.Info(c.getLogPrefix(), "heartbeat ACK was not received, resuming on a new connection")
+			c.zombies.Inc()
+			c.notifyLifecycle(event.ShardZombied, nil)
+			go c.resume()
 			break
 		} else {
 			c.log.Debug(c.getLogPrefix(), "heartbeat ACK ok")
@@ -666,6 +796,7 @@ func (c *client) pulsate(ctx context.Context) {
 				ticker.Stop()
 				interval = interval2
 				ticker = time.NewTicker(interval)
+				c.ratelimit.SetHeartbeatInterval(interval)
 			}
 			c.RUnlock()
 			continue
@@ -0,0 +1,325 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/logger"
+)
+
+// ShardCoordinator coordinates shards between several disgord processes that use the same bot token.
+// It decides which process owns which shard IDs, and makes sure only one shard identifies at a time
+// across every process such that the identify rate limit of Discord is never exceeded.
+type ShardCoordinator interface {
+	// Assign returns the total number of shards across all processes, and the shard IDs
+	// owned by this process.
+	Assign(ctx context.Context) (shardCount uint, shardIDs []uint, err error)
+
+	// Identify blocks until the shard is allowed to identify, runs cb which sends the identify
+	// packet, and then releases the identify lock for the next shard.
+	Identify(shardID uint, cb func() error) error
+}
+
+const (
+	coordinatorOpAssign   = "assign"
+	coordinatorOpIdentify = "identify"
+	coordinatorOpRelease  = "release"
+)
+
+type coordinatorRequest struct {
+	Op       string `json:"op"`
+	Instance string `json:"instance,omitempty"`
+	ShardID  uint   `json:"shard_id,omitempty"`
+}
+
+type coordinatorResponse struct {
+	Error      string `json:"error,omitempty"`
+	Granted    bool   `json:"granted,omitempty"`
+	ShardCount uint   `json:"shard_count,omitempty"`
+	ShardIDs   []uint `json:"shard_ids,omitempty"`
+}
+
+//////////////////////////////////////////////////////
+//
+// SERVER
+//
+//////////////////////////////////////////////////////
+
+// ShardCoordinatorConfig configures the reference coordinator server
+type ShardCoordinatorConfig struct {
+	// ShardCount is the total number of shards across all processes
+	ShardCount uint
+
+	// Instances holds the instance name of every disgord process sharing the shards, see
+	// NewShardCoordinatorClient. A process is given every shard ID where shardID % len(Instances)
+	// equals the index of its instance name, such that the shards of a process do not change when
+	// the coordinator or the process restarts.
+	Instances []string
+
+	// IdentifyDelay between two identify packets. Defaults to 5 seconds and 100 milliseconds.
+	IdentifyDelay time.Duration
+
+	// IdentifyTimeout is for how long a process can hold the identify lock. Defaults to 1 minute.
+	IdentifyTimeout time.Duration
+
+	Logger logger.Logger
+}
+
+// NewShardCoordinatorServer creates the reference coordinator. Use Serve to accept processes
+// over a local TCP or unix socket, and NewShardCoordinatorClient in every disgord process.
+func NewShardCoordinatorServer(conf ShardCoordinatorConfig) (*ShardCoordinatorServer, error) {
+	if conf.ShardCount == 0 {
+		return nil, errors.New("ShardCount must be set")
+	}
+	if len(conf.Instances) == 0 {
+		return nil, errors.New("Instances must be set")
+	}
+	if uint(len(conf.Instances)) > conf.ShardCount {
+		return nil, errors.New("can not have more instances than shards")
+	}
+	instances := make(map[string]uint, len(conf.Instances))
+	for i, instance := range conf.Instances {
+		if _, exists := instances[instance]; exists {
+			return nil, errors.New("instance " + instance + " is listed more than once")
+		}
+		instances[instance] = uint(i)
+	}
+	if conf.IdentifyDelay == 0 {
+		conf.IdentifyDelay = defaultShardRateLimit
+	}
+	if conf.IdentifyTimeout == 0 {
+		conf.IdentifyTimeout = time.Minute
+	}
+	if conf.Logger == nil {
+		conf.Logger = logger.Empty{}
+	}
+
+	return &ShardCoordinatorServer{
+		conf:      conf,
+		instances: instances,
+		lock:      make(chan struct{}, 1),
+		closing:   make(chan struct{}),
+	}, nil
+}
+
+type ShardCoordinatorServer struct {
+	conf ShardCoordinatorConfig
+
+	mu           sync.Mutex
+	instances    map[string]uint // instance name => index, read only
+	lastIdentify time.Time
+	listeners    []net.Listener
+
+	lock      chan struct{}
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// Serve accepts connections until the listener fails or the server is closed.
+func (s *ShardCoordinatorServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-s.closing:
+				return nil
+			default:
+				return err
+			}
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops every listener used by Serve
+func (s *ShardCoordinatorServer) Close() (err error) {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, listener := range s.listeners {
+			if e := listener.Close(); e != nil {
+				err = e
+			}
+		}
+	})
+	return err
+}
+
+func (s *ShardCoordinatorServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+
+	req := &coordinatorRequest{}
+	if err := decoder.Decode(req); err != nil {
+		s.conf.Logger.Debug("[shardCoordinator]", "invalid request", err)
+		return
+	}
+
+	switch req.Op {
+	case coordinatorOpAssign:
+		shardIDs, err := s.assign(req.Instance)
+		resp := &coordinatorResponse{ShardCount: s.conf.ShardCount, ShardIDs: shardIDs}
+		if err != nil {
+			resp = &coordinatorResponse{Error: err.Error()}
+		}
+		_ = encoder.Encode(resp)
+	case coordinatorOpIdentify:
+		s.identify(req.ShardID, conn, decoder, encoder)
+	default:
+		_ = encoder.Encode(&coordinatorResponse{Error: "unknown operation " + req.Op})
+	}
+}
+
+func (s *ShardCoordinatorServer) assign(instance string) (shardIDs []uint, err error) {
+	index, exists := s.instances[instance]
+	if !exists {
+		return nil, errors.New("unknown instance " + instance)
+	}
+
+	for id := uint(0); id < s.conf.ShardCount; id++ {
+		if id%uint(len(s.conf.Instances)) == index {
+			shardIDs = append(shardIDs, id)
+		}
+	}
+	s.conf.Logger.Info("[shardCoordinator]", "instance", instance, "owns shards", shardIDs)
+	return shardIDs, nil
+}
+
+func (s *ShardCoordinatorServer) identify(shardID uint, conn net.Conn, decoder *json.Decoder, encoder *json.Encoder) {
+	select {
+	case s.lock <- struct{}{}:
+	case <-s.closing:
+		return
+	}
+	defer func() {
+		s.mu.Lock()
+		s.lastIdentify = time.Now()
+		s.mu.Unlock()
+		<-s.lock
+	}()
+
+	s.mu.Lock()
+	wait := s.conf.IdentifyDelay - time.Since(s.lastIdentify)
+	s.mu.Unlock()
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-s.closing:
+			return
+		}
+	}
+
+	s.conf.Logger.Debug("[shardCoordinator]", "shard", shardID, "can identify")
+	if err := encoder.Encode(&coordinatorResponse{Granted: true}); err != nil {
+		return
+	}
+
+	// the lock is held until released or the process disconnects
+	_ = conn.SetReadDeadline(time.Now().Add(s.conf.IdentifyTimeout))
+	release := &coordinatorRequest{}
+	if err := decoder.Decode(release); err != nil || release.Op != coordinatorOpRelease {
+		s.conf.Logger.Info("[shardCoordinator]", "shard", shardID, "did not release the identify lock correctly")
+	}
+}
+
+//////////////////////////////////////////////////////
+//
+// CLIENT
+//
+//////////////////////////////////////////////////////
+
+// NewShardCoordinatorClient connects to a ShardCoordinatorServer, given the network ("tcp" or "unix")
+// and address. The instance name must be one of ShardCoordinatorConfig.Instances on the server, as
+// it decides which shards the process owns.
+func NewShardCoordinatorClient(network, address, instance string) ShardCoordinator {
+	return &shardCoordinatorClient{
+		network:  network,
+		address:  address,
+		instance: instance,
+	}
+}
+
+type shardCoordinatorClient struct {
+	network  string
+	address  string
+	instance string
+	dialer   net.Dialer
+}
+
+var _ ShardCoordinator = (*shardCoordinatorClient)(nil)
+
+func (c *shardCoordinatorClient) request(ctx context.Context, req *coordinatorRequest) (net.Conn, *coordinatorResponse, error) {
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err = json.NewEncoder(conn).Encode(req); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	resp := &coordinatorResponse{}
+	if err = json.NewDecoder(conn).Decode(resp); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.Error != "" {
+		conn.Close()
+		return nil, nil, errors.New("shard coordinator: " + resp.Error)
+	}
+	return conn, resp, nil
+}
+
+func (c *shardCoordinatorClient) Assign(ctx context.Context) (shardCount uint, shardIDs []uint, err error) {
+	conn, resp, err := c.request(ctx, &coordinatorRequest{
+		Op:       coordinatorOpAssign,
+		Instance: c.instance,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	conn.Close()
+
+	if len(resp.ShardIDs) == 0 {
+		return 0, nil, errors.New("shard coordinator did not assign any shards")
+	}
+	return resp.ShardCount, resp.ShardIDs, nil
+}
+
+func (c *shardCoordinatorClient) Identify(shardID uint, cb func() error) error {
+	conn, resp, err := c.request(context.Background(), &coordinatorRequest{
+		Op:      coordinatorOpIdentify,
+		ShardID: shardID,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if !resp.Granted {
+		return errors.New("shard coordinator did not grant identify")
+	}
+
+	err = cb()
+	_ = json.NewEncoder(conn).Encode(&coordinatorRequest{
+		Op:      coordinatorOpRelease,
+		ShardID: shardID,
+	})
+	return err
+}
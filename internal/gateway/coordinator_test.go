@@ -0,0 +1,155 @@
+// +build !integration
+
+package gateway
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestCoordinator(t *testing.T, conf ShardCoordinatorConfig) (*ShardCoordinatorServer, string) {
+	server, err := NewShardCoordinatorServer(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	return server, listener.Addr().String()
+}
+
+func TestShardCoordinator_Assign(t *testing.T) {
+	server, address := newTestCoordinator(t, ShardCoordinatorConfig{
+		ShardCount: 5,
+		Instances:  []string{"a", "b"},
+	})
+	defer server.Close()
+
+	ctx := context.Background()
+	a := NewShardCoordinatorClient("tcp", address, "a")
+	b := NewShardCoordinatorClient("tcp", address, "b")
+	c := NewShardCoordinatorClient("tcp", address, "c")
+
+	count, idsA, err := a.Assign(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("expected shard count 5, got %d", count)
+	}
+
+	_, idsB, err := b.Assign(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idsA)+len(idsB) != 5 {
+		t.Fatalf("every shard should be assigned. Got %v and %v", idsA, idsB)
+	}
+	for _, idA := range idsA {
+		for _, idB := range idsB {
+			if idA == idB {
+				t.Errorf("shard %d was assigned to both instances", idA)
+			}
+		}
+	}
+
+	if _, _, err = c.Assign(ctx); err == nil {
+		t.Error("expected an error for an instance that is not configured")
+	}
+
+	// reconnecting instances keeps their shards
+	_, idsA2, err := a.Assign(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idsA) != len(idsA2) || idsA[0] != idsA2[0] {
+		t.Errorf("instance was given different shards on reconnect. Got %v, wants %v", idsA2, idsA)
+	}
+
+	// restarting the coordinator keeps the shards of every instance, regardless of who connects first
+	server.Close()
+	server2, address2 := newTestCoordinator(t, ShardCoordinatorConfig{
+		ShardCount: 5,
+		Instances:  []string{"a", "b"},
+	})
+	defer server2.Close()
+
+	_, idsB2, err := NewShardCoordinatorClient("tcp", address2, "b").Assign(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idsB) != len(idsB2) || idsB[0] != idsB2[0] {
+		t.Errorf("instance was given different shards after a coordinator restart. Got %v, wants %v", idsB2, idsB)
+	}
+}
+
+func TestNewShardCoordinatorServer(t *testing.T) {
+	invalid := []ShardCoordinatorConfig{
+		{ShardCount: 2},
+		{ShardCount: 1, Instances: []string{"a", "b"}},
+		{ShardCount: 2, Instances: []string{"a", "a"}},
+	}
+	for _, conf := range invalid {
+		if _, err := NewShardCoordinatorServer(conf); err == nil {
+			t.Errorf("expected config to be invalid: %+v", conf)
+		}
+	}
+}
+
+func TestShardCoordinator_Identify(t *testing.T) {
+	delay := 50 * time.Millisecond
+	server, address := newTestCoordinator(t, ShardCoordinatorConfig{
+		ShardCount:    4,
+		Instances:     []string{"a", "b"},
+		IdentifyDelay: delay,
+	})
+	defer server.Close()
+
+	var mu sync.Mutex
+	var identifies []time.Time
+	var active int
+
+	var wg sync.WaitGroup
+	for i := uint(0); i < 4; i++ {
+		coordinator := NewShardCoordinatorClient("tcp", address, "instance")
+		wg.Add(1)
+		go func(shardID uint) {
+			defer wg.Done()
+			err := coordinator.Identify(shardID, func() error {
+				mu.Lock()
+				active++
+				if active > 1 {
+					t.Error("more than one shard identified at the same time")
+				}
+				identifies = append(identifies, time.Now())
+				mu.Unlock()
+
+				time.Sleep(5 * time.Millisecond)
+
+				mu.Lock()
+				active--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(identifies) != 4 {
+		t.Fatalf("expected 4 identifies, got %d", len(identifies))
+	}
+	for i := 1; i < len(identifies); i++ {
+		if diff := identifies[i].Sub(identifies[i-1]); diff < delay {
+			t.Errorf("identifies were only %s apart, wants at least %s", diff, delay)
+		}
+	}
+}
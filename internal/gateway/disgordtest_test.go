@@ -0,0 +1,302 @@
+// +build !integration
+
+package gateway
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andersfylling/disgord/disgordtest"
+	"github.com/andersfylling/disgord/internal/constant"
+	"github.com/andersfylling/disgord/internal/logger"
+)
+
+func newFakeGatewayShard(t *testing.T, gw *disgordtest.Gateway, newConn NewConnFunc) (*EvtClient, chan *Event, chan interface{}) {
+	eChan := make(chan *Event, 50)
+	shutdown := make(chan interface{})
+	shard, err := NewEventClient(0, &EvtConfig{
+		BotToken:       "test",
+		ShardCount:     1,
+		Endpoint:       gw.URL(),
+		Encoding:       constant.JSONEncoding,
+		Logger:         &logger.Empty{},
+		EventChan:      eChan,
+		DiscordPktPool: &sync.Pool{New: func() interface{} { return &DiscordPacket{} }},
+		SystemShutdown: shutdown,
+		NewConn:        newConn,
+		connectQueue: func(shardID uint, cb func() error) error {
+			return cb()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shard.timeoutMultiplier = 0
+
+	// the shard disconnects on shutdown, and stops any reconnect attempts
+	return shard, eChan, shutdown
+}
+
+func expectEvents(t *testing.T, eChan <-chan *Event, wants ...string) {
+	t.Helper()
+	var events []string
+	for len(events) < len(wants) {
+		select {
+		case evt := <-eChan:
+			if !strings.HasPrefix(evt.Name, "SHARD_") {
+				events = append(events, evt.Name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing events. Got %v, wants %v", events, wants)
+		}
+	}
+	for i := range wants {
+		if events[i] != wants[i] {
+			t.Fatalf("incorrect events. Got %v, wants %v", events, wants)
+		}
+	}
+}
+
+func TestFakeGateway(t *testing.T) {
+	gw := disgordtest.NewGateway(&disgordtest.GatewayConfig{
+		Token:  "test",
+		Guilds: []Snowflake{486833611564253184},
+		Script: []disgordtest.Dispatch{
+			{Name: "TYPING_START", Data: struct{}{}},
+		},
+	})
+	defer gw.Close()
+
+	shard, eChan, shutdown := newFakeGatewayShard(t, gw, nil)
+	defer close(shutdown)
+	if err := shard.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, eChan, "READY", "GUILD_CREATE", "TYPING_START")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("resume after close", func(t *testing.T) {
+		if err := gw.CloseShard(0, disgordtest.CloseGoingAway, "going away"); err != nil {
+			t.Fatal(err)
+		}
+		expectEvents(t, eChan, "RESUMED")
+		if err := gw.WaitForShard(ctx, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := gw.Dispatch(0, "MESSAGE_CREATE", struct{}{}); err != nil {
+			t.Fatal(err)
+		}
+		expectEvents(t, eChan, "MESSAGE_CREATE")
+		if gw.Identifies() != 1 || gw.Resumes() != 1 {
+			t.Errorf("expected 1 identify and 1 resume. Got %d and %d", gw.Identifies(), gw.Resumes())
+		}
+	})
+
+	t.Run("identify after invalid session", func(t *testing.T) {
+		if err := gw.InvalidateSession(0); err != nil {
+			t.Fatal(err)
+		}
+		expectEvents(t, eChan, "READY", "GUILD_CREATE", "TYPING_START")
+		if gw.Identifies() != 2 {
+			t.Errorf("expected a second identify. Got %d", gw.Identifies())
+		}
+	})
+
+	t.Run("resume on reconnect request", func(t *testing.T) {
+		if err := gw.WaitForShard(ctx, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := gw.Reconnect(0); err != nil {
+			t.Fatal(err)
+		}
+		expectEvents(t, eChan, "RESUMED")
+		if gw.Resumes() != 2 {
+			t.Errorf("expected a second resume. Got %d", gw.Resumes())
+		}
+	})
+}
+
+func TestFakeGateway_Zombied(t *testing.T) {
+	gw := disgordtest.NewGateway(&disgordtest.GatewayConfig{
+		Token:             "test",
+		HeartbeatInterval: 50 * time.Millisecond,
+	})
+	defer gw.Close()
+
+	// the first heartbeat is sent right away, as the jitter is disabled in tests
+	gw.DropHeartbeatAcks(1)
+
+	shard, eChan, shutdown := newFakeGatewayShard(t, gw, nil)
+	defer close(shutdown)
+	if err := shard.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, eChan, "READY", "RESUMED")
+
+	if gw.Identifies() != 1 || gw.Resumes() != 1 {
+		t.Errorf("expected 1 identify and 1 resume. Got %d and %d", gw.Identifies(), gw.Resumes())
+	}
+	if status := shard.Status(); status.Zombies != 1 {
+		t.Errorf("expected 1 zombied connection. Got %d", status.Zombies)
+	}
+}
+
+func TestFakeGateway_haltOnScalingRequired(t *testing.T) {
+	gw := disgordtest.NewGateway(&disgordtest.GatewayConfig{
+		Token: "test",
+	})
+	defer gw.Close()
+
+	shard, eChan, shutdown := newFakeGatewayShard(t, gw, nil)
+	defer close(shutdown)
+	shard.conf.haltOnScalingRequired = true
+	if err := shard.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, eChan, "READY")
+
+	gw.SetShardCount(2)
+	if err := gw.CloseShard(0, disgordtest.CloseShardingRequired, "sharding required"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if gw.Identifies() != 1 || gw.Resumes() != 0 {
+		t.Errorf("expected the shard to stop reconnecting. Got %d identifies and %d resumes", gw.Identifies(), gw.Resumes())
+	}
+
+	// scaling did not replace the shard
+	gw.SetShardCount(1)
+	shard.resumeAfterScaling()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := gw.WaitForShard(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+
+func newFakeGatewayShardMngr(t *testing.T, gw *disgordtest.Gateway, conf ShardConfig) (*shardMngr, chan interface{}) {
+	eChan := make(chan *Event, 100)
+	shutdown := make(chan interface{})
+	go func() {
+		for {
+			select {
+			case <-eChan:
+			case <-shutdown:
+				return
+			}
+		}
+	}()
+
+	conf.URL = gw.URL()
+	conf.Encoding = constant.JSONEncoding
+	conf.ConnectQueue = func(shardID uint, cb func() error) error {
+		return cb()
+	}
+	mngr := NewShardMngr(ShardManagerConfig{
+		ShardConfig:  conf,
+		BotToken:     "test",
+		Logger:       &logger.Empty{},
+		ShutdownChan: shutdown,
+		EventChan:    eChan,
+		RESTClient: &GatewayBotGetterMock{
+			get: func() (*GatewayBot, error) {
+				return &GatewayBot{Gateway: Gateway{URL: gw.URL()}, Shards: gw.ShardCount()}, nil
+			},
+		},
+	})
+	if err := mngr.initShards(); err != nil {
+		t.Fatal(err)
+	}
+	for _, shard := range mngr.shards {
+		shard.timeoutMultiplier = 0
+	}
+	return mngr, shutdown
+}
+
+func TestFakeGateway_scaling(t *testing.T) {
+	scale := func(t *testing.T, conf ShardConfig) (*disgordtest.Gateway, *shardMngr, func()) {
+		gw := disgordtest.NewGateway(&disgordtest.GatewayConfig{Token: "test"})
+		mngr, shutdown := newFakeGatewayShardMngr(t, gw, conf)
+		if err := mngr.Connect(); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := gw.WaitForShard(ctx, 0); err != nil {
+			t.Fatal(err)
+		}
+		gw.SetShardCount(2)
+		if err := gw.CloseShard(0, disgordtest.CloseShardingRequired, "sharding required"); err != nil {
+			t.Fatal(err)
+		}
+		return gw, mngr, func() {
+			close(shutdown)
+			gw.Close()
+		}
+	}
+
+	t.Run("auto scaling", func(t *testing.T) {
+		gw, mngr, done := scale(t, ShardConfig{ShardIDs: []uint{0}, ShardCount: 1})
+		defer done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for _, id := range []uint{0, 1} {
+			if err := gw.WaitForShard(ctx, id); err != nil {
+				t.Fatalf("expected shard %d to connect. Got %v", id, err)
+			}
+		}
+		// both shards identify with the new shard count, as the fake gateway rejects a lower one
+		for gw.Identifies() < 3 {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("expected both shards to identify. Got %d identifies", gw.Identifies())
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		if mngr.ShardCount() != 2 || len(mngr.ShardIDs()) != 2 {
+			t.Errorf("expected 2 shards. Got %d and %v", mngr.ShardCount(), mngr.ShardIDs())
+		}
+	})
+
+	t.Run("manual scaling", func(t *testing.T) {
+		gw, _, done := scale(t, ShardConfig{
+			ShardIDs:           []uint{0},
+			ShardCount:         1,
+			DisableAutoScaling: true,
+			OnScalingRequired: func(shardIDs []uint) (uint, []uint) {
+				return 2, []uint{1}
+			},
+		})
+		defer done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for _, id := range []uint{0, 1} {
+			if err := gw.WaitForShard(ctx, id); err != nil {
+				t.Fatalf("expected shard %d to connect. Got %v", id, err)
+			}
+		}
+	})
+
+	t.Run("manual scaling without OnScalingRequired", func(t *testing.T) {
+		gw, mngr, done := scale(t, ShardConfig{ShardIDs: []uint{0}, ShardCount: 1, DisableAutoScaling: true})
+		defer done()
+
+		time.Sleep(200 * time.Millisecond)
+		if gw.Identifies() != 1 {
+			t.Errorf("expected the shard to stay disconnected. Got %d identifies", gw.Identifies())
+		}
+		// the shard manager must not be locked up
+		if _, err := mngr.GetShard(0); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,695 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/andersfylling/disgord/internal/gateway/opcode"
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+// Erlang External Term Format, see http://erlang.org/doc/apps/erts/erl_ext_dist.html
+//
+// Disgord does not hold ETF data structures. Outgoing packets are marshalled to JSON and then
+// encoded as ETF, while incoming payloads are transcoded into JSON such that the event data can be
+// unmarshalled by the same logic regardless of the gateway encoding.
+//
+// ETF is therefore a compatibility option, and not a performance one: the transcoding makes it
+// slower than the JSON encoding and allocates more, see BenchmarkEvent_UnmarshalETF_largeJSON and
+// BenchmarkEvent_UnmarshalJSON_largeJSON.
+const (
+	etfVersion       byte = 131
+	etfNewFloat      byte = 70
+	etfSmallInteger  byte = 97
+	etfInteger       byte = 98
+	etfFloat         byte = 99
+	etfAtom          byte = 100
+	etfSmallTuple    byte = 104
+	etfLargeTuple    byte = 105
+	etfNil           byte = 106
+	etfString        byte = 107
+	etfList          byte = 108
+	etfBinary        byte = 109
+	etfSmallBig      byte = 110
+	etfLargeBig      byte = 111
+	etfMap           byte = 116
+	etfSmallAtom     byte = 115
+	etfAtomUTF8      byte = 118
+	etfSmallAtomUTF8 byte = 119
+)
+
+var errETFUnexpectedEnd = errors.New("etf: unexpected end of data")
+
+//////////////////////////////////////////////////////
+//
+// ENCODING
+//
+//////////////////////////////////////////////////////
+
+// etfMarshal encodes v as ETF. v is first marshalled to JSON such that json tags and custom
+// json marshalers are respected. Strings are encoded as binaries, including map keys.
+func etfMarshal(v interface{}) (data []byte, err error) {
+	var jsonData []byte
+	if jsonData, err = util.Marshal(v); err != nil {
+		return nil, err
+	}
+	return etfFromJSON(jsonData)
+}
+
+// etfFromJSON transcodes a JSON document into ETF
+func etfFromJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	e := &etfEncoder{
+		decoder: decoder,
+		buffer:  make([]byte, 0, len(data)),
+	}
+	e.buffer = append(e.buffer, etfVersion)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if err = e.value(token); err != nil {
+		return nil, err
+	}
+	return e.buffer, nil
+}
+
+type etfEncoder struct {
+	decoder *json.Decoder
+	buffer  []byte
+}
+
+func (e *etfEncoder) value(token json.Token) error {
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			return e.object()
+		case '[':
+			return e.array()
+		}
+		return fmt.Errorf("etf: unexpected json delimiter %s", t)
+	case nil:
+		e.atom("nil")
+	case bool:
+		e.atom(strconv.FormatBool(t))
+	case string:
+		e.binary(t)
+	case json.Number:
+		return e.number(t)
+	default:
+		return fmt.Errorf("etf: unsupported json token %v", t)
+	}
+	return nil
+}
+
+func (e *etfEncoder) object() error {
+	e.buffer = append(e.buffer, etfMap, 0, 0, 0, 0)
+	arityPos := len(e.buffer) - 4
+
+	var arity uint32
+	for e.decoder.More() {
+		key, err := e.decoder.Token()
+		if err != nil {
+			return err
+		}
+		e.binary(key.(string))
+
+		var token json.Token
+		if token, err = e.decoder.Token(); err != nil {
+			return err
+		}
+		if err = e.value(token); err != nil {
+			return err
+		}
+		arity++
+	}
+	binary.BigEndian.PutUint32(e.buffer[arityPos:], arity)
+
+	_, err := e.decoder.Token() // '}'
+	return err
+}
+
+func (e *etfEncoder) array() error {
+	e.buffer = append(e.buffer, etfList, 0, 0, 0, 0)
+	lengthPos := len(e.buffer) - 4
+
+	var length uint32
+	for e.decoder.More() {
+		token, err := e.decoder.Token()
+		if err != nil {
+			return err
+		}
+		if err = e.value(token); err != nil {
+			return err
+		}
+		length++
+	}
+
+	if length == 0 {
+		// an empty list is simply NIL
+		e.buffer = append(e.buffer[:lengthPos-1], etfNil)
+	} else {
+		binary.BigEndian.PutUint32(e.buffer[lengthPos:], length)
+		e.buffer = append(e.buffer, etfNil) // proper list tail
+	}
+
+	_, err := e.decoder.Token() // ']'
+	return err
+}
+
+func (e *etfEncoder) atom(name string) {
+	e.buffer = append(e.buffer, etfSmallAtomUTF8, byte(len(name)))
+	e.buffer = append(e.buffer, name...)
+}
+
+func (e *etfEncoder) binary(s string) {
+	e.buffer = append(e.buffer, etfBinary, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(e.buffer[len(e.buffer)-4:], uint32(len(s)))
+	e.buffer = append(e.buffer, s...)
+}
+
+func (e *etfEncoder) number(n json.Number) error {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		switch {
+		case i >= 0 && i <= math.MaxUint8:
+			e.buffer = append(e.buffer, etfSmallInteger, byte(i))
+		case i >= math.MinInt32 && i <= math.MaxInt32:
+			e.buffer = append(e.buffer, etfInteger, 0, 0, 0, 0)
+			binary.BigEndian.PutUint32(e.buffer[len(e.buffer)-4:], uint32(int32(i)))
+		case i < 0:
+			e.bigInt(uint64(-i), true)
+		default:
+			e.bigInt(uint64(i), false)
+		}
+		return nil
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		e.bigInt(u, false)
+		return nil
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	e.buffer = append(e.buffer, etfNewFloat, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(e.buffer[len(e.buffer)-8:], math.Float64bits(f))
+	return nil
+}
+
+func (e *etfEncoder) bigInt(magnitude uint64, negative bool) {
+	e.buffer = append(e.buffer, etfSmallBig, 0, 0)
+	nPos := len(e.buffer) - 2
+	if negative {
+		e.buffer[nPos+1] = 1
+	}
+
+	// little endian digits
+	var n byte
+	for ; magnitude > 0; magnitude >>= 8 {
+		e.buffer = append(e.buffer, byte(magnitude))
+		n++
+	}
+	e.buffer[nPos] = n
+}
+
+//////////////////////////////////////////////////////
+//
+// DECODING
+//
+//////////////////////////////////////////////////////
+
+// etfToJSON transcodes a ETF term into JSON. Note that snowflakes are integers in ETF and
+// therefore become JSON numbers, which the Snowflake type unmarshals just like JSON strings.
+func etfToJSON(data []byte) ([]byte, error) {
+	d := &etfDecoder{data: data}
+	if err := d.version(); err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.NewBuffer(make([]byte, 0, len(data)*2))
+	if err := d.term(buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+type etfDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *etfDecoder) version() error {
+	if len(d.data) == 0 || d.data[0] != etfVersion {
+		return errors.New("etf: missing version header")
+	}
+	d.pos = 1
+	return nil
+}
+
+func (d *etfDecoder) read(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, errETFUnexpectedEnd
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *etfDecoder) uint8() (uint8, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *etfDecoder) uint16() (uint16, error) {
+	b, err := d.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+func (d *etfDecoder) uint32() (uint32, error) {
+	b, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// atomName reads the name of an atom, given the atom tag has already been read
+func (d *etfDecoder) atomName(tag byte) (name []byte, err error) {
+	var length int
+	switch tag {
+	case etfAtom, etfAtomUTF8:
+		var l uint16
+		l, err = d.uint16()
+		length = int(l)
+	case etfSmallAtom, etfSmallAtomUTF8:
+		var l uint8
+		l, err = d.uint8()
+		length = int(l)
+	default:
+		return nil, fmt.Errorf("etf: tag %d is not an atom", tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.read(length)
+}
+
+func (d *etfDecoder) bigInt(tag byte) (*big.Int, error) {
+	var n int
+	if tag == etfSmallBig {
+		l, err := d.uint8()
+		if err != nil {
+			return nil, err
+		}
+		n = int(l)
+	} else {
+		l, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		n = int(l)
+	}
+
+	sign, err := d.uint8()
+	if err != nil {
+		return nil, err
+	}
+	digits, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+
+	// digits are little endian
+	bigEndian := make([]byte, n)
+	for i := range digits {
+		bigEndian[n-1-i] = digits[i]
+	}
+	i := new(big.Int).SetBytes(bigEndian)
+	if sign != 0 {
+		i.Neg(i)
+	}
+	return i, nil
+}
+
+// term transcodes the next ETF term into JSON
+func (d *etfDecoder) term(w *bytes.Buffer) (err error) {
+	var tag byte
+	if tag, err = d.uint8(); err != nil {
+		return err
+	}
+
+	switch tag {
+	case etfSmallInteger:
+		var i uint8
+		if i, err = d.uint8(); err != nil {
+			return err
+		}
+		w.WriteString(strconv.FormatUint(uint64(i), 10))
+	case etfInteger:
+		var i uint32
+		if i, err = d.uint32(); err != nil {
+			return err
+		}
+		w.WriteString(strconv.FormatInt(int64(int32(i)), 10))
+	case etfNewFloat:
+		var b []byte
+		if b, err = d.read(8); err != nil {
+			return err
+		}
+		f := math.Float64frombits(binary.BigEndian.Uint64(b))
+		w.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	case etfFloat:
+		var b []byte
+		if b, err = d.read(31); err != nil {
+			return err
+		}
+		var f float64
+		if f, err = strconv.ParseFloat(string(bytes.TrimRight(b, "\x00")), 64); err != nil {
+			return err
+		}
+		w.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	case etfSmallBig, etfLargeBig:
+		var i *big.Int
+		if i, err = d.bigInt(tag); err != nil {
+			return err
+		}
+		w.WriteString(i.String())
+	case etfAtom, etfSmallAtom, etfAtomUTF8, etfSmallAtomUTF8:
+		var name []byte
+		if name, err = d.atomName(tag); err != nil {
+			return err
+		}
+		switch string(name) {
+		case "nil", "null":
+			w.WriteString("null")
+		case "true", "false":
+			w.Write(name)
+		default:
+			writeJSONString(w, name)
+		}
+	case etfBinary:
+		var length uint32
+		if length, err = d.uint32(); err != nil {
+			return err
+		}
+		var b []byte
+		if b, err = d.read(int(length)); err != nil {
+			return err
+		}
+		writeJSONString(w, b)
+	case etfNil:
+		w.WriteString("[]")
+	case etfString:
+		// a list of small integers
+		var length uint16
+		if length, err = d.uint16(); err != nil {
+			return err
+		}
+		var b []byte
+		if b, err = d.read(int(length)); err != nil {
+			return err
+		}
+		w.WriteByte('[')
+		for i := range b {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(strconv.FormatUint(uint64(b[i]), 10))
+		}
+		w.WriteByte(']')
+	case etfList:
+		var length uint32
+		if length, err = d.uint32(); err != nil {
+			return err
+		}
+		if err = d.array(w, int(length)); err != nil {
+			return err
+		}
+		// the tail of a proper list is NIL
+		var tail byte
+		if tail, err = d.uint8(); err != nil {
+			return err
+		}
+		if tail != etfNil {
+			return errors.New("etf: improper lists are not supported")
+		}
+	case etfSmallTuple:
+		var length uint8
+		if length, err = d.uint8(); err != nil {
+			return err
+		}
+		return d.array(w, int(length))
+	case etfLargeTuple:
+		var length uint32
+		if length, err = d.uint32(); err != nil {
+			return err
+		}
+		return d.array(w, int(length))
+	case etfMap:
+		var arity uint32
+		if arity, err = d.uint32(); err != nil {
+			return err
+		}
+		w.WriteByte('{')
+		for i := uint32(0); i < arity; i++ {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err = d.key(w); err != nil {
+				return err
+			}
+			w.WriteByte(':')
+			if err = d.term(w); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('}')
+	default:
+		return fmt.Errorf("etf: unsupported tag %d", tag)
+	}
+	return nil
+}
+
+func (d *etfDecoder) array(w *bytes.Buffer, length int) error {
+	w.WriteByte('[')
+	for i := 0; i < length; i++ {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		if err := d.term(w); err != nil {
+			return err
+		}
+	}
+	w.WriteByte(']')
+	return nil
+}
+
+// key writes a map key as a JSON string
+func (d *etfDecoder) key(w *bytes.Buffer) error {
+	if d.pos >= len(d.data) {
+		return errETFUnexpectedEnd
+	}
+	switch d.data[d.pos] {
+	case etfBinary, etfAtom, etfSmallAtom, etfAtomUTF8, etfSmallAtomUTF8:
+		return d.term(w)
+	}
+
+	// numbers and other terms must be quoted to be valid JSON keys
+	var key bytes.Buffer
+	if err := d.term(&key); err != nil {
+		return err
+	}
+	writeJSONString(w, bytes.Trim(key.Bytes(), `"`))
+	return nil
+}
+
+// skip moves past the next term
+func (d *etfDecoder) skip() error {
+	var discard bytes.Buffer
+	return d.term(&discard)
+}
+
+// integer reads an integer term, or a nil atom
+func (d *etfDecoder) integer() (i int64, isNil bool, err error) {
+	var tag byte
+	if tag, err = d.uint8(); err != nil {
+		return 0, false, err
+	}
+
+	switch tag {
+	case etfSmallInteger:
+		var v uint8
+		v, err = d.uint8()
+		return int64(v), false, err
+	case etfInteger:
+		var v uint32
+		v, err = d.uint32()
+		return int64(int32(v)), false, err
+	case etfSmallBig, etfLargeBig:
+		var v *big.Int
+		if v, err = d.bigInt(tag); err != nil {
+			return 0, false, err
+		}
+		if !v.IsInt64() {
+			return 0, false, errors.New("etf: integer overflows int64")
+		}
+		return v.Int64(), false, nil
+	case etfAtom, etfSmallAtom, etfAtomUTF8, etfSmallAtomUTF8:
+		var name []byte
+		if name, err = d.atomName(tag); err != nil {
+			return 0, false, err
+		}
+		if string(name) == "nil" {
+			return 0, true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("etf: expected an integer, got tag %d", tag)
+}
+
+// string reads a binary or atom term. A nil atom gives an empty string.
+func (d *etfDecoder) string() (s string, err error) {
+	var tag byte
+	if tag, err = d.uint8(); err != nil {
+		return "", err
+	}
+
+	switch tag {
+	case etfBinary:
+		var length uint32
+		if length, err = d.uint32(); err != nil {
+			return "", err
+		}
+		var b []byte
+		if b, err = d.read(int(length)); err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case etfAtom, etfSmallAtom, etfAtomUTF8, etfSmallAtomUTF8:
+		var name []byte
+		if name, err = d.atomName(tag); err != nil {
+			return "", err
+		}
+		if string(name) == "nil" {
+			return "", nil
+		}
+		return string(name), nil
+	}
+	return "", fmt.Errorf("etf: expected a string, got tag %d", tag)
+}
+
+const jsonHex = "0123456789abcdef"
+
+func writeJSONString(w *bytes.Buffer, s []byte) {
+	w.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRune(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				w.WriteString("\ufffd")
+			} else {
+				w.Write(s[i : i+size])
+			}
+			i += size
+			continue
+		}
+
+		switch c {
+		case '"', '\\':
+			w.WriteByte('\\')
+			w.WriteByte(c)
+		case '\n':
+			w.WriteString(`\n`)
+		case '\r':
+			w.WriteString(`\r`)
+		case '\t':
+			w.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				w.WriteString(`\u00`)
+				w.WriteByte(jsonHex[c>>4])
+				w.WriteByte(jsonHex[c&0xf])
+			} else {
+				w.WriteByte(c)
+			}
+		}
+		i++
+	}
+	w.WriteByte('"')
+}
+
+// UnmarshalETF populates the packet from a ETF encoded gateway payload. The event data
+// is transcoded into JSON.
+func (p *DiscordPacket) UnmarshalETF(data []byte) (err error) {
+	d := &etfDecoder{data: data}
+	if err = d.version(); err != nil {
+		return err
+	}
+
+	var tag byte
+	if tag, err = d.uint8(); err != nil {
+		return err
+	}
+	if tag != etfMap {
+		return errors.New("etf: gateway payload must be a map")
+	}
+
+	var arity uint32
+	if arity, err = d.uint32(); err != nil {
+		return err
+	}
+	for i := uint32(0); i < arity; i++ {
+		var key string
+		if key, err = d.string(); err != nil {
+			return err
+		}
+
+		switch key {
+		case "op":
+			var op int64
+			if op, _, err = d.integer(); err != nil {
+				return err
+			}
+			p.Op = opcode.OpCode(op)
+		case "s":
+			var s int64
+			if s, _, err = d.integer(); err != nil {
+				return err
+			}
+			p.SequenceNumber = uint32(s)
+		case "t":
+			if p.EventName, err = d.string(); err != nil {
+				return err
+			}
+		case "d":
+			buffer := bytes.NewBuffer(make([]byte, 0, len(data)*2))
+			if err = d.term(buffer); err != nil {
+				return err
+			}
+			p.Data = buffer.Bytes()
+		default:
+			if err = d.skip(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+// +build !integration
+
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/andersfylling/disgord/internal/gateway/opcode"
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	var x, y interface{}
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatal(err)
+	}
+
+	xs, _ := json.Marshal(x)
+	ys, _ := json.Marshal(y)
+	return bytes.Equal(xs, ys)
+}
+
+func TestETF_transcode(t *testing.T) {
+	documents := []string{
+		`{"op":1,"d":null}`,
+		`{"a":true,"b":false,"c":[],"d":{},"e":"text with \"quotes\" and \n newline"}`,
+		`{"small":200,"int":-4000,"large":70000,"negative":-2147483648,"float":1.5}`,
+		`[1,[2,3],["four",{"five":5}]]`,
+	}
+	for _, document := range documents {
+		data, err := etfFromJSON([]byte(document))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != etfVersion {
+			t.Fatal("missing etf version header")
+		}
+
+		var result []byte
+		if result, err = etfToJSON(data); err != nil {
+			t.Fatal(err)
+		}
+		if !jsonEqual(t, []byte(document), result) {
+			t.Errorf("transcoding changed the document. Got %s, wants %s", string(result), document)
+		}
+	}
+
+	t.Run("snowflakes", func(t *testing.T) {
+		data, err := etfFromJSON([]byte(`{"id":486833041486905347}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result []byte
+		if result, err = etfToJSON(data); err != nil {
+			t.Fatal(err)
+		}
+		if wants := `{"id":486833041486905347}`; string(result) != wants {
+			t.Errorf("got %s, wants %s", string(result), wants)
+		}
+
+		var v struct {
+			ID Snowflake `json:"id"`
+		}
+		if err = util.Unmarshal(result, &v); err != nil {
+			t.Fatal(err)
+		}
+		if v.ID != 486833041486905347 {
+			t.Errorf("snowflake was not parsed correctly, got %d", v.ID)
+		}
+	})
+
+	t.Run("atoms", func(t *testing.T) {
+		// {nil, hello}
+		data := []byte{etfVersion, etfSmallTuple, 2, etfSmallAtom, 3, 'n', 'i', 'l', etfAtom, 0, 5, 'h', 'e', 'l', 'l', 'o'}
+		result, err := etfToJSON(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wants := `[null,"hello"]`; string(result) != wants {
+			t.Errorf("got %s, wants %s", string(result), wants)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		data, err := etfFromJSON([]byte(`{"content":"some text"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = etfToJSON(data[:len(data)-3]); err == nil {
+			t.Error("expected an error for truncated data")
+		}
+	})
+}
+
+func TestDiscordPacket_UnmarshalETF(t *testing.T) {
+	for _, file := range getAllJSONFiles(t) {
+		expected := DiscordPacket{}
+		if err := util.Unmarshal(file, &expected); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := etfFromJSON(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		evt := DiscordPacket{}
+		if err = evt.UnmarshalETF(data); err != nil {
+			t.Fatal(err)
+		}
+		if evt.Op != expected.Op {
+			t.Errorf("op differs. Got %d, wants %d", evt.Op, expected.Op)
+		}
+		if evt.SequenceNumber != expected.SequenceNumber {
+			t.Errorf("sequence number differs. Got %d, wants %d", evt.SequenceNumber, expected.SequenceNumber)
+		}
+		if evt.EventName != expected.EventName {
+			t.Errorf("event name differs. Got %s, wants %s", evt.EventName, expected.EventName)
+		}
+		if !jsonEqual(t, evt.Data, expected.Data) {
+			t.Errorf("event data differs for %s", expected.EventName)
+		}
+	}
+}
+
+func TestETFMarshal_clientPacket(t *testing.T) {
+	p := &clientPacket{
+		Op: opcode.EventResume,
+		Data: &evtResume{
+			Token:      "token",
+			SessionID:  "session",
+			SequenceNr: 55,
+		},
+		CmdName: "ignored",
+	}
+
+	data, err := etfMarshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result []byte
+	if result, err = etfToJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if !jsonEqual(t, result, []byte(`{"op":6,"d":{"token":"token","session_id":"session","seq":55}}`)) {
+		t.Errorf("unexpected payload %s", string(result))
+	}
+}
+
+// The ETF benchmarks are compared to the JSON benchmarks, see EvtConfig.Encoding
+
+func BenchmarkEvent_UnmarshalETF_smallJSON(b *testing.B) {
+	benchmarkUnmarshal(b, "testdata/1.json", encodingETF)
+}
+
+func BenchmarkEvent_UnmarshalETF_largeJSON(b *testing.B) {
+	benchmarkUnmarshal(b, "testdata/large.json", encodingETF)
+}
+
+func BenchmarkEvent_UnmarshalJSON_smallJSON(b *testing.B) {
+	benchmarkUnmarshal(b, "testdata/1.json", encodingJSON)
+}
+
+func BenchmarkEvent_UnmarshalJSON_largeJSON(b *testing.B) {
+	benchmarkUnmarshal(b, "testdata/large.json", encodingJSON)
+}
+
+// benchmarkUnmarshal decodes the payload like client.unmarshal does for the given encoding
+func benchmarkUnmarshal(b *testing.B, path, encoding string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	c := &client{conf: &config{encoding: encoding}}
+	if encoding == encodingETF {
+		if data, err = etfFromJSON(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		evt := DiscordPacket{}
+		if err := c.unmarshal(data, &evt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
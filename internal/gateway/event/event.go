@@ -12,6 +12,15 @@ const (
 	RequestGuildMembers = "REQUEST_GUILD_MEMBERS"
 )
 
+// shard lifecycle events dispatched by Disgord, see internal/event
+const (
+	ShardConnecting   = "SHARD_CONNECTING"
+	ShardReady        = "SHARD_READY"
+	ShardResumed      = "SHARD_RESUMED"
+	ShardDisconnected = "SHARD_DISCONNECTED"
+	ShardZombied      = "SHARD_ZOMBIED"
+)
+
 // custom events for Disgord. Don't use these.
 const (
 	Shutdown = "_"
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"runtime"
+	"strconv"
 	"sync"
 	"time"
 
@@ -42,12 +44,19 @@ func NewEventClient(shardID uint, conf *EvtConfig) (client *EvtClient, err error
 		eventChan:    eChan,
 	}
 	client.client, err = newClient(shardID, &config{
-		Logger:            conf.Logger,
-		Endpoint:          conf.Endpoint,
-		DiscordPktPool:    conf.DiscordPktPool,
-		HTTPClient:        conf.HTTPClient,
-		conn:              conf.conn,
-		messageQueueLimit: conf.MessageQueueLimit,
+		Logger:                conf.Logger,
+		Endpoint:              gatewayEndpoint(conf),
+		DiscordPktPool:        conf.DiscordPktPool,
+		HTTPClient:            conf.HTTPClient,
+		conn:                  conf.conn,
+		newConn:               conf.NewConn,
+		messageQueueLimit:     conf.MessageQueueLimit,
+		transportCompression:  conf.TransportCompression,
+		encoding:              conf.Encoding,
+		discordErrListener:    conf.discordErrListener,
+		haltOnScalingRequired: conf.haltOnScalingRequired,
+		lifecycleListener:     client.dispatchLifecycle,
+		recorder:              conf.Recorder,
 
 		SystemShutdown: conf.SystemShutdown,
 	}, client.internalConnect)
@@ -94,6 +103,9 @@ type EvtConfig struct {
 	// for testing only
 	conn Conn
 
+	// NewConn creates the websocket connection, see ShardConfig.NewConn
+	NewConn NewConnFunc
+
 	// IgnoreEvents holds a list of predetermined events that should be ignored.
 	IgnoreEvents []string
 
@@ -107,18 +119,29 @@ type EvtConfig struct {
 
 	discordErrListener discordErrListener
 
+	// haltOnScalingRequired stops the shard from reconnecting after a 4011 close code, as
+	// zero downtime scaling replaces it.
+	haltOnScalingRequired bool
+
 	Presence *UpdateStatusPayload
 
 	// Endpoint for establishing socket connection. Either endpoints, `Gateway` or `Gateway Bot`, is used to retrieve
 	// a valid socket endpoint from Discord
 	Endpoint string
 
-	// Encoding make sure we support the correct encoding
+	// Encoding of the gateway payloads, either json or etf. See ShardConfig.Encoding
 	Encoding string
 
 	// Version make sure we support the correct Discord version
 	Version int
 
+	// TransportCompression connects with compress=zlib-stream, such that every payload
+	// is compressed using one shared compression context per connection.
+	TransportCompression bool
+
+	// Recorder writes all the traffic of the connection to a recording, when set
+	Recorder *Recorder
+
 	// for identify packets
 	Browser             string
 	Device              string
@@ -143,10 +166,12 @@ type EvtClient struct {
 	ReadyCounter uint
 
 	eventChan    chan<- *Event
+	evtChanMu    sync.RWMutex
 	ignoreEvents []string
 
 	sessionID      string
 	sequenceNumber atomic.Uint32
+	lastEvent      atomic.Int64 // unix nano
 
 	rdyPool *sync.Pool
 
@@ -167,6 +192,14 @@ func (c *EvtClient) SetPresence(data interface{}) (err error) {
 	return nil
 }
 
+// setShardCount changes the shard count sent on the next identify
+func (c *EvtClient) setShardCount(shardCount uint) {
+	c.idMu.Lock()
+	c.evtConf.ShardCount = shardCount
+	c.identity.Shard = &[2]uint{c.ShardID, shardCount}
+	c.idMu.Unlock()
+}
+
 func (c *EvtClient) Emit(command string, data CmdPayload) (err error) {
 	if command == cmd.UpdateStatus {
 		if err = c.SetPresence(data); err != nil {
@@ -235,10 +268,60 @@ func (c *EvtClient) synchronizeSnr(p *DiscordPacket) (err error) {
 	return nil
 }
 
+// setEventChan changes where events are dispatched. A nil channel discards every event.
+// It blocks until any event being dispatched to the previous channel has been received.
+func (c *EvtClient) setEventChan(ch chan<- *Event) {
+	c.evtChanMu.Lock()
+	c.eventChan = ch
+	c.evtChanMu.Unlock()
+}
+
 func (c *EvtClient) virginConnection() bool {
 	return c.sessionID == "" && c.sequenceNumber.Load() == 0
 }
 
+// restoreSession loads a persisted session, such that the next connection tries to resume it
+// instead of identifying. Sessions created for a different number of shards are discarded.
+func (c *EvtClient) restoreSession(store SessionStore) error {
+	session, err := store.Load(c.ShardID)
+	if err != nil || session == nil {
+		return err
+	}
+
+	// a session can only be resumed once
+	if err = store.Delete(c.ShardID); err != nil {
+		return err
+	}
+	if session.SessionID == "" || session.ShardCount != c.evtConf.ShardCount {
+		return nil
+	}
+
+	c.Lock()
+	c.sessionID = session.SessionID
+	c.Unlock()
+	c.sequenceNumber.Store(session.SequenceNumber)
+	c.log.Info(c.getLogPrefix(), "restored session", session.SessionID, "from", session.SavedAt)
+	return nil
+}
+
+// persistSession saves the current session such that it can be resumed after a restart.
+func (c *EvtClient) persistSession(store SessionStore) error {
+	c.RLock()
+	sessionID := c.sessionID
+	c.RUnlock()
+	if sessionID == "" {
+		return nil
+	}
+
+	return store.Save(&SessionState{
+		ShardID:        c.ShardID,
+		ShardCount:     c.evtConf.ShardCount,
+		SessionID:      sessionID,
+		SequenceNumber: c.sequenceNumber.Load(),
+		SavedAt:        time.Now(),
+	})
+}
+
 func (c *EvtClient) onReady(v interface{}) (err error) {
 	p := v.(*DiscordPacket)
 
@@ -266,6 +349,7 @@ func (c *EvtClient) onDiscordEvent(v interface{}) (err error) {
 	if err = c.synchronizeSnr(p); err != nil {
 		return
 	}
+	c.lastEvent.Store(time.Now().UnixNano())
 
 	if p.EventName == event.Ready {
 		if err = c.onReady(p); err != nil {
@@ -280,20 +364,59 @@ func (c *EvtClient) onDiscordEvent(v interface{}) (err error) {
 	//	}
 	//}
 
-	if !c.eventOfInterest(p.EventName) {
-		return nil
+	if c.eventOfInterest(p.EventName) {
+		// dispatch event through out the Disgord system
+		c.dispatch(&Event{
+			Name:    p.EventName,
+			Data:    p.Data,
+			ShardID: c.ShardID,
+		})
 	}
 
-	// dispatch event through out the Disgord system
-	c.eventChan <- &Event{
-		Name:    p.EventName,
-		Data:    p.Data,
-		ShardID: c.ShardID,
+	switch p.EventName {
+	case event.Ready:
+		c.dispatchLifecycle(event.ShardReady, nil)
+	case event.Resumed:
+		c.dispatchLifecycle(event.ShardResumed, nil)
 	}
-
 	return nil
 } // end onDiscordEvent
 
+func (c *EvtClient) dispatch(evt *Event) {
+	c.evtChanMu.RLock()
+	defer c.evtChanMu.RUnlock()
+	if c.eventChan == nil {
+		return
+	}
+	c.eventChan <- evt
+}
+
+// dispatchLifecycle dispatches a synthetic event about the state of this shard
+func (c *EvtClient) dispatchLifecycle(name string, data interface{}) {
+	if !c.eventOfInterest(name) {
+		return
+	}
+	if data == nil {
+		data = struct{}{}
+	}
+	payload, err := util.Marshal(data)
+	if err != nil {
+		c.log.Error(c.getLogPrefix(), err)
+		return
+	}
+
+	c.evtChanMu.RLock()
+	defer c.evtChanMu.RUnlock()
+	if c.eventChan == nil {
+		return
+	}
+	// the dispatcher might be closed before the shards disconnect
+	select {
+	case c.eventChan <- &Event{Name: name, Data: payload, ShardID: c.ShardID}:
+	case <-c.SystemShutdown:
+	}
+}
+
 func (c *EvtClient) onHeartbeatRequest(v interface{}) error {
 	return c.sendHeartbeat(v)
 }
@@ -389,17 +512,22 @@ func (c *EvtClient) internalConnect() (evt interface{}, err error) {
 		return nil, err
 	}
 
-	var sessionCtx context.Context
-	sessionCtx, c.cancel = context.WithCancel(context.Background())
+	// disconnect might run concurrently, from the shutdown listener of the previous connection
+	sessionCtx, cancel := context.WithCancel(context.Background())
+	c.Lock()
+	c.cancel = cancel
+	c.Unlock()
+
+	c.dispatchLifecycle(event.ShardConnecting, nil)
 
 	err = c.evtConf.connectQueue(c.ShardID, func() error {
 		sentIdentifyResume := make(chan interface{})
 		c.onceChannels.Add(opcode.EventIdentify, sentIdentifyResume)
 		c.onceChannels.Add(opcode.EventResume, sentIdentifyResume)
 		defer func() {
-			// cleanup once channels
-			c.onceChannels.Acquire(opcode.EventIdentify)
-			c.onceChannels.Acquire(opcode.EventResume)
+			// cleanup once channels, unless a reconnect already replaced them
+			c.onceChannels.Release(opcode.EventIdentify, sentIdentifyResume)
+			c.onceChannels.Release(opcode.EventResume, sentIdentifyResume)
 		}()
 
 		if err := c.openConnection(sessionCtx); err != nil {
@@ -446,6 +574,27 @@ func (c *EvtClient) openConnection(ctx context.Context) error {
 	return nil
 }
 
+// gatewayEndpoint adds the gateway query string parameters to the websocket endpoint
+func gatewayEndpoint(conf *EvtConfig) string {
+	u, err := url.Parse(conf.Endpoint)
+	if err != nil || conf.Endpoint == "" {
+		return conf.Endpoint
+	}
+
+	query := u.Query()
+	if conf.Version > 0 {
+		query.Set("v", strconv.Itoa(conf.Version))
+	}
+	if conf.Encoding != "" {
+		query.Set("encoding", conf.Encoding)
+	}
+	if conf.TransportCompression {
+		query.Set("compress", "zlib-stream")
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
 func (c *EvtClient) eventOfInterest(name string) bool {
 	for i := range c.ignoreEvents {
 		if c.ignoreEvents[i] == name {
@@ -40,6 +40,11 @@ func (g *testWS) WriteJSON(v interface{}) (err error) {
 	return
 }
 
+func (g *testWS) WriteBinary(data []byte) (err error) {
+	g.writing <- data
+	return
+}
+
 func (g *testWS) Close() (err error) {
 	g.closing <- 1
 	g.isConnected.Store(false)
@@ -295,3 +300,120 @@ func TestEvtClient_communication(t *testing.T) {
 
 	<-time.After(10 * time.Millisecond)
 }
+
+// instantWS responds to identify and resume without any delay, while a cancelled Read takes a moment to
+// return. A reconnect therefore starts while the goroutines of the previous connection are still stopping.
+type instantWS struct {
+	mu       sync.Mutex
+	incoming chan []byte // payloads of the current connection
+	open     bool
+}
+
+func (g *instantWS) Open(ctx context.Context, endpoint string, requestHeader http.Header) (err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.incoming = make(chan []byte, 10)
+	g.incoming <- []byte(`{"t":null,"s":null,"op":10,"d":{"heartbeat_interval":45000}}`)
+	g.open = true
+	return nil
+}
+
+func (g *instantWS) WriteJSON(v interface{}) (err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.open {
+		return errors.New("closed")
+	}
+
+	switch v.(*clientPacket).Op {
+	case opcode.EventHeartbeat:
+		g.incoming <- []byte(`{"t":null,"s":null,"op":11,"d":null}`)
+	case opcode.EventIdentify:
+		g.incoming <- []byte(`{"t":"READY","s":1,"op":0,"d":{"session_id":"abc"}}`)
+		g.incoming <- []byte(`{"t":null,"s":null,"op":7,"d":null}`)
+	case opcode.EventResume:
+		g.incoming <- []byte(`{"t":"RESUMED","s":2,"op":0,"d":{}}`)
+	}
+	return nil
+}
+
+func (g *instantWS) WriteBinary(data []byte) (err error) {
+	return errors.New("not supported")
+}
+
+func (g *instantWS) Close() (err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.open = false
+	return nil
+}
+
+func (g *instantWS) Read(ctx context.Context) (packet []byte, err error) {
+	g.mu.Lock()
+	incoming := g.incoming
+	g.mu.Unlock()
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	select {
+	case packet = <-incoming:
+		return packet, nil
+	case <-ctx.Done():
+		time.Sleep(50 * time.Millisecond)
+		return nil, ctx.Err()
+	}
+}
+
+func (g *instantWS) Disconnected() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return !g.open
+}
+
+var _ Conn = (*instantWS)(nil)
+
+func TestEvtClient_instantReconnect(t *testing.T) {
+	eChan := make(chan *Event, 10)
+	shutdown := make(chan interface{})
+	defer close(shutdown)
+
+	m, err := NewEventClient(0, &EvtConfig{
+		Endpoint: "sfkjsdlfsf",
+		Version:  constant.DiscordVersion,
+		Encoding: constant.JSONEncoding,
+		Logger:   &logger.Empty{},
+		BotToken: "sifhsdoifhsdifhsdf",
+		DiscordPktPool: &sync.Pool{
+			New: func() interface{} {
+				return &DiscordPacket{}
+			},
+		},
+		connectQueue: func(shardID uint, cb func() error) error {
+			return cb()
+		},
+		EventChan:      eChan,
+		conn:           &instantWS{},
+		SystemShutdown: shutdown,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.timeoutMultiplier = 0
+
+	if err = m.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reconnect must resume, even though the previous receiver, emitter and pulse were still running
+	for {
+		select {
+		case evt := <-eChan:
+			if evt.Name == "RESUMED" {
+				return
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("the shard did not resume after the reconnect")
+		}
+	}
+}
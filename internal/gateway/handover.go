@@ -0,0 +1,38 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+)
+
+// handover makes sure only one goroutine of a kind runs per shard. The goroutine of a new connection
+// waits for the goroutine of the previous connection to signal that it has stopped, before it takes over.
+type handover struct {
+	mu   sync.Mutex
+	done chan struct{} // closed once the latest goroutine has stopped
+}
+
+// takeOver blocks until the previous goroutine has stopped. The returned release func must be called
+// once the new goroutine stops. False is returned if the context closes first, and the new goroutine
+// must then not run.
+func (h *handover) takeOver(ctx context.Context) (release func(), ok bool) {
+	done := make(chan struct{})
+	h.mu.Lock()
+	previous := h.done
+	h.done = done
+	h.mu.Unlock()
+
+	if previous != nil {
+		select {
+		case <-previous:
+		case <-ctx.Done():
+			// the next goroutine must still wait for the previous one
+			go func() {
+				<-previous
+				close(done)
+			}()
+			return nil, false
+		}
+	}
+	return func() { close(done) }, true
+}
@@ -0,0 +1,47 @@
+// +build !integration
+
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHandover_takeOver(t *testing.T) {
+	var h handover
+	releaseFirst, ok := h.takeOver(context.Background())
+	if !ok {
+		t.Fatal("the first goroutine should not wait")
+	}
+
+	// a cancelled goroutine does not run, and does not let the next one skip the first
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok = h.takeOver(cancelled); ok {
+		t.Error("a cancelled goroutine should not take over")
+	}
+
+	tookOver := make(chan func())
+	go func() {
+		release, ok := h.takeOver(context.Background())
+		if !ok {
+			t.Error("expected to take over once the first goroutine stopped")
+		}
+		tookOver <- release
+	}()
+
+	select {
+	case <-tookOver:
+		t.Fatal("took over before the first goroutine stopped")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	releaseFirst()
+	select {
+	case release := <-tookOver:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("did not take over after the first goroutine stopped")
+	}
+}
@@ -1,5 +1,8 @@
 package gateway
 
+// Intent subscribes the shards to groups of events. An event is sent when any of the intents listing it
+// is given, while events that are not listed by any intent are always sent. The event lists are used to
+// generate the intents required by each event, see generate/intents.
 type Intent uint64
 
 const (
@@ -35,14 +38,54 @@ const (
 	// - GUILD_INTEGRATIONS_UPDATE
 	IntentGuildIntegrations
 
+	// IntentGuildWebhooks
+	// - WEBHOOKS_UPDATE
 	IntentGuildWebhooks
+
+	// IntentGuildInvites
+	// - INVITE_CREATE
+	// - INVITE_DELETE
 	IntentGuildInvites
+
+	// IntentGuildVoiceStates
+	// - VOICE_STATE_UPDATE
 	IntentGuildVoiceStates
+
+	// IntentGuildPresences
+	// - PRESENCE_UPDATE
 	IntentGuildPresences
+
+	// IntentGuildMessages
+	// - MESSAGE_CREATE
+	// - MESSAGE_UPDATE
+	// - MESSAGE_DELETE
+	// - MESSAGE_DELETE_BULK
 	IntentGuildMessages
+
+	// IntentGuildMessageReactions
+	// - MESSAGE_REACTION_ADD
+	// - MESSAGE_REACTION_REMOVE
+	// - MESSAGE_REACTION_REMOVE_ALL
 	IntentGuildMessageReactions
+
+	// IntentGuildMessageTyping
+	// - TYPING_START
 	IntentGuildMessageTyping
+
+	// IntentDirectMessages
+	// - MESSAGE_CREATE
+	// - MESSAGE_UPDATE
+	// - MESSAGE_DELETE
+	// - CHANNEL_PINS_UPDATE
 	IntentDirectMessages
+
+	// IntentDirectMessageReactions
+	// - MESSAGE_REACTION_ADD
+	// - MESSAGE_REACTION_REMOVE
+	// - MESSAGE_REACTION_REMOVE_ALL
 	IntentDirectMessageReactions
+
+	// IntentDirectMessageTyping
+	// - TYPING_START
 	IntentDirectMessageTyping
 )
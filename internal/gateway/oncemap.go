@@ -34,3 +34,12 @@ func (o *onceChannels) Add(op opcode.OpCode, ch chan interface{}) {
 	o.channels[op] = ch
 	o.mu.Unlock()
 }
+
+// Release removes the channel unless it has been acquired or replaced
+func (o *onceChannels) Release(op opcode.OpCode, ch chan interface{}) {
+	o.mu.Lock()
+	if o.channels[op] == ch {
+		delete(o.channels, op)
+	}
+	o.mu.Unlock()
+}
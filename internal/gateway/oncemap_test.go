@@ -0,0 +1,28 @@
+// +build !integration
+
+package gateway
+
+import (
+	"testing"
+
+	"github.com/andersfylling/disgord/internal/gateway/opcode"
+)
+
+func TestOnceChannels_Release(t *testing.T) {
+	once := newOnceChannels()
+	previous, current := make(chan interface{}), make(chan interface{})
+
+	// the cleanup of a previous connection must not remove the channel of the reconnect
+	once.Add(opcode.EventResume, previous)
+	once.Add(opcode.EventResume, current)
+	once.Release(opcode.EventResume, previous)
+	if ch := once.Acquire(opcode.EventResume); ch != current {
+		t.Error("the channel of the reconnect was released")
+	}
+
+	once.Add(opcode.EventResume, current)
+	once.Release(opcode.EventResume, current)
+	if ch := once.Acquire(opcode.EventResume); ch != nil {
+		t.Error("expected the channel to be released")
+	}
+}
@@ -82,6 +82,17 @@ type VoiceSessionDescription struct {
 	SecretKey [32]byte `json:"secret_key"`
 }
 
+// VoiceSpeakingUpdate is sent when a user starts speaking, and tells which SSRC the voice packets of the user uses
+type VoiceSpeakingUpdate struct {
+	UserID Snowflake `json:"user_id"`
+	SSRC   uint32    `json:"ssrc"`
+}
+
+// VoiceClientDisconnect is sent when a user leaves the voice channel
+type VoiceClientDisconnect struct {
+	UserID Snowflake `json:"user_id"`
+}
+
 type voiceIdentify struct {
 	GuildID   Snowflake `json:"server_id"` // Yay for inconsistency
 	UserID    Snowflake `json:"user_id"`
@@ -128,6 +139,12 @@ type RequestGuildMembersPayload struct {
 
 	// UserIDs used to specify which users you wish to fetch
 	UserIDs []Snowflake `json:"user_ids,omitempty"`
+
+	// Presences used to specify if we want the presences of the matched members
+	Presences bool `json:"presences,omitempty"`
+
+	// Nonce is returned in the Guild Members Chunk events of this request
+	Nonce string `json:"nonce,omitempty"`
 }
 
 var _ CmdPayload = (*RequestGuildMembersPayload)(nil)
@@ -208,9 +225,10 @@ type GatewayBot struct {
 	Gateway
 	Shards            uint `json:"shards"`
 	SessionStartLimit struct {
-		Total      uint `json:"total"`
-		Remaining  uint `json:"remaining"`
-		ResetAfter uint `json:"reset_after"`
+		Total          uint `json:"total"`
+		Remaining      uint `json:"remaining"`
+		ResetAfter     uint `json:"reset_after"`
+		MaxConcurrency uint `json:"max_concurrency"`
 	} `json:"session_start_limit"`
 }
 
@@ -221,6 +239,11 @@ type clientPacket struct {
 	CmdName string        `json:"-"`
 }
 
+type shardDisconnected struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
 type helloPacket struct {
 	HeartbeatInterval uint `json:"heartbeat_interval"`
 }
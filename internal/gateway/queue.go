@@ -4,9 +4,37 @@ import (
 	"errors"
 	"sync"
 
+	"github.com/andersfylling/disgord/internal/gateway/cmd"
+	"github.com/andersfylling/disgord/internal/gateway/event"
 	"github.com/andersfylling/disgord/internal/gateway/opcode"
 )
 
+// priority is the lane of an outgoing message. Messages in a lane are sent before any message
+// in the lanes after it. Within a lane, the messages of a command are sent in the order they were
+// added, while a command waiting for its rate limit bucket does not hold back the other commands.
+type priority uint8
+
+const (
+	// priorityHigh keeps the connection alive; heartbeat, identify and resume
+	priorityHigh priority = iota
+	// priorityNormal changes the state of the bot; presence, voice state and speaking
+	priorityNormal
+	// priorityLow is for bulk requests such as requesting guild members
+	priorityLow
+)
+
+func packetPriority(msg *clientPacket) priority {
+	switch msg.CmdName {
+	case event.Heartbeat, event.Identify, event.Resume,
+		cmd.VoiceHeartbeat, cmd.VoiceIdentify, cmd.VoiceResume, cmd.VoiceSelectProtocol:
+		return priorityHigh
+	case cmd.RequestGuildMembers:
+		return priorityLow
+	default:
+		return priorityNormal
+	}
+}
+
 func newClientPktQueue(limit int) clientPktQueue {
 	if limit == 0 {
 		limit = -1 // no limit
@@ -16,7 +44,8 @@ func newClientPktQueue(limit int) clientPktQueue {
 	}
 }
 
-// clientPktQueue is an ordered queue. Entries are not removed unless they are successfully written to the websocket.
+// clientPktQueue is an ordered queue, sorted by priority lane. Entries are not removed unless they are successfully
+// written to the websocket.
 type clientPktQueue struct {
 	sync.RWMutex
 	messages []*clientPacket
@@ -30,6 +59,14 @@ func (c *clientPktQueue) IsEmpty() bool {
 	return len(c.messages) == 0
 }
 
+// Len returns the number of queued messages
+func (c *clientPktQueue) Len() int {
+	c.RLock()
+	defer c.RUnlock()
+
+	return len(c.messages)
+}
+
 func (c *clientPktQueue) AddByOverwrite(msg *clientPacket) error {
 	c.Lock()
 	defer c.Unlock()
@@ -56,7 +93,15 @@ func (c *clientPktQueue) Add(msg *clientPacket) error {
 		return errors.New("can not send anymore messages, queue is full")
 	}
 
-	c.messages = append(c.messages, msg)
+	// insert after the last message of the same or a higher priority
+	p := packetPriority(msg)
+	i := len(c.messages)
+	for i > 0 && packetPriority(c.messages[i-1]) > p {
+		i--
+	}
+	c.messages = append(c.messages, nil)
+	copy(c.messages[i+1:], c.messages[i:])
+	c.messages[i] = msg
 	return nil
 }
 
@@ -72,14 +117,49 @@ func (c *clientPktQueue) Try(cb func(msg *clientPacket) error) error {
 		return err
 	}
 
-	// shift to avoid re-allocations
-	for i := 0; i < len(c.messages)-1; i++ {
-		c.messages[i] = c.messages[i+1]
+	c.remove(0)
+	return nil
+}
+
+// TryNext is like Try, but skips the messages that are not allowed to be sent yet. Such that a message
+// waiting for its own rate limit bucket does not hold back the rest of the queue. A message is never
+// skipped for a later message of the same command in the same lane, see priority.
+func (c *clientPktQueue) TryNext(allowed func(msg *clientPacket) bool, cb func(msg *clientPacket) error) error {
+	c.Lock()
+	defer c.Unlock()
+
+	var blocked []*clientPacket
+	for i := range c.messages {
+		if sameLaneAndCommand(blocked, c.messages[i]) || !allowed(c.messages[i]) {
+			blocked = append(blocked, c.messages[i])
+			continue
+		}
+		if err := cb(c.messages[i]); err != nil {
+			return err
+		}
+
+		c.remove(i)
+		return nil
 	}
-	c.messages = c.messages[:len(c.messages)-1]
 	return nil
 }
 
+func sameLaneAndCommand(messages []*clientPacket, msg *clientPacket) bool {
+	for i := range messages {
+		if messages[i].CmdName == msg.CmdName && packetPriority(messages[i]) == packetPriority(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *clientPktQueue) remove(i int) {
+	// shift to avoid re-allocations
+	copy(c.messages[i:], c.messages[i+1:])
+	c.messages[len(c.messages)-1] = nil
+	c.messages = c.messages[:len(c.messages)-1]
+}
+
 func (c *clientPktQueue) Steal() (m []*clientPacket) {
 	c.Lock()
 	defer c.Unlock()
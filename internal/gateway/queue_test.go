@@ -6,6 +6,8 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/andersfylling/disgord/internal/gateway/cmd"
+	"github.com/andersfylling/disgord/internal/gateway/event"
 	"github.com/andersfylling/disgord/internal/gateway/opcode"
 )
 
@@ -127,3 +129,92 @@ func TestClientPktQueue_Try(t *testing.T) {
 		t.Error("the number of entries in the queue should reduce after Try execution")
 	}
 }
+
+func TestClientPktQueue_Priority(t *testing.T) {
+	q := newClientPktQueue(10)
+	_ = q.Add(&clientPacket{CmdName: cmd.RequestGuildMembers, Data: 1})
+	_ = q.Add(&clientPacket{CmdName: cmd.UpdateVoiceState, Data: 2})
+	_ = q.Add(&clientPacket{CmdName: cmd.RequestGuildMembers, Data: 3})
+	_ = q.Add(&clientPacket{CmdName: event.Heartbeat, Data: 4})
+	_ = q.Add(&clientPacket{CmdName: cmd.UpdateVoiceState, Data: 5})
+
+	wants := []int{4, 2, 5, 1, 3}
+	if q.Len() != len(wants) {
+		t.Fatalf("expected %d messages. Got %d", len(wants), q.Len())
+	}
+	for i := range wants {
+		if q.messages[i].Data.(int) != wants[i] {
+			t.Errorf("incorrect order at index %d. Got %v, wants %d", i, q.messages[i].Data, wants[i])
+		}
+	}
+}
+
+func TestClientPktQueue_TryNext(t *testing.T) {
+	q := newClientPktQueue(10)
+	_ = q.Add(&clientPacket{CmdName: cmd.UpdateStatus})
+	_ = q.Add(&clientPacket{CmdName: cmd.RequestGuildMembers})
+
+	notStatus := func(msg *clientPacket) bool {
+		return msg.CmdName != cmd.UpdateStatus
+	}
+	var sent string
+	write := func(msg *clientPacket) error {
+		sent = msg.CmdName
+		return nil
+	}
+
+	if err := q.TryNext(notStatus, write); err != nil {
+		t.Fatal(err)
+	}
+	if sent != cmd.RequestGuildMembers {
+		t.Errorf("expected the message behind the blocked one to be sent. Got %s", sent)
+	}
+	if q.Len() != 1 || q.messages[0].CmdName != cmd.UpdateStatus {
+		t.Error("the blocked message should remain in the queue")
+	}
+
+	if err := q.TryNext(notStatus, write); err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 1 {
+		t.Error("no message should be sent while the remaining ones are blocked")
+	}
+}
+
+func TestClientPktQueue_TryNext_order(t *testing.T) {
+	q := newClientPktQueue(10)
+	first := &clientPacket{CmdName: cmd.RequestGuildMembers}
+	second := &clientPacket{CmdName: cmd.RequestGuildMembers}
+	other := &clientPacket{CmdName: cmd.UpdateVoiceState}
+	_ = q.Add(first)
+	_ = q.Add(second)
+	_ = q.Add(other)
+
+	// only the first message is blocked, but the second must not overtake it
+	notFirst := func(msg *clientPacket) bool {
+		return msg != first
+	}
+	var sent *clientPacket
+	write := func(msg *clientPacket) error {
+		sent = msg
+		return nil
+	}
+
+	if err := q.TryNext(notFirst, write); err != nil {
+		t.Fatal(err)
+	}
+	if sent != other {
+		t.Errorf("expected the message of another lane to be sent. Got %+v", sent)
+	}
+
+	sent = nil
+	if err := q.TryNext(notFirst, write); err != nil {
+		t.Fatal(err)
+	}
+	if sent != nil {
+		t.Errorf("a message of the same command overtook the blocked one. Got %+v", sent)
+	}
+	if q.Len() != 2 || q.messages[0] != first || q.messages[1] != second {
+		t.Error("the messages of the same command should keep their order")
+	}
+}
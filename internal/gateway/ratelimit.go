@@ -57,10 +57,15 @@ func (s *UniqueStringSlice) Remove(id string) {
 	}
 }
 
+// reservedCommands is the part of the gateway rate limit that is reserved for identify, resume and heartbeats
+// requested by Discord, on top of the regular heartbeats. See ratelimiter.SetHeartbeatInterval.
+const reservedCommands = 3
+
 func newRatelimiter() ratelimiter {
 	rl := ratelimiter{
-		buckets: map[string]rlBucket{},
-		global:  newRatelimitBucket(120, 60),
+		buckets:  map[string]rlBucket{},
+		global:   newRatelimitBucket(120, 60),
+		headroom: 2 + reservedCommands, // until the heartbeat interval is known
 	}
 	rl.buckets[cmd.UpdateStatus] = newRatelimitBucket(5, 60)
 
@@ -89,8 +94,16 @@ type rlBucket struct {
 }
 
 func (b *rlBucket) Blocked() bool {
-	last := b.entries[len(b.entries)-1]
-	return time.Now().UnixNano()-last.unix <= b.duration
+	return b.BlockedWithHeadroom(0)
+}
+
+// BlockedWithHeadroom is like Blocked, but the bucket is considered full when only n requests are left
+func (b *rlBucket) BlockedWithHeadroom(n int) bool {
+	i := len(b.entries) - 1 - n
+	if i < 0 {
+		return true
+	}
+	return time.Now().UnixNano()-b.entries[i].unix <= b.duration
 }
 
 func (b *rlBucket) Insert(cmd string) {
@@ -109,25 +122,53 @@ type ratelimiter struct {
 	sync.RWMutex
 	buckets map[string]rlBucket
 	global  rlBucket
+
+	// headroom is the number of global requests that are kept free for the commands
+	// that keep the connection alive, see Record
+	headroom int
+}
+
+// SetHeartbeatInterval reserves enough of the global rate limit for the heartbeats that are sent
+// within one rate limit period.
+func (rl *ratelimiter) SetHeartbeatInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	rl.Lock()
+	defer rl.Unlock()
+
+	heartbeats := int(rl.global.duration/interval.Nanoseconds()) + 1
+	rl.headroom = heartbeats + reservedCommands
 }
 
+// Request checks if the command can be sent without exceeding the rate limit, and if so records it.
+// The headroom of the global rate limit is never given to a requested command.
 func (rl *ratelimiter) Request(command string) (accepted bool) {
 	rl.Lock()
 	defer rl.Unlock()
 
-	// global
-	if rl.global.Blocked() {
+	if rl.global.BlockedWithHeadroom(rl.headroom) {
 		return false
 	}
-	rl.global.Insert(command)
 
 	// bucket specific
-	if bucket, exists := rl.buckets[command]; exists {
-		if bucket.Blocked() {
-			return false
-		}
-		bucket.Insert(command)
+	bucket, exists := rl.buckets[command]
+	if exists && bucket.Blocked() {
+		return false
 	}
 
+	rl.global.Insert(command)
+	if exists {
+		bucket.Insert(command)
+	}
 	return true
 }
+
+// Record adds a command that is sent regardless of the rate limit, such as heartbeats, such that it is
+// accounted for in the global rate limit.
+func (rl *ratelimiter) Record(command string) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	rl.global.Insert(command)
+}
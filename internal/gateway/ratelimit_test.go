@@ -5,6 +5,9 @@ package gateway
 import (
 	"testing"
 	"time"
+
+	"github.com/andersfylling/disgord/internal/gateway/cmd"
+	"github.com/andersfylling/disgord/internal/gateway/event"
 )
 
 func TestRlBucket(t *testing.T) {
@@ -58,3 +61,45 @@ func TestRlBucket(t *testing.T) {
 
 	})
 }
+
+func TestRatelimiter_Headroom(t *testing.T) {
+	rl := newRatelimiter()
+	rl.SetHeartbeatInterval(20 * time.Second)
+	if rl.headroom != 4+reservedCommands {
+		t.Fatalf("expected headroom for 4 heartbeats. Got %d", rl.headroom)
+	}
+
+	var accepted int
+	for rl.Request(cmd.RequestGuildMembers) {
+		accepted++
+	}
+	if accepted != 120-rl.headroom {
+		t.Errorf("expected %d accepted requests. Got %d", 120-rl.headroom, accepted)
+	}
+
+	// heartbeats are still recorded without reaching the limit
+	for i := 0; i < rl.headroom; i++ {
+		rl.Record(event.Heartbeat)
+	}
+	if !rl.global.Blocked() {
+		t.Error("global rate limit should be reached")
+	}
+
+	t.Run("bucket", func(t *testing.T) {
+		rl := newRatelimiter()
+		for i := 0; i < 5; i++ {
+			if !rl.Request(cmd.UpdateStatus) {
+				t.Fatal("status update should not be rate limited yet")
+			}
+		}
+		if rl.Request(cmd.UpdateStatus) {
+			t.Error("status update should be rate limited")
+		}
+		if !rl.Request(cmd.RequestGuildMembers) {
+			t.Error("a denied status update should not count towards the global rate limit")
+		}
+		if rl.global.entries[5].cmd != cmd.UpdateStatus || rl.global.entries[6].unix != 0 {
+			t.Error("expected 6 requests in the global rate limit")
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/gateway/opcode"
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+const (
+	recordOpen     = "open"
+	recordClose    = "close"
+	recordIncoming = "in"
+	recordOutgoing = "out"
+	recordError    = "error"
+)
+
+// redactedToken replaces the bot token of IDENTIFY and RESUME payloads in recordings
+const redactedToken = "REDACTED"
+
+// Record is a single line in a gateway recording.
+type Record struct {
+	Time    time.Time `json:"time"`
+	ShardID uint      `json:"shard_id"`
+
+	// Type is one of "open", "close", "in", "out" or "error"
+	Type string `json:"type"`
+
+	// Data holds JSON payloads, while Binary holds ETF payloads
+	Data   json.RawMessage `json:"data,omitempty"`
+	Binary []byte          `json:"binary,omitempty"`
+
+	// Code and Error describes why the connection was lost
+	Code  int    `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// payload returns the recorded payload as JSON
+func (r *Record) payload() ([]byte, error) {
+	if len(r.Binary) > 0 {
+		return etfToJSON(r.Binary)
+	}
+	return r.Data, nil
+}
+
+// NewRecorder creates a Recorder that writes every gateway payload as a JSON line to w, in the order
+// they were sent or received. See NewReplay to play the recording back. The bot token of IDENTIFY and RESUME
+// payloads is replaced with "REDACTED", such that recordings can be committed.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		w: w,
+	}
+}
+
+// Recorder writes the gateway traffic of every shard into a single JSONL session file.
+type Recorder struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// Err returns the first error that occurred while writing the recording
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(record *Record) {
+	record.Time = time.Now()
+	data, err := util.Marshal(record)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if err == nil {
+		_, err = r.w.Write(append(data, '\n'))
+	}
+	r.err = err
+}
+
+func (r *Recorder) wrap(shardID uint, conn Conn) Conn {
+	return &recordingConn{
+		Conn:     conn,
+		shardID:  shardID,
+		recorder: r,
+	}
+}
+
+// recordingConn records everything that passes through the connection
+type recordingConn struct {
+	Conn
+	shardID  uint
+	recorder *Recorder
+}
+
+var _ Conn = (*recordingConn)(nil)
+
+func (c *recordingConn) Open(ctx context.Context, endpoint string, requestHeader http.Header) error {
+	if err := c.Conn.Open(ctx, endpoint, requestHeader); err != nil {
+		return err
+	}
+	c.recorder.record(&Record{ShardID: c.shardID, Type: recordOpen})
+	return nil
+}
+
+func (c *recordingConn) Close() error {
+	c.recorder.record(&Record{ShardID: c.shardID, Type: recordClose})
+	return c.Conn.Close()
+}
+
+func (c *recordingConn) CloseKeepSession() error {
+	c.recorder.record(&Record{ShardID: c.shardID, Type: recordClose})
+	if keeper, ok := c.Conn.(sessionKeeper); ok {
+		return keeper.CloseKeepSession()
+	}
+	return c.Conn.Close()
+}
+
+func (c *recordingConn) WriteJSON(v interface{}) error {
+	if data, err := util.Marshal(v); err == nil {
+		if redacted, isRedacted := redactToken(data); isRedacted {
+			data = redacted
+		}
+		c.recorder.record(&Record{ShardID: c.shardID, Type: recordOutgoing, Data: data})
+	}
+	return c.Conn.WriteJSON(v)
+}
+
+func (c *recordingConn) WriteBinary(data []byte) error {
+	recorded := data
+	if payload, err := etfToJSON(data); err == nil {
+		if redacted, isRedacted := redactToken(payload); isRedacted {
+			if recorded, err = etfFromJSON(redacted); err != nil {
+				recorded = nil // never record the token
+			}
+		}
+	}
+	c.recorder.record(&Record{ShardID: c.shardID, Type: recordOutgoing, Binary: recorded})
+	return c.Conn.WriteBinary(data)
+}
+
+// redactToken replaces the bot token of IDENTIFY and RESUME payloads, such that recordings can be committed.
+// The JSON payload is returned unchanged, with false, for any other operation.
+func redactToken(payload []byte) ([]byte, bool) {
+	var packet map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &packet); err != nil {
+		return payload, false
+	}
+
+	var op opcode.OpCode
+	if err := json.Unmarshal(packet["op"], &op); err != nil {
+		return payload, false
+	}
+	if op != opcode.EventIdentify && op != opcode.EventResume {
+		return payload, false
+	}
+
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(packet["d"], &data); err != nil || data["token"] == nil {
+		return payload, false
+	}
+	data["token"], _ = json.Marshal(redactedToken)
+	packet["d"], _ = json.Marshal(data)
+
+	redacted, err := json.Marshal(packet)
+	if err != nil {
+		return nil, true
+	}
+	return redacted, true
+}
+
+func (c *recordingConn) Read(ctx context.Context) (packet []byte, err error) {
+	packet, err = c.Conn.Read(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			record := &Record{ShardID: c.shardID, Type: recordError, Error: err.Error()}
+			var closeErr *CloseErr
+			if errors.As(err, &closeErr) {
+				record.Code, record.Error = closeErr.code, closeErr.info
+			}
+			c.recorder.record(record)
+		}
+		return packet, err
+	}
+
+	record := &Record{ShardID: c.shardID, Type: recordIncoming}
+	if json.Valid(packet) {
+		record.Data = packet
+	} else {
+		record.Binary = packet
+	}
+	c.recorder.record(record)
+	return packet, nil
+}
@@ -0,0 +1,61 @@
+// +build !integration
+
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/andersfylling/disgord/internal/gateway/opcode"
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+func TestRecorder_RedactsToken(t *testing.T) {
+	const token = "NzkyNzE1NDU0MTk2MDg4ODQy.X-hvzA.Ovy4MCQywSkoMRRclStW4xAYK7I"
+
+	var recording bytes.Buffer
+	conn := NewRecorder(&recording).wrap(0, &testWS{writing: make(chan interface{}, 10)})
+
+	packets := []*clientPacket{
+		{Op: opcode.EventIdentify, Data: &evtIdentity{Token: token, Shard: &[2]uint{0, 1}}},
+		{Op: opcode.EventResume, Data: &evtResume{Token: token, SessionID: "session", SequenceNr: 4}},
+		{Op: opcode.EventHeartbeat, Data: 4},
+	}
+	for _, p := range packets {
+		if err := conn.WriteJSON(p); err != nil {
+			t.Fatal(err)
+		}
+		data, err := etfMarshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = conn.WriteBinary(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var records int
+	scanner := bufio.NewScanner(bytes.NewReader(recording.Bytes()))
+	for scanner.Scan() {
+		record := &Record{}
+		if err := util.Unmarshal(scanner.Bytes(), record); err != nil {
+			t.Fatal(err)
+		}
+		payload, err := record.payload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(payload), token) {
+			t.Errorf("the bot token was recorded: %s", payload)
+		}
+		if records < 4 && !strings.Contains(string(payload), redactedToken) {
+			t.Errorf("expected the token to be replaced. Got %s", payload)
+		}
+		records++
+	}
+	if records != 2*len(packets) {
+		t.Errorf("expected %d records. Got %d", 2*len(packets), records)
+	}
+}
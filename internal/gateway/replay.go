@@ -0,0 +1,283 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/constant"
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+// replayEndpoint replaces the gateway URL when a recording is replayed
+const replayEndpoint = "replay://gateway"
+
+// NewReplay loads a recording created by a Recorder. Use ShardConfig.Replay to play it through the
+// shards instead of connecting to Discord, which lets the whole client run offline against real traffic.
+//
+// The recorded payloads are returned as fast as they are read, and a shard only receives the
+// payloads of the next connection once it reconnects.
+func NewReplay(r io.Reader) (*Replay, error) {
+	replay := &Replay{
+		shards:   map[uint]*replayConn{},
+		encoding: constant.JSONEncoding,
+		done:     make(chan struct{}),
+	}
+
+	decoder := json.NewDecoder(r)
+	for {
+		record := &Record{}
+		if err := decoder.Decode(record); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		conn, ok := replay.shards[record.ShardID]
+		if !ok {
+			conn = &replayConn{done: make(chan struct{})}
+			replay.shards[record.ShardID] = conn
+		}
+		conn.records = append(conn.records, record)
+
+		if record.Type == recordIncoming && len(record.Binary) > 0 {
+			replay.encoding = constant.ETFEncoding
+		}
+		if record.Type == recordOutgoing && replay.shardCount == 0 {
+			replay.shardCount = identifiedShardCount(record)
+		}
+	}
+	if len(replay.shards) == 0 {
+		return nil, errors.New("recording is empty")
+	}
+
+	var wg sync.WaitGroup
+	for _, conn := range replay.shards {
+		wg.Add(1)
+		go func(done <-chan struct{}) {
+			<-done
+			wg.Done()
+		}(conn.done)
+		conn.mu.Lock()
+		conn.checkExhausted()
+		conn.mu.Unlock()
+	}
+	go func() {
+		wg.Wait()
+		close(replay.done)
+	}()
+
+	return replay, nil
+}
+
+// identifiedShardCount returns the shard count sent in an identify packet, or 0
+func identifiedShardCount(record *Record) uint {
+	data, err := record.payload()
+	if err != nil {
+		return 0
+	}
+
+	identify := struct {
+		Op   uint `json:"op"`
+		Data struct {
+			Shard [2]uint `json:"shard"`
+		} `json:"d"`
+	}{}
+	if err = util.Unmarshal(data, &identify); err != nil || identify.Op != 2 {
+		return 0
+	}
+	return identify.Data.Shard[1]
+}
+
+// Replay plays back a gateway recording, see NewReplay
+type Replay struct {
+	shards     map[uint]*replayConn
+	shardCount uint
+	encoding   string
+	done       chan struct{}
+}
+
+// ShardIDs returns the recorded shard IDs
+func (r *Replay) ShardIDs() (shardIDs []uint) {
+	for id := range r.shards {
+		shardIDs = append(shardIDs, id)
+	}
+	sort.Slice(shardIDs, func(i, j int) bool {
+		return shardIDs[i] < shardIDs[j]
+	})
+	return shardIDs
+}
+
+// Done is closed once every recorded payload has been read by the shards. Note that the last
+// events might still be processing.
+func (r *Replay) Done() <-chan struct{} {
+	return r.done
+}
+
+// Conn returns the connection that replays the recording of the given shard
+func (r *Replay) Conn(shardID uint) Conn {
+	if conn, ok := r.shards[shardID]; ok {
+		return conn
+	}
+
+	// shard without any traffic
+	conn := &replayConn{done: make(chan struct{})}
+	close(conn.done)
+	return conn
+}
+
+func (r *Replay) configure(conf *ShardConfig) {
+	if len(conf.ShardIDs) == 0 {
+		conf.ShardIDs = r.ShardIDs()
+	}
+	if conf.ShardCount == 0 {
+		conf.ShardCount = r.shardCount
+	}
+	for _, id := range conf.ShardIDs {
+		if id >= conf.ShardCount {
+			conf.ShardCount = id + 1
+		}
+	}
+
+	conf.URL = replayEndpoint
+	conf.Encoding = r.encoding
+	conf.TransportCompression = false
+	conf.DisableAutoScaling = true
+	conf.SessionStore = nil
+
+	if conf.IdentifiesPer24H == 0 {
+		conf.IdentifiesPer24H = DefaultIdentifyRateLimit
+	}
+	if conf.ShardRateLimit == 0 {
+		// there is no rate limit to respect
+		conf.ShardRateLimit = time.Millisecond
+	}
+	if conf.MaxConcurrency == 0 {
+		conf.MaxConcurrency = 1
+	}
+}
+
+// replayConn returns the incoming payloads of one shard. Every recorded connection must be opened
+// before its payloads are returned, and payloads that were not read before a reconnect are skipped.
+type replayConn struct {
+	mu      sync.Mutex
+	records []*Record
+	next    int
+	open    bool
+
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+var _ Conn = (*replayConn)(nil)
+
+// checkExhausted closes done once there is nothing left to read
+func (c *replayConn) checkExhausted() {
+	for i := c.next; i < len(c.records); i++ {
+		if t := c.records[i].Type; t == recordIncoming || t == recordError {
+			return
+		}
+	}
+	c.doneOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *replayConn) Open(ctx context.Context, endpoint string, requestHeader http.Header) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.open {
+		return errors.New("replay connection is already open")
+	}
+
+	// skip to the start of the next recorded connection
+	for i := c.next; i < len(c.records); i++ {
+		if c.records[i].Type == recordOpen {
+			c.next = i + 1
+			break
+		}
+	}
+	c.checkExhausted()
+	c.open = true
+	return nil
+}
+
+func (c *replayConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.open {
+		return errors.New("replay connection is already closed")
+	}
+	c.open = false
+	return nil
+}
+
+func (c *replayConn) WriteJSON(v interface{}) error {
+	return c.write()
+}
+
+func (c *replayConn) WriteBinary(data []byte) error {
+	return c.write()
+}
+
+func (c *replayConn) write() error {
+	if c.Disconnected() {
+		return errors.New("replay connection is closed")
+	}
+	return nil
+}
+
+func (c *replayConn) Read(ctx context.Context) (packet []byte, err error) {
+	c.mu.Lock()
+	if !c.open {
+		c.mu.Unlock()
+		return nil, errors.New("replay connection is closed")
+	}
+	if err = ctx.Err(); err != nil {
+		// a receiver from a previous connection must not steal the payloads
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	for c.next < len(c.records) {
+		record := c.records[c.next]
+		if record.Type == recordOpen {
+			// the rest belongs to the next connection
+			break
+		}
+		c.next++
+
+		switch record.Type {
+		case recordIncoming:
+			c.checkExhausted()
+			c.mu.Unlock()
+			if len(record.Binary) > 0 {
+				return record.Binary, nil
+			}
+			return record.Data, nil
+		case recordError:
+			c.checkExhausted()
+			c.mu.Unlock()
+			if record.Code > 0 {
+				return nil, &CloseErr{code: record.Code, info: record.Error}
+			}
+			return nil, errors.New(record.Error)
+		}
+	}
+	c.mu.Unlock()
+
+	// nothing more was received on this connection
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *replayConn) Disconnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.open
+}
@@ -0,0 +1,134 @@
+// +build !integration
+
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/constant"
+	"github.com/andersfylling/disgord/internal/logger"
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+// lockedBuffer lets the test read the recording while the shard is still writing heartbeats
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func TestReplay(t *testing.T) {
+	f, err := os.Open("testdata/replay.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	replay, err := NewReplay(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &ShardConfig{Replay: replay}
+	if err = ConfigureShardConfig(nil, nil, conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.ShardCount != 1 || len(conf.ShardIDs) != 1 || conf.Encoding != constant.JSONEncoding {
+		t.Errorf("incorrect shard config from recording: %+v", conf)
+	}
+
+	var recording lockedBuffer
+	recorder := NewRecorder(&recording)
+
+	eChan := make(chan *Event, 20)
+	shutdown := make(chan interface{})
+	defer close(shutdown)
+	shard, err := NewEventClient(0, &EvtConfig{
+		ShardCount:     conf.ShardCount,
+		Endpoint:       conf.URL,
+		Encoding:       conf.Encoding,
+		Logger:         &logger.Empty{},
+		EventChan:      eChan,
+		Recorder:       recorder,
+		DiscordPktPool: &sync.Pool{New: func() interface{} { return &DiscordPacket{} }},
+		SystemShutdown: shutdown,
+		connectQueue: func(shardID uint, cb func() error) error {
+			return cb()
+		},
+		conn: replay.Conn(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shard.timeoutMultiplier = 0
+
+	if err = shard.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	for len(events) < 4 {
+		select {
+		case evt := <-eChan:
+			if !strings.HasPrefix(evt.Name, "SHARD_") {
+				events = append(events, evt.Name)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("replay did not dispatch every event. Got %v", events)
+		}
+	}
+	wants := []string{"READY", "GUILD_CREATE", "RESUMED", "MESSAGE_CREATE"}
+	for i := range wants {
+		if events[i] != wants[i] {
+			t.Errorf("incorrect event order. Got %v, wants %v", events, wants)
+			break
+		}
+	}
+
+	select {
+	case <-replay.Done():
+	case <-time.After(time.Second):
+		t.Error("replay was not marked as done")
+	}
+
+	if err = recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	var incoming, opened int
+	scanner := bufio.NewScanner(bytes.NewReader(recording.Bytes()))
+	for scanner.Scan() {
+		record := &Record{}
+		if err = util.Unmarshal(scanner.Bytes(), record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Time.IsZero() {
+			t.Error("record is missing a timestamp")
+		}
+		switch record.Type {
+		case recordIncoming:
+			incoming++
+		case recordOpen:
+			opened++
+		}
+	}
+	if incoming != 7 || opened != 2 {
+		t.Errorf("expected the recording to hold 7 incoming payloads over 2 connections. Got %d and %d", incoming, opened)
+	}
+}
@@ -0,0 +1,284 @@
+package gateway
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/event"
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+// scalingReadyTimeout is how long the new shards are given to receive their guilds before
+// they take over regardless.
+const scalingReadyTimeout = 5 * time.Minute
+
+// scalingDuplicateWindow is for how long an event dispatched by the old shards can suppress the same
+// event from the new shards, once the new shards have taken over.
+const scalingDuplicateWindow = 30 * time.Second
+
+// scaleWithoutDowntime connects a new set of shards next to the current one. The current shards
+// keep dispatching events until every new shard has received its guilds, after which the new shards
+// take over and the old shards are closed.
+func (s *shardMngr) scaleWithoutDowntime(reason string) {
+	if !s.scaling.CAS(false, true) {
+		// several shards may receive 4011 at the same time
+		return
+	}
+	defer s.scalingDone()
+
+	s.conf.Logger.Error("discord require websocket shards to scale up - starting zero downtime scaling:", reason)
+
+	s.mu.RLock()
+	oldShards := s.shardList()
+	shardCount := s.conf.ShardCount
+	s.mu.RUnlock()
+
+	data, err := s.conf.RESTClient.GetGatewayBot(context.Background())
+	if err != nil {
+		s.conf.Logger.Error("autoscaling", err)
+		return
+	}
+
+	if data.Shards <= shardCount {
+		s.conf.Logger.Error("autoscaling", "discord did not recommend more shards than", shardCount)
+		return
+	}
+
+	relay := newScalingRelay(s.conf.EventChan)
+
+	conf := s.evtConfig()
+	conf.Endpoint = data.URL
+	conf.ShardCount = data.Shards
+	conf.EventChan = relay.next
+	shards := make(map[shardID]*EvtClient, data.Shards)
+	shardIDs := make([]uint, 0, data.Shards)
+	for id := uint(0); id < data.Shards; id++ {
+		uniqueConfig := conf // create copy, review requirement
+		shard, err := NewEventClient(id, &uniqueConfig)
+		if err != nil {
+			s.conf.Logger.Error("autoscaling", "init-shards", err)
+			return
+		}
+		shards[id] = shard
+		shardIDs = append(shardIDs, id)
+		relay.expect(id)
+	}
+
+	go relay.run()
+	for _, shard := range oldShards {
+		shard.setEventChan(relay.old)
+	}
+
+	s.conf.Logger.Info("autoscaling", "connecting", len(shards), "new shards")
+	for _, shard := range shards {
+		if err := shard.reconnectLoop(); err != nil {
+			s.conf.Logger.Error(err)
+		}
+	}
+
+	select {
+	case <-relay.ready:
+		s.conf.Logger.Info("autoscaling", "new shards received every guild")
+	case <-time.After(scalingReadyTimeout):
+		s.conf.Logger.Error("autoscaling", "new shards did not receive every guild within", scalingReadyTimeout, "- swapping anyways")
+	case <-s.conf.ShutdownChan:
+		return
+	}
+
+	unhandledGuilds := s.redistributeMsgs(func() {
+		relay.swap()
+
+		s.mu.Lock()
+		s.shards = shards
+		s.conf.URL = data.URL
+		s.conf.ShardCount = data.Shards
+		s.conf.ShardIDs = shardIDs
+		s.mu.Unlock()
+
+		for _, shard := range oldShards {
+			if err := shard.Disconnect(); err != nil {
+				s.conf.Logger.Error("Disconnect error (trivial):", err)
+			}
+		}
+	})
+	if s.conf.OnScalingDiscardedRequests != nil {
+		s.conf.OnScalingDiscardedRequests(unhandledGuilds)
+	}
+	s.conf.Logger.Info("autoscaling", "scaled up to", data.Shards, "shards")
+
+	// let the new shards dispatch directly once duplicates can no longer arrive
+	select {
+	case <-time.After(scalingDuplicateWindow):
+	case <-s.conf.ShutdownChan:
+	}
+	for _, shard := range oldShards {
+		shard.setEventChan(nil)
+	}
+	for _, shard := range shards {
+		shard.setEventChan(s.conf.EventChan)
+	}
+	close(relay.done)
+}
+
+// scalingRelay sits between two shard sets and the dispatcher during scaling. Events from the old
+// shards are dispatched until swap is called, while events from the new shards are only used to
+// track which guilds have been received. After the swap, events from the new shards are dispatched
+// unless the old shards already dispatched the same event.
+//
+// Every event the old shards dispatch is matched with one identical event from the new shards. An
+// event that legitimately repeats, such as re-adding a reaction, is therefore only dropped as many
+// times as the old shards delivered it.
+type scalingRelay struct {
+	out  chan<- *Event
+	old  chan *Event
+	next chan *Event
+
+	mu          sync.Mutex
+	swapped     bool
+	unready     map[shardID]struct{}
+	unavailable map[Snowflake]struct{}
+	delivered   map[uint64]relayedEvent
+	lastPrune   time.Time
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	done      chan struct{}
+}
+
+func newScalingRelay(out chan<- *Event) *scalingRelay {
+	return &scalingRelay{
+		out:         out,
+		old:         make(chan *Event),
+		next:        make(chan *Event),
+		unready:     map[shardID]struct{}{},
+		unavailable: map[Snowflake]struct{}{},
+		delivered:   map[uint64]relayedEvent{},
+		ready:       make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// expect registers a new shard that must receive READY before the new shards are ready
+func (r *scalingRelay) expect(id shardID) {
+	r.mu.Lock()
+	r.unready[id] = struct{}{}
+	r.mu.Unlock()
+}
+
+func (r *scalingRelay) swap() {
+	r.mu.Lock()
+	r.swapped = true
+	r.mu.Unlock()
+}
+
+func (r *scalingRelay) run() {
+	for {
+		select {
+		case evt := <-r.old:
+			if r.fromOld(evt) {
+				r.out <- evt
+			}
+		case evt := <-r.next:
+			if r.fromNext(evt) {
+				r.out <- evt
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// relayedEvent tracks identical events. pending is the number of times the old shards delivered the
+// event minus the number of times the new shards received it.
+type relayedEvent struct {
+	pending int
+	at      time.Time
+}
+
+func hashEvent(evt *Event) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(evt.Name))
+	_, _ = h.Write(evt.Data)
+	return h.Sum64()
+}
+
+// track adds delta to the pending count of the event, and returns the count before the change
+func (r *scalingRelay) track(evt *Event, delta int) (pending int) {
+	now := time.Now()
+	hash := hashEvent(evt)
+	relayed, tracked := r.delivered[hash]
+	if tracked && now.Sub(relayed.at) > scalingDuplicateWindow {
+		relayed.pending = 0
+	}
+	pending = relayed.pending
+
+	relayed.pending += delta
+	relayed.at = now
+	if relayed.pending == 0 {
+		delete(r.delivered, hash)
+	} else {
+		r.delivered[hash] = relayed
+	}
+
+	if now.Sub(r.lastPrune) > scalingDuplicateWindow {
+		for hash, relayed := range r.delivered {
+			if now.Sub(relayed.at) > scalingDuplicateWindow {
+				delete(r.delivered, hash)
+			}
+		}
+		r.lastPrune = now
+	}
+	return pending
+}
+
+// fromOld returns true if the event from an old shard should be dispatched
+func (r *scalingRelay) fromOld(evt *Event) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.swapped {
+		return false
+	}
+
+	r.track(evt, 1)
+	return true
+}
+
+// fromNext returns true if the event from a new shard should be dispatched
+func (r *scalingRelay) fromNext(evt *Event) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivered := r.track(evt, -1) > 0
+	if r.swapped {
+		return !delivered
+	}
+
+	switch evt.Name {
+	case event.Ready:
+		ready := struct {
+			Guilds []struct {
+				ID Snowflake `json:"id"`
+			} `json:"guilds"`
+		}{}
+		_ = util.Unmarshal(evt.Data, &ready)
+		for _, guild := range ready.Guilds {
+			r.unavailable[guild.ID] = struct{}{}
+		}
+		delete(r.unready, evt.ShardID)
+	case event.GuildCreate, event.GuildDelete:
+		// GUILD_DELETE means the guild is part of an outage and won't be created yet
+		guild := struct {
+			ID Snowflake `json:"id"`
+		}{}
+		_ = util.Unmarshal(evt.Data, &guild)
+		delete(r.unavailable, guild.ID)
+	}
+
+	if len(r.unready) == 0 && len(r.unavailable) == 0 {
+		r.readyOnce.Do(func() {
+			close(r.ready)
+		})
+	}
+	return false
+}
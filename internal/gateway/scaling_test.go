@@ -0,0 +1,101 @@
+// +build !integration
+
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/event"
+)
+
+func TestScalingRelay(t *testing.T) {
+	out := make(chan *Event, 10)
+	relay := newScalingRelay(out)
+	relay.expect(0)
+	relay.expect(1)
+	go relay.run()
+	defer close(relay.done)
+
+	receive := func() *Event {
+		select {
+		case evt := <-out:
+			return evt
+		case <-time.After(time.Second):
+			t.Fatal("event was not dispatched")
+			return nil
+		}
+	}
+	isReady := func() bool {
+		select {
+		case <-relay.ready:
+			return true
+		default:
+			return false
+		}
+	}
+
+	message := &Event{Name: event.MessageCreate, Data: []byte(`{"id":"1"}`)}
+	relay.old <- message
+	if evt := receive(); evt != message {
+		t.Error("event from old shard was not dispatched")
+	}
+
+	relay.next <- &Event{Name: event.Ready, ShardID: 0, Data: []byte(`{"guilds":[{"id":"10","unavailable":true}]}`)}
+	relay.next <- &Event{Name: event.Ready, ShardID: 1, Data: []byte(`{"guilds":[{"id":"11","unavailable":true}]}`)}
+	relay.next <- &Event{Name: event.GuildCreate, ShardID: 0, Data: []byte(`{"id":"10"}`)}
+	if isReady() {
+		t.Fatal("relay should not be ready before every guild is received")
+	}
+	relay.next <- &Event{Name: event.GuildCreate, ShardID: 1, Data: []byte(`{"id":"11"}`)}
+	select {
+	case <-relay.ready:
+	case <-time.After(time.Second):
+		t.Fatal("relay should be ready once every guild is received")
+	}
+
+	relay.swap()
+	relay.old <- &Event{Name: event.MessageCreate, Data: []byte(`{"id":"2"}`)}
+	relay.next <- &Event{Name: event.MessageCreate, Data: []byte(`{"id":"1"}`)}
+	relay.next <- &Event{Name: event.MessageCreate, Data: []byte(`{"id":"3"}`)}
+	if evt := receive(); string(evt.Data) != `{"id":"3"}` {
+		t.Errorf("expected only the new event to be dispatched, got %s", string(evt.Data))
+	}
+	select {
+	case evt := <-out:
+		t.Errorf("unexpected event dispatched: %s", string(evt.Data))
+	default:
+	}
+}
+
+func TestScalingRelay_repeatedEvents(t *testing.T) {
+	relay := newScalingRelay(nil)
+	reaction := func() *Event {
+		return &Event{Name: event.MessageReactionAdd, Data: []byte(`{"message_id":"1","emoji":{"name":"a"}}`)}
+	}
+
+	// the new shard receives the reaction before the old shard
+	if relay.fromNext(reaction()) {
+		t.Error("events from the new shards should not be dispatched before the swap")
+	}
+	if !relay.fromOld(reaction()) {
+		t.Error("events from the old shards should be dispatched before the swap")
+	}
+	// the old shard receives the reaction before the new shard
+	relay.fromOld(reaction())
+
+	relay.swap()
+	if relay.fromNext(reaction()) {
+		t.Error("the reaction was already dispatched by the old shard")
+	}
+	// the reaction was removed and added again
+	if !relay.fromNext(reaction()) {
+		t.Error("the repeated reaction should be dispatched")
+	}
+	if !relay.fromNext(reaction()) {
+		t.Error("the repeated reaction should be dispatched")
+	}
+	if len(relay.delivered) != 1 || relay.delivered[hashEvent(reaction())].pending != -2 {
+		t.Errorf("expected only the events the old shards missed to be tracked. Got %+v", relay.delivered)
+	}
+}
@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+// SessionState holds what a shard needs to resume a gateway session.
+type SessionState struct {
+	ShardID        uint      `json:"shard_id"`
+	ShardCount     uint      `json:"shard_count"`
+	SessionID      string    `json:"session_id"`
+	SequenceNumber uint32    `json:"seq"`
+	SavedAt        time.Time `json:"saved_at"`
+}
+
+// SessionStore persists gateway sessions across process restarts. Shards save their session on a
+// graceful Disconnect and try to resume it on the next Connect, before falling back to identify.
+// A resume does not count towards the identify rate limit and replays the missed events.
+type SessionStore interface {
+	// Load returns the stored session for the given shard, or nil if there is none.
+	Load(shardID uint) (*SessionState, error)
+	Save(session *SessionState) error
+	Delete(shardID uint) error
+}
+
+// NewFileSessionStore creates a SessionStore that writes one JSON file per shard into the given directory.
+func NewFileSessionStore(dir string) SessionStore {
+	return &fileSessionStore{
+		dir: dir,
+	}
+}
+
+type fileSessionStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+var _ SessionStore = (*fileSessionStore)(nil)
+
+func (s *fileSessionStore) path(shardID uint) string {
+	return filepath.Join(s.dir, "shard-"+strconv.FormatUint(uint64(shardID), 10)+".json")
+}
+
+func (s *fileSessionStore) Load(shardID uint) (*SessionState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := ioutil.ReadFile(s.path(shardID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	session := &SessionState{}
+	if err = util.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *fileSessionStore) Save(session *SessionState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := util.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, such that a crash never leaves a partial session behind
+	path := s.path(session.ShardID)
+	if err = ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (s *fileSessionStore) Delete(shardID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(shardID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// +build !integration
+
+package gateway
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/andersfylling/disgord/internal/logger"
+)
+
+func TestFileSessionStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disgord-sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileSessionStore(dir)
+	if session, err := store.Load(3); err != nil {
+		t.Fatal(err)
+	} else if session != nil {
+		t.Fatal("expected no session")
+	}
+
+	if err = store.Save(&SessionState{ShardID: 3, ShardCount: 4, SessionID: "abc", SequenceNumber: 42}); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := store.Load(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session == nil || session.SessionID != "abc" || session.SequenceNumber != 42 || session.ShardCount != 4 {
+		t.Errorf("incorrect session loaded: %+v", session)
+	}
+
+	if err = store.Delete(3); err != nil {
+		t.Fatal(err)
+	}
+	if session, _ = store.Load(3); session != nil {
+		t.Error("session should have been deleted")
+	}
+	if err = store.Delete(3); err != nil {
+		t.Error("deleting a missing session should not fail", err)
+	}
+}
+
+func TestEvtClient_restoreSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disgord-sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newShard := func(shardCount uint) *EvtClient {
+		shard, err := NewEventClient(1, &EvtConfig{
+			ShardCount:     shardCount,
+			Logger:         &logger.Empty{},
+			EventChan:      make(chan *Event),
+			DiscordPktPool: &sync.Pool{New: func() interface{} { return &DiscordPacket{} }},
+			SystemShutdown: make(chan interface{}),
+			conn:           &testWS{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return shard
+	}
+
+	store := NewFileSessionStore(dir)
+	shard := newShard(2)
+	shard.sessionID = "abc"
+	shard.sequenceNumber.Store(10)
+	if err = shard.persistSession(store); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newShard(2)
+	if err = restored.restoreSession(store); err != nil {
+		t.Fatal(err)
+	}
+	if restored.virginConnection() {
+		t.Fatal("session was not restored")
+	}
+	if restored.sessionID != "abc" || restored.sequenceNumber.Load() != 10 {
+		t.Errorf("incorrect session restored. Got %s:%d", restored.sessionID, restored.sequenceNumber.Load())
+	}
+
+	if session, _ := store.Load(1); session != nil {
+		t.Error("a restored session should be removed from the store")
+	}
+
+	t.Run("shard count changed", func(t *testing.T) {
+		if err = shard.persistSession(store); err != nil {
+			t.Fatal(err)
+		}
+
+		scaled := newShard(4)
+		if err = scaled.restoreSession(store); err != nil {
+			t.Fatal(err)
+		}
+		if !scaled.virginConnection() {
+			t.Error("session from a different shard count should not be restored")
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"sort"
+	"time"
+)
+
+// ShardStatus is a snapshot of the state of a single shard.
+type ShardStatus struct {
+	ShardID        uint
+	Connected      bool
+	SessionID      string
+	SequenceNumber uint32
+
+	// Reconnects is the number of times the shard has reconnected since it was created
+	Reconnects uint
+
+	// Zombies is the number of times Discord did not acknowledge a heartbeat, forcing a reconnect
+	Zombies uint
+
+	HeartbeatLatency time.Duration
+
+	// QueueDepth is the number of commands waiting to be sent. A queue that keeps growing means the
+	// shard is held back by the gateway rate limit.
+	QueueDepth uint
+
+	// LastEvent is when the last Discord event was received, zero if none has been received yet
+	LastEvent time.Time
+
+	// Guilds is the number of guilds handled by the shard. This is populated by the disgord Client.
+	Guilds uint
+}
+
+// Status returns a snapshot of the shard state
+func (c *EvtClient) Status() ShardStatus {
+	c.RLock()
+	status := ShardStatus{
+		ShardID:          c.ShardID,
+		SessionID:        c.sessionID,
+		HeartbeatLatency: c.heartbeatLatency,
+	}
+	c.RUnlock()
+
+	status.Connected = c.isConnected.Load()
+	status.SequenceNumber = c.sequenceNumber.Load()
+	status.Reconnects = uint(c.reconnects.Load())
+	status.Zombies = uint(c.zombies.Load())
+	status.QueueDepth = uint(c.messageQueue.Len())
+	if lastEvent := c.lastEvent.Load(); lastEvent > 0 {
+		status.LastEvent = time.Unix(0, lastEvent)
+	}
+	return status
+}
+
+// ShardStatus returns a snapshot of every local shard, sorted by shard ID
+func (s *shardMngr) ShardStatus() (statuses []ShardStatus) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, shard := range s.shards {
+		statuses = append(statuses, shard.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ShardID < statuses[j].ShardID
+	})
+	return statuses
+}
@@ -0,0 +1,69 @@
+// +build !integration
+
+package gateway
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/gateway/event"
+	"github.com/andersfylling/disgord/internal/gateway/opcode"
+	"github.com/andersfylling/disgord/internal/logger"
+)
+
+func TestEvtClient_lifecycleEvents(t *testing.T) {
+	eChan := make(chan *Event, 10)
+	shard, err := NewEventClient(2, &EvtConfig{
+		ShardCount:     4,
+		Logger:         &logger.Empty{},
+		EventChan:      eChan,
+		IgnoreEvents:   []string{event.ShardResumed},
+		DiscordPktPool: &sync.Pool{New: func() interface{} { return &DiscordPacket{} }},
+		SystemShutdown: make(chan interface{}),
+		conn:           &testWS{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets := []*DiscordPacket{
+		{Op: opcode.EventDiscordEvent, EventName: event.Ready, SequenceNumber: 1, Data: []byte(`{"session_id":"abc"}`)},
+		{Op: opcode.EventDiscordEvent, EventName: event.Resumed, SequenceNumber: 2, Data: []byte(`{}`)},
+	}
+	for _, p := range packets {
+		if err = shard.onDiscordEvent(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shard.notifyLifecycle(event.ShardDisconnected, &shardDisconnected{Code: 4000, Reason: "unknown error"})
+
+	wants := []string{event.Ready, event.ShardReady, event.Resumed, event.ShardDisconnected}
+	for _, name := range wants {
+		select {
+		case evt := <-eChan:
+			if evt.Name != name {
+				t.Errorf("expected event %s, got %s", name, evt.Name)
+			}
+			if evt.ShardID != 2 {
+				t.Errorf("expected shard id 2, got %d", evt.ShardID)
+			}
+			if name == event.ShardDisconnected && string(evt.Data) != `{"code":4000,"reason":"unknown error"}` {
+				t.Errorf("incorrect event data: %s", string(evt.Data))
+			}
+		default:
+			t.Fatalf("missing event %s", name)
+		}
+	}
+	if len(eChan) > 0 {
+		t.Errorf("ignored lifecycle event was dispatched: %s", (<-eChan).Name)
+	}
+
+	status := shard.Status()
+	if status.ShardID != 2 || status.SessionID != "abc" || status.SequenceNumber != 2 {
+		t.Errorf("incorrect shard status: %+v", status)
+	}
+	if time.Since(status.LastEvent) > time.Minute {
+		t.Error("last event time was not updated")
+	}
+}
@@ -10,14 +10,26 @@ import (
 const DefaultIdentifyRateLimit = 1000
 
 func newShardSync(conf *ShardConfig, l logger.Logger, lPrefix string, shutdownChan chan interface{}) *shardSync {
+	concurrency := conf.MaxConcurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+
+	// one queue per identify bucket
+	queues := make([]chan *shardSyncQueueItem, concurrency)
+	for i := range queues {
+		queues[i] = make(chan *shardSyncQueueItem, 100) // it's just pointers anyways
+	}
+
 	return &shardSync{
 		identifiesPer24H: conf.IdentifiesPer24H,
 		timeout:          conf.ShardRateLimit,
-		queue:            make(chan *shardSyncQueueItem, 100), // it's just pointers anyways
+		queues:           queues,
 		logger:           l,
 		lpre:             lPrefix,
 		shutdownChan:     shutdownChan,
 		metric:           &IdentifyMetric{},
+		after:            time.After,
 	}
 }
 
@@ -32,11 +44,12 @@ type shardSync struct {
 
 	identifiesPer24H uint
 	timeout          time.Duration
-	queue            chan *shardSyncQueueItem
+	queues           []chan *shardSyncQueueItem
 	logger           logger.Logger
 	lpre             string
 	shutdownChan     chan interface{}
 	metric           *IdentifyMetric
+	after            func(time.Duration) <-chan time.Time // waits for the rate limit window of a bucket
 }
 
 func (s *shardSync) queueShard(shardID uint, cb func() error) (err error) {
@@ -47,8 +60,11 @@ func (s *shardSync) queueShard(shardID uint, cb func() error) (err error) {
 
 	start := time.Now()
 
-	s.logger.Debug(s.lpre, "shard", shardID, "is waiting to identify")
-	s.queue <- &shardSyncQueueItem{
+	// shards are rate limited by their identify bucket, see max_concurrency
+	bucket := shardID % uint(len(s.queues))
+
+	s.logger.Debug(s.lpre, "shard", shardID, "is waiting to identify in bucket", bucket)
+	s.queues[bucket] <- &shardSyncQueueItem{
 		ShardID: shardID,
 		run:     cb,
 		errChan: errChan,
@@ -63,7 +79,20 @@ func (s *shardSync) queueShard(shardID uint, cb func() error) (err error) {
 	return err
 }
 
+// process handles the identify queue of every bucket, and returns once all of them has stopped
 func (s *shardSync) process() {
+	wg := sync.WaitGroup{}
+	wg.Add(len(s.queues))
+	for i := range s.queues {
+		go func(queue chan *shardSyncQueueItem) {
+			defer wg.Done()
+			s.processBucket(queue)
+		}(s.queues[i])
+	}
+	wg.Wait()
+}
+
+func (s *shardSync) processBucket(queue chan *shardSyncQueueItem) {
 	for {
 		var item *shardSyncQueueItem
 		var open bool
@@ -73,7 +102,7 @@ func (s *shardSync) process() {
 		case <-s.shutdownChan:
 			s.logger.Debug(s.lpre, "shard identify-rate-limiter got shutdown signal")
 			return
-		case item, open = <-s.queue:
+		case item, open = <-queue:
 			if !open {
 				s.logger.Error(s.lpre, "queue unexpectly closed - shards can no longer identify")
 				return
@@ -89,6 +118,8 @@ func (s *shardSync) process() {
 			continue
 		}
 
+		// the 1000 identify / 24 hours rate limit is shared by every bucket
+		s.Lock()
 		s.metric.Lock()
 		s.metric.Reconnects = append(s.metric.Reconnects, time.Now())
 		s.metric.Unlock()
@@ -102,12 +133,13 @@ func (s *shardSync) process() {
 			penalty = (24 * time.Hour) - time.Since(oldest)
 			s.logger.Info(s.lpre, "shard identifying hit 1k rate limit and connections are halted for", penalty)
 		}
+		s.Unlock()
 
 		select {
 		case <-s.shutdownChan:
 			s.logger.Debug(s.lpre, "shard identify-rate-limiter got shutdown signal")
 			return
-		case <-time.After(s.timeout + penalty):
+		case <-s.after(s.timeout + penalty):
 		}
 	}
 }
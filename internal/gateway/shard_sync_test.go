@@ -0,0 +1,89 @@
+// +build !integration
+
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/logger"
+)
+
+func TestShardSync_maxConcurrency(t *testing.T) {
+	shutdown := make(chan interface{})
+	defer close(shutdown)
+
+	delay := 100 * time.Millisecond
+	s := newShardSync(&ShardConfig{
+		ShardRateLimit:   delay,
+		MaxConcurrency:   2,
+		IdentifiesPer24H: DefaultIdentifyRateLimit,
+	}, &logger.Empty{}, "[shardSync]", shutdown)
+
+	// the rate limit window of a bucket only passes once the test releases it
+	waits := make(chan time.Duration, 4)
+	release := make(chan time.Time)
+	s.after = func(d time.Duration) <-chan time.Time {
+		waits <- d
+		return release
+	}
+	go s.process()
+
+	identified := make(chan uint, 4)
+	for id := uint(0); id < 4; id++ {
+		go func(shardID uint) {
+			err := s.queueShard(shardID, func() error {
+				identified <- shardID
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(id)
+	}
+
+	nextIdentify := func() uint {
+		select {
+		case id := <-identified:
+			return id
+		case <-time.After(time.Second):
+			t.Fatal("expected a shard to identify")
+		}
+		return 0
+	}
+	// once every bucket waits for its window, no other shard can identify
+	waitForWindows := func(n int) {
+		for i := 0; i < n; i++ {
+			select {
+			case d := <-waits:
+				if d != delay {
+					t.Errorf("expected the bucket to wait %s, got %s", delay, d)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expected the bucket to wait for the rate limit window")
+			}
+		}
+		if len(identified) > 0 {
+			t.Fatal("a shard identified while every bucket was rate limited")
+		}
+	}
+
+	// shard 0 and 2 shares a bucket, as does 1 and 3
+	shards := map[uint]bool{}
+	a, b := nextIdentify(), nextIdentify()
+	if a%2 == b%2 {
+		t.Errorf("expected one shard per bucket to identify at once. Got shard %d and %d", a, b)
+	}
+	shards[a], shards[b] = true, true
+	waitForWindows(2)
+
+	// every released window lets exactly one more shard identify
+	for i := 0; i < 2; i++ {
+		release <- time.Time{}
+		shards[nextIdentify()] = true
+		waitForWindows(1)
+	}
+	if len(shards) != 4 {
+		t.Errorf("expected every shard to identify once. Got %v", shards)
+	}
+}
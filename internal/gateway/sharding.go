@@ -8,6 +8,8 @@ import (
 	"sync"
 	"time"
 
+	"go.uber.org/atomic"
+
 	"github.com/andersfylling/disgord/internal/constant"
 	"github.com/andersfylling/disgord/internal/event"
 	"github.com/andersfylling/disgord/internal/gateway/cmd"
@@ -29,6 +31,23 @@ func GetShardForGuildID(guildID Snowflake, shardCount uint) (shardID uint) {
 }
 
 func ConfigureShardConfig(ctx context.Context, client GatewayBotGetter, conf *ShardConfig) error {
+	if conf.Replay != nil {
+		conf.Replay.configure(conf)
+		return nil
+	}
+
+	if conf.Coordinator != nil && conf.OnScalingRequired == nil {
+		return errors.New("OnScalingRequired must be set when using a Coordinator, as auto scaling is disabled")
+	}
+	if conf.Coordinator != nil && len(conf.ShardIDs) == 0 {
+		shardCount, shardIDs, err := conf.Coordinator.Assign(ctx)
+		if err != nil {
+			return err
+		}
+		conf.ShardCount = shardCount
+		conf.ShardIDs = shardIDs
+	}
+
 	if len(conf.ShardIDs) == 0 && conf.ShardCount != 0 {
 		return errors.New("ShardCount should only be set when you use distributed bots and have set the ShardIDs field - ShardCount is an optional field")
 	}
@@ -63,6 +82,21 @@ func ConfigureShardConfig(ctx context.Context, client GatewayBotGetter, conf *Sh
 		conf.ShardRateLimit = defaultShardRateLimit
 	}
 
+	if conf.MaxConcurrency == 0 {
+		conf.MaxConcurrency = data.SessionStartLimit.MaxConcurrency
+	}
+	if conf.MaxConcurrency == 0 {
+		conf.MaxConcurrency = 1
+	}
+
+	switch conf.Encoding {
+	case "":
+		conf.Encoding = constant.JSONEncoding
+	case constant.JSONEncoding, constant.ETFEncoding:
+	default:
+		return errors.New("unsupported gateway encoding: " + conf.Encoding)
+	}
+
 	return nil
 }
 
@@ -102,7 +136,9 @@ func NewShardMngr(conf ShardManagerConfig) *shardMngr {
 			},
 		},
 	}
-	if conf.ConnectQueue == nil {
+	if conf.ConnectQueue == nil && conf.Coordinator != nil {
+		mngr.connectQueue = conf.Coordinator.Identify
+	} else if conf.ConnectQueue == nil {
 		mngr.sync = newShardSync(&conf.ShardConfig, conf.Logger, "[shardSync]", conf.ShutdownChan)
 		mngr.connectQueue = mngr.sync.queueShard
 
@@ -124,6 +160,7 @@ type ShardManager interface {
 	ShardIDs() (shardIDs []uint)
 	GetShard(shardID shardID) (shard *EvtClient, err error)
 	HeartbeatLatencies() (latencies map[shardID]time.Duration, err error)
+	ShardStatus() []ShardStatus
 }
 
 type ShardConfig struct {
@@ -150,6 +187,13 @@ type ShardConfig struct {
 	// Large bots only. If Discord did not give you a custom rate limit, do not touch this.
 	ShardRateLimit time.Duration
 
+	// MaxConcurrency is the number of identify buckets, where a shard belongs to the bucket
+	// shardID % MaxConcurrency. Each bucket can identify once per ShardRateLimit, so shards
+	// in different buckets can identify at the same time.
+	//
+	// Defaults to the max_concurrency given by Discord in the Gateway Bot endpoint.
+	MaxConcurrency uint
+
 	// ConnectQueue is used to control how often shards can connect by sending an identify command.
 	// For distributed systems, this must be overwritten as, by default, you can only send one identify
 	// every five seconds. The default implementation can be found in shard_sync.go.
@@ -161,12 +205,24 @@ type ShardConfig struct {
 	// default value is false unless shardIDs or ShardCount is set.
 	DisableAutoScaling bool
 
+	// ZeroDowntimeScaling changes how auto scaling reacts to a 4011 websocket error. Instead of
+	// disconnecting every shard before resharding, the new set of shards is connected next to the
+	// current one. The current shards keep dispatching events until every new shard has received
+	// its guilds, then the new shards take over and the old ones are closed. Events received by
+	// both shard sets during the overlap are only dispatched once. A shard that got the 4011 error
+	// does not reconnect during the overlap.
+	//
+	// Every new shard must identify while the old shards are still connected, so make sure there
+	// are enough identifies left. Ignored when DisableAutoScaling is true.
+	ZeroDowntimeScaling bool
+
 	// OnScalingRequired is triggered when Discord closes the websocket connection
 	// with a 4011 websocket error. It may run multiple times per session. You should
 	// immediately call disconnect and scale your shards, unless you know what you're doing.
 	//
 	// This is triggered when DisableAutoScaling is true. If DisableAutoScaling is true and
-	// OnScalingRequired is nil, this is considered an user error and will panic.
+	// OnScalingRequired is nil, the error is logged and the shard that got the 4011 error stays
+	// disconnected.
 	//
 	// You must return the new number of total shards and additional shard ids this instance
 	// should setup. If you do not want this instance to gain extra shards, set AdditionalShardIDs
@@ -189,6 +245,50 @@ type ShardConfig struct {
 
 	// URL is fetched from the gateway before initialising a connection
 	URL string
+
+	// TransportCompression connects every shard with compress=zlib-stream. Discord then compresses
+	// the entire connection using one shared compression context, which compresses far better than
+	// the per-payload compression. Recommended for bots that receive large GUILD_CREATE bursts.
+	TransportCompression bool
+
+	// Encoding of the gateway payloads, either "json" or "etf" (Erlang Term Format). ETF payloads
+	// are transcoded into JSON before they reach the handlers and the cache, so this only affects
+	// the data sent over the wire. ETF is only meant for compatibility: the transcoding makes it
+	// slower than JSON and allocates more.
+	//
+	// Defaults to "json".
+	Encoding string
+
+	// Coordinator is used when several disgord processes share the same bot token. It assigns the
+	// ShardIDs and ShardCount of this process, unless ShardIDs is set, and makes sure shards across
+	// every process identify one at a time. Auto scaling is disabled, so OnScalingRequired must be set.
+	//
+	// See NewShardCoordinatorServer and NewShardCoordinatorClient for a reference implementation
+	// that runs over a local TCP or unix socket. ConnectQueue takes precedence for identifying.
+	Coordinator ShardCoordinator
+
+	// SessionStore persists the session of every shard on a graceful Disconnect, such that the shards
+	// resume their sessions on the next Connect instead of identifying. This allows restarts and deploys
+	// without spending identifies, and missed events are replayed by Discord. Sessions expire shortly
+	// after the connection is closed, so shards fall back to identify when a resume is rejected.
+	//
+	// See NewFileSessionStore for a file based implementation. Disabled when nil.
+	SessionStore SessionStore
+
+	// Recorder writes every payload sent and received by the shards into a single JSONL file.
+	// See NewRecorder.
+	Recorder *Recorder
+
+	// Replay plays back a recording instead of connecting to Discord. The shard IDs, shard count and
+	// encoding are taken from the recording, and Discord is never contacted. See NewReplay.
+	Replay *Replay
+
+	// NewConn creates the websocket connection of every shard. The connection is reused when a shard
+	// reconnects. This allows other websocket libraries, or wrappers that inject latency, dropped
+	// frames or forced closes for testing.
+	//
+	// Defaults to NewNhooyrConn, or NewGorillaConn when built with the disgord_websocket_gorilla tag.
+	NewConn NewConnFunc
 }
 
 // ShardManagerConfig all fields, except proxy.Dialer, is required
@@ -224,12 +324,14 @@ type shardMngr struct {
 
 	sync         *shardSync
 	connectQueue connectQueue
+
+	scaling atomic.Bool
 }
 
 var _ ShardManager = (*shardMngr)(nil)
 
-func (s *shardMngr) initShards() error {
-	baseConfig := EvtConfig{ // TODO: not nicely grouped, feel free to adjust
+func (s *shardMngr) evtConfig() EvtConfig {
+	return EvtConfig{ // TODO: not nicely grouped, feel free to adjust
 		// identity
 		Browser:             s.conf.DisgordInfo,
 		Device:              s.conf.ProjectName,
@@ -239,13 +341,16 @@ func (s *shardMngr) initShards() error {
 		GuildSubscriptions:  s.conf.GuildSubscriptions,
 
 		// lib specific
-		Version:        constant.DiscordVersion,
-		Encoding:       constant.JSONEncoding,
-		Endpoint:       s.conf.URL,
-		Logger:         s.conf.Logger,
-		IgnoreEvents:   s.conf.IgnoreEvents,
-		Intents:        s.conf.Intents,
-		DiscordPktPool: s.DiscordPktPool,
+		Version:              constant.DiscordVersion,
+		Encoding:             s.conf.Encoding,
+		Endpoint:             s.conf.URL,
+		TransportCompression: s.conf.TransportCompression,
+		Logger:               s.conf.Logger,
+		IgnoreEvents:         s.conf.IgnoreEvents,
+		Intents:              s.conf.Intents,
+		DiscordPktPool:       s.DiscordPktPool,
+		Recorder:             s.conf.Recorder,
+		NewConn:              s.conf.NewConn,
 
 		// synchronization
 		EventChan:    s.conf.EventChan,
@@ -256,47 +361,37 @@ func (s *shardMngr) initShards() error {
 		HTTPClient: s.conf.HTTPClient,
 
 		// other
-		SystemShutdown: s.conf.ShutdownChan,
+		SystemShutdown:        s.conf.ShutdownChan,
+		haltOnScalingRequired: true, // the shards are replaced or reconnected by the scaling, see discordErrListener
 		discordErrListener: func(code int, reason string) {
 			if code != discordErrShardScalingRequired {
 				return
 			}
-			s.mu.Lock()
-			defer s.mu.Unlock()
-			s.conf.Logger.Info("scaling")
-
-			if !s.conf.DisableAutoScaling {
-				s.scale(code, reason)
-			} else {
-				if s.conf.OnScalingRequired == nil {
-					panic("ShardConfig.OnScalingRequired must be set")
-				}
-				var newShards []uint
-				s.conf.ShardCount, newShards = s.conf.OnScalingRequired(s.ShardIDs())
-				s.conf.ShardIDs = append(s.conf.ShardIDs, newShards...)
-
-				_ = s.Disconnect()
-				if err := s.initShards(); err != nil {
-					s.conf.Logger.Error("scaling", "init-shards", err)
-					return
-				}
-				s.conf.Logger.Info("scaling", "connecting shards")
-				if err := s.Connect(); err != nil {
-					s.conf.Logger.Error("scaling", "connect", err)
-				}
-				s.conf.Logger.Info("scaling", "connected")
+			switch {
+			case s.conf.DisableAutoScaling:
+				s.scaleManually(reason)
+			case s.conf.ZeroDowntimeScaling:
+				s.scaleWithoutDowntime(reason)
+			default:
+				s.scale(reason)
 			}
 		},
 		conn: s.conf.conn,
 	}
+}
 
+func (s *shardMngr) initShards() error {
+	baseConfig := s.evtConfig()
 	for _, id := range s.conf.ShardIDs {
 		if shard, alreadyConfigured := s.shards[id]; alreadyConfigured {
-			shard.evtConf.ShardCount = s.conf.ShardCount
+			shard.setShardCount(s.conf.ShardCount)
 			continue
 		}
 
 		uniqueConfig := baseConfig // create copy, review requirement
+		if s.conf.Replay != nil {
+			uniqueConfig.conn = s.conf.Replay.Conn(id)
+		}
 		shard, err := NewEventClient(id, &uniqueConfig)
 		if err != nil {
 			return err
@@ -310,7 +405,11 @@ func (s *shardMngr) initShards() error {
 func (s *shardMngr) Connect() (err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.connectLocked()
+}
 
+// connectLocked connects every shard. The caller must hold s.mu.
+func (s *shardMngr) connectLocked() (err error) {
 	if len(s.conf.ShardIDs) == 0 {
 		return errors.New("no shard ids has been registered")
 	}
@@ -321,7 +420,19 @@ func (s *shardMngr) Connect() (err error) {
 		}
 	}
 
+	if s.conf.SessionStore != nil {
+		for _, shard := range s.shards {
+			if !shard.virginConnection() {
+				continue
+			}
+			if err := shard.restoreSession(s.conf.SessionStore); err != nil {
+				s.conf.Logger.Error("unable to restore session for shard", shard.ShardID, err)
+			}
+		}
+	}
+
 	for _, shard := range s.shards {
+		shard.haltedForScaling.Store(false) // reconnected here instead
 		err := shard.reconnectLoop()
 		if err != nil {
 			s.conf.Logger.Error(err)
@@ -329,12 +440,26 @@ func (s *shardMngr) Connect() (err error) {
 	}
 	return nil
 }
+
 func (s *shardMngr) Disconnect() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.disconnectLocked()
+}
 
+// disconnectLocked disconnects every shard. The caller must hold s.mu.
+func (s *shardMngr) disconnectLocked() error {
 	for _, shard := range s.shards {
+		if s.conf.SessionStore != nil {
+			if err := shard.persistSession(s.conf.SessionStore); err != nil {
+				s.conf.Logger.Error("unable to persist session for shard", shard.ShardID, err)
+			} else {
+				shard.keepSession.Store(true)
+			}
+		}
+
 		err := shard.Disconnect()
+		shard.keepSession.Store(false)
 		if err != nil {
 			s.conf.Logger.Error("Disconnect error (trivial):", err)
 		}
@@ -380,12 +505,6 @@ func (s *shardMngr) Emit(cmd string, payload CmdPayload) (guildIDs []Snowflake,
 
 	switch t := payload.(type) {
 	case *RequestGuildMembersPayload:
-		if len(s.shards) == 1 {
-			for _, shard := range s.shards {
-				return t.GuildIDs, shard.Emit(cmd, payload)
-			}
-		}
-
 		requests := make(map[uint][]Snowflake)
 		for i := range t.GuildIDs {
 			shardID := GetShardForGuildID(t.GuildIDs[i], s.ShardCount())
@@ -445,11 +564,13 @@ func (s *shardMngr) HeartbeatLatencies() (latencies map[shardID]time.Duration, e
 	return
 }
 
-func (s *shardMngr) scale(code int, reason string) {
-	if s.conf.DisableAutoScaling {
-		s.conf.Logger.Debug("discord require websocket shards to scale up but auto scaling is disabled - did not handle scaling internally")
+// scale disconnects every shard, and connects them again with the shard count recommended by Discord
+func (s *shardMngr) scale(reason string) {
+	if !s.scaling.CAS(false, true) {
+		// several shards may receive 4011 at the same time
 		return
 	}
+	defer s.scalingDone()
 
 	s.conf.Logger.Error("discord require websocket shards to scale up - starting auto scaling:", reason)
 
@@ -460,18 +581,22 @@ func (s *shardMngr) scale(code int, reason string) {
 			return
 		}
 
-		_ = s.Disconnect()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_ = s.disconnectLocked()
 
 		s.conf.URL = data.URL
-		for i := uint(len(s.conf.ShardIDs) - 1); i < data.Shards; i++ {
+		for i := uint(len(s.conf.ShardIDs)); i < data.Shards; i++ {
 			s.conf.ShardIDs = append(s.conf.ShardIDs, i)
-			s.conf.ShardCount++
+		}
+		if data.Shards > s.conf.ShardCount {
+			s.conf.ShardCount = data.Shards
 		}
 		if err := s.initShards(); err != nil {
 			s.conf.Logger.Error("autoscaling", "init-shards", err)
 			return
 		}
-		if err := s.Connect(); err != nil {
+		if err := s.connectLocked(); err != nil {
 			s.conf.Logger.Error("autoscaling", "connect", err)
 		}
 	})
@@ -481,11 +606,67 @@ func (s *shardMngr) scale(code int, reason string) {
 	}
 }
 
+// scaleManually asks ShardConfig.OnScalingRequired for the new shards, when auto scaling is disabled
+func (s *shardMngr) scaleManually(reason string) {
+	if s.conf.OnScalingRequired == nil {
+		s.conf.Logger.Error("discord require websocket shards to scale up, but auto scaling is disabled and ShardConfig.OnScalingRequired is not set - the shard stays disconnected:", reason)
+		return
+	}
+	if !s.scaling.CAS(false, true) {
+		return
+	}
+	defer s.scalingDone()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conf.Logger.Info("scaling")
+
+	var newShards []uint
+	s.conf.ShardCount, newShards = s.conf.OnScalingRequired(s.ShardIDs())
+	s.conf.ShardIDs = append(s.conf.ShardIDs, newShards...)
+
+	_ = s.disconnectLocked()
+	if err := s.initShards(); err != nil {
+		s.conf.Logger.Error("scaling", "init-shards", err)
+		return
+	}
+	s.conf.Logger.Info("scaling", "connecting shards")
+	if err := s.connectLocked(); err != nil {
+		s.conf.Logger.Error("scaling", "connect", err)
+	}
+	s.conf.Logger.Info("scaling", "connected")
+}
+
+// scalingDone allows new scaling attempts, and reconnects the shards that stopped reconnecting on a 4011
+// close code without being replaced. Such shards trigger the scaling again if Discord still requires it.
+func (s *shardMngr) scalingDone() {
+	s.scaling.Store(false)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, shard := range s.shards {
+		shard.resumeAfterScaling()
+	}
+}
+
+// shardList returns the current shards. The caller must hold s.mu.
+func (s *shardMngr) shardList() []*EvtClient {
+	shards := make([]*EvtClient, 0, len(s.shards))
+	for _, shard := range s.shards {
+		shards = append(shards, shard)
+	}
+	return shards
+}
+
+// redistributeMsgs steals the queued messages of the current shards, scales, and emits the messages again.
+// The caller must not hold s.mu.
 func (s *shardMngr) redistributeMsgs(scaleShards func()) (unhandledGuildIDs []Snowflake) {
 	var messages []*clientPacket
+	s.mu.RLock()
 	for _, shard := range s.shards {
 		messages = append(messages, shard.messageQueue.Steal()...)
 	}
+	s.mu.RUnlock()
 
 	scaleShards()
 
@@ -512,6 +693,10 @@ func (s *shardMngr) redistributeMsgs(scaleShards func()) (unhandledGuildIDs []Sn
 			if rgm2, ok = m2.Data.(*RequestGuildMembersPayload); !ok {
 				continue
 			}
+			if rgm1.Nonce != rgm2.Nonce {
+				// the chunks must be correlated with the original request
+				continue
+			}
 			rgm1.GuildIDs = append(rgm1.GuildIDs, rgm2.GuildIDs...)
 			messages[j] = nil
 		}
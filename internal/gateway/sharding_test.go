@@ -68,6 +68,13 @@ func TestConfigureShardConfig(t *testing.T) {
 	if !conf.DisableAutoScaling {
 		t.Error("DisableAutoScaling should be true")
 	}
+
+	conf = ShardConfig{
+		Coordinator: NewShardCoordinatorClient("tcp", "127.0.0.1:0", "a"),
+	}
+	if err := ConfigureShardConfig(context.Background(), mock, &conf); err == nil {
+		t.Error("a Coordinator without OnScalingRequired should be rejected")
+	}
 }
 
 func TestEnableGuildSubscriptions(t *testing.T) {
@@ -235,7 +242,7 @@ func TestIdentifyRateLimiting(t *testing.T) {
 		t.Fatal("should not be able to connect")
 	case <-time.After(100 * time.Millisecond): // TODO: remove timeout, just don't know how yet
 		select {
-		case item, ok := <-mngr.sync.queue:
+		case item, ok := <-mngr.sync.queues[0]:
 			if !ok {
 				t.Fatal("queue was closed somehow")
 			}
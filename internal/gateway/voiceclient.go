@@ -41,6 +41,15 @@ type VoiceConfig struct {
 	Logger logger.Logger
 
 	SystemShutdown chan interface{}
+
+	// SpeakingListener is called when a user starts speaking in the voice channel
+	SpeakingListener func(*VoiceSpeakingUpdate)
+
+	// DisconnectListener is called when a user leaves the voice channel
+	DisconnectListener func(*VoiceClientDisconnect)
+
+	// for testing only
+	conn Conn
 }
 
 type VoiceClient struct {
@@ -49,8 +58,12 @@ type VoiceClient struct {
 
 	haveIdentifiedOnce bool
 
-	active         chan interface{}
-	SystemShutdown chan interface{}
+	// ready is kept for resumes, as the UDP connection details does not change
+	ready *VoiceReady
+
+	// active is closed once the connection is closed for good, see Active
+	active     chan interface{}
+	deactivate sync.Once
 }
 
 func NewVoiceClient(conf *VoiceConfig) (client *VoiceClient, err error) {
@@ -59,19 +72,22 @@ func NewVoiceClient(conf *VoiceConfig) (client *VoiceClient, err error) {
 	}
 
 	client = &VoiceClient{
-		conf: conf,
+		conf:   conf,
+		active: make(chan interface{}),
 	}
 	client.client, err = newClient(0, &config{
 		Logger:     conf.Logger,
 		Endpoint:   conf.Endpoint,
 		HTTPClient: conf.HTTPClient,
+		conn:       conf.conn,
 		DiscordPktPool: &sync.Pool{
 			New: func() interface{} {
 				return &DiscordPacket{}
 			},
 		},
-		messageQueueLimit: conf.MessageQueueLimit,
-		SystemShutdown:    conf.SystemShutdown,
+		messageQueueLimit:  conf.MessageQueueLimit,
+		discordErrListener: client.onDiscordClose,
+		SystemShutdown:     conf.SystemShutdown,
 	}, client.internalConnect)
 	if err != nil {
 		return nil, err
@@ -88,8 +104,27 @@ func NewVoiceClient(conf *VoiceConfig) (client *VoiceClient, err error) {
 //
 //////////////////////////////////////////////////////
 
+// Active is closed when the connection is closed for good. Either by Disconnect, or by Discord in a way that the
+// session can not be resumed. The connection resumes the session on its own in any other case.
 func (c *VoiceClient) Active() <-chan interface{} {
-	return c.SystemShutdown
+	return c.active
+}
+
+// Disconnect closes the connection for good, see Active
+func (c *VoiceClient) Disconnect() error {
+	err := c.client.Disconnect()
+	c.deactivate.Do(func() { close(c.active) })
+	return err
+}
+
+func (c *VoiceClient) onDiscordClose(code int, reason string) {
+	switch code {
+	case 4006, 4014:
+		// session no longer valid, or disconnected from the channel. The session can not be resumed, and
+		// the client does not reconnect
+		c.log.Info(c.getLogPrefix(), "voice session ended by Discord: ", reason)
+		c.deactivate.Do(func() { close(c.active) })
+	}
 }
 
 func (c *VoiceClient) setupBehaviors() {
@@ -104,6 +139,8 @@ func (c *VoiceClient) setupBehaviors() {
 			opcode.VoiceHeartbeatAck:       c.onHeartbeatAck,
 			opcode.VoiceHello:              c.onHello,
 			opcode.VoiceSessionDescription: c.onVoiceSessionDescription,
+			opcode.VoiceSpeaking:           c.onSpeaking,
+			opcode.VoiceClientDisconnect:   c.onClientDisconnect,
 		},
 	})
 
@@ -128,6 +165,9 @@ func (c *VoiceClient) onReady(v interface{}) (err error) {
 	if err = util.Unmarshal(p.Data, readyPk); err != nil {
 		return err
 	}
+	c.Lock()
+	c.ready = readyPk
+	c.Unlock()
 
 	if ch := c.onceChannels.Acquire(opcode.VoiceReady); ch != nil {
 		ch <- readyPk
@@ -138,16 +178,13 @@ func (c *VoiceClient) onReady(v interface{}) (err error) {
 }
 
 func (c *VoiceClient) onResumed(v interface{}) (err error) {
-	p := v.(*DiscordPacket)
-
-	resumedPk := &voicePacket{}
-	if err = util.Unmarshal(p.Data, resumedPk); err != nil {
-		return err
-	}
+	// the UDP connection is unchanged by a resume, so the connection is ready as before
+	c.RLock()
+	ready := c.ready
+	c.RUnlock()
 
-	// TODO: use resumed instead..
 	if ch := c.onceChannels.Acquire(opcode.VoiceReady); ch != nil {
-		ch <- resumedPk
+		ch <- ready
 	} else {
 		panic("once channel for Resumed was missing")
 	}
@@ -180,18 +217,11 @@ func (c *VoiceClient) onHello(v interface{}) (err error) {
 	if err = util.Unmarshal(p.Data, helloPk); err != nil {
 		return err
 	}
-	interval := uint(helloPk.HeartbeatInterval)
 	c.Lock()
-	if interval == c.heartbeatInterval {
-		c.Unlock()
-		return nil
-	} else if c.heartbeatInterval > 0 {
-		c.Unlock()
-		return errors.New("a new hello packet was sent, with a different interval - please make a github issue at https://github.com/andersfylling/disgord")
-	}
-	c.heartbeatInterval = interval
+	c.heartbeatInterval = uint(helloPk.HeartbeatInterval)
 	c.Unlock()
 
+	// identify on the first connection, and resume on any reconnect
 	c.sendVoiceHelloPacket()
 	c.activateHeartbeats <- true
 	return nil
@@ -211,6 +241,36 @@ func (c *VoiceClient) onVoiceSessionDescription(v interface{}) (err error) {
 	return nil
 }
 
+func (c *VoiceClient) onSpeaking(v interface{}) (err error) {
+	if c.conf.SpeakingListener == nil {
+		return nil
+	}
+	p := v.(*DiscordPacket)
+
+	speakingPk := &VoiceSpeakingUpdate{}
+	if err = util.Unmarshal(p.Data, speakingPk); err != nil {
+		return err
+	}
+
+	c.conf.SpeakingListener(speakingPk)
+	return nil
+}
+
+func (c *VoiceClient) onClientDisconnect(v interface{}) (err error) {
+	if c.conf.DisconnectListener == nil {
+		return nil
+	}
+	p := v.(*DiscordPacket)
+
+	disconnectPk := &VoiceClientDisconnect{}
+	if err = util.Unmarshal(p.Data, disconnectPk); err != nil {
+		return err
+	}
+
+	c.conf.DisconnectListener(disconnectPk)
+	return nil
+}
+
 //////////////////////////////////////////////////////
 //
 // BEHAVIOR: heartbeat
@@ -264,8 +324,10 @@ func (c *VoiceClient) internalConnect() (evt interface{}, err error) {
 		return nil, err
 	}
 
-	var ctx context.Context
-	ctx, c.cancel = context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Lock()
+	c.cancel = cancel
+	c.Unlock()
 
 	// we can now interact with Discord
 	c.haveConnectedOnce.Store(true)
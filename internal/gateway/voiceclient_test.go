@@ -0,0 +1,202 @@
+// +build !integration
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"github.com/andersfylling/disgord/internal/gateway/opcode"
+	"github.com/andersfylling/disgord/internal/logger"
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+// voiceTestConn is a scripted voice websocket. Discord packets and close errors are pushed through reading,
+// while everything written by the client is sent to writing.
+type voiceTestConn struct {
+	opening     chan interface{}
+	writing     chan *DiscordPacket
+	reading     chan interface{}
+	isConnected atomic.Bool
+}
+
+func (g *voiceTestConn) Open(ctx context.Context, endpoint string, requestHeader http.Header) (err error) {
+	g.isConnected.Store(true)
+	g.opening <- 1
+	return
+}
+
+func (g *voiceTestConn) WriteJSON(v interface{}) (err error) {
+	var data []byte
+	if data, err = util.Marshal(v); err != nil {
+		return err
+	}
+	p := &DiscordPacket{}
+	if err = util.Unmarshal(data, p); err != nil {
+		return err
+	}
+	g.writing <- p
+	return
+}
+
+func (g *voiceTestConn) WriteBinary(data []byte) (err error) {
+	return nil
+}
+
+func (g *voiceTestConn) Close() (err error) {
+	g.isConnected.Store(false)
+	return
+}
+
+func (g *voiceTestConn) Read(ctx context.Context) (packet []byte, err error) {
+	select {
+	case v := <-g.reading:
+		if err, ok := v.(error); ok {
+			g.isConnected.Store(false)
+			return nil, err
+		}
+		return v.([]byte), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *voiceTestConn) Disconnected() bool {
+	return !g.isConnected.Load()
+}
+
+var _ Conn = (*voiceTestConn)(nil)
+
+func (g *voiceTestConn) send(t *testing.T, op opcode.OpCode, data interface{}) {
+	raw, err := util.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := util.Marshal(&struct {
+		Op   opcode.OpCode   `json:"op"`
+		Data json.RawMessage `json:"d"`
+	}{op, raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.reading <- packet
+}
+
+func (g *voiceTestConn) expectOpen(t *testing.T) {
+	select {
+	case <-g.opening:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not opened")
+	}
+}
+
+// expectWrite skips heartbeats, as they are sent at random
+func (g *voiceTestConn) expectWrite(t *testing.T, op opcode.OpCode) *DiscordPacket {
+	for {
+		select {
+		case p := <-g.writing:
+			if p.Op == opcode.VoiceHeartbeat {
+				continue
+			}
+			if p.Op != op {
+				t.Fatalf("expected opcode %d to be sent. Got %d", op, p.Op)
+			}
+			return p
+		case <-time.After(5 * time.Second):
+			t.Fatalf("opcode %d was not sent", op)
+		}
+	}
+}
+
+func TestVoiceClient_Resume(t *testing.T) {
+	conn := &voiceTestConn{
+		opening: make(chan interface{}, 1),
+		writing: make(chan *DiscordPacket, 10),
+		reading: make(chan interface{}),
+	}
+	shutdown := make(chan interface{})
+	defer close(shutdown)
+
+	voice, err := NewVoiceClient(&VoiceConfig{
+		GuildID:        486833611564253184,
+		UserID:         228846961774559232,
+		SessionID:      "session",
+		Token:          "token",
+		Endpoint:       "wss://localhost/?v=4",
+		Logger:         logger.Empty{},
+		SystemShutdown: shutdown,
+		conn:           conn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type hello struct {
+		HeartbeatInterval uint `json:"heartbeat_interval"`
+	}
+	type ready struct {
+		SSRC uint32 `json:"ssrc"`
+		IP   string `json:"ip"`
+		Port int    `json:"port"`
+	}
+
+	connected := make(chan *VoiceReady, 1)
+	go func() {
+		rdy, err := voice.Connect()
+		if err != nil {
+			t.Error(err)
+		}
+		connected <- rdy
+	}()
+	conn.expectOpen(t)
+	conn.send(t, opcode.VoiceHello, &hello{HeartbeatInterval: 40000})
+	conn.expectWrite(t, opcode.VoiceIdentify)
+	conn.send(t, opcode.VoiceReady, &ready{SSRC: 3, IP: "127.0.0.1", Port: 4})
+
+	select {
+	case rdy := <-connected:
+		if rdy == nil || rdy.SSRC != 3 {
+			t.Fatalf("unexpected ready event %+v", rdy)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("voice client did not connect")
+	}
+
+	// the voice server crashed, which is resumable
+	conn.reading <- NewCloseErr(4015, "voice server crashed")
+	conn.expectOpen(t)
+	conn.send(t, opcode.VoiceHello, &hello{HeartbeatInterval: 40000})
+	resume := conn.expectWrite(t, opcode.VoiceResume)
+
+	var resumeData struct {
+		GuildID   Snowflake `json:"server_id"`
+		SessionID string    `json:"session_id"`
+		Token     string    `json:"token"`
+	}
+	if err = util.Unmarshal(resume.Data, &resumeData); err != nil {
+		t.Fatal(err)
+	}
+	if resumeData.GuildID != 486833611564253184 || resumeData.SessionID != "session" || resumeData.Token != "token" {
+		t.Errorf("unexpected resume payload %+v", resumeData)
+	}
+	conn.send(t, opcode.VoiceResumed, nil)
+
+	select {
+	case <-voice.Active():
+		t.Fatal("a resumed voice connection should still be active")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// kicked from the channel, which ends the session
+	conn.reading <- NewCloseErr(4014, "disconnected")
+	select {
+	case <-voice.Active():
+	case <-time.After(5 * time.Second):
+		t.Fatal("voice connection should be inactive after a 4014 close")
+	}
+}
@@ -9,15 +9,49 @@ import (
 
 type Snowflake = util.Snowflake
 
+// Conn is the websocket connection of a shard or voice client. The same Conn is opened again after
+// it has been closed, whenever the client reconnects.
+//
+// Read returns the next text or binary payload, and must return a *CloseErr when the connection is
+// closed by Discord, see NewCloseErr. Cancelling the context given to Read may close the connection.
+// Connections that also implement CloseKeepSession() error are closed without invalidating the session
+// when the client wants to resume.
 type Conn interface {
 	Close() error
 	Open(ctx context.Context, endpoint string, requestHeader http.Header) error
 	WriteJSON(v interface{}) error
+	WriteBinary(data []byte) error
 	Read(ctx context.Context) (packet []byte, err error)
 
 	Disconnected() bool
 }
 
+// ConnConfig holds the settings for creating a Conn
+type ConnConfig struct {
+	ShardID    uint
+	HTTPClient *http.Client
+
+	// TransportCompression is true when the endpoint uses compress=zlib-stream. The binary messages must
+	// then be inflated using a single zlib context for the whole connection. The built-in connections
+	// handles this, while other implementations should return an error if they do not.
+	TransportCompression bool
+}
+
+// NewConnFunc creates the websocket connection of a client. See NewNhooyrConn and NewGorillaConn for
+// the built-in implementations.
+type NewConnFunc = func(conf ConnConfig) (Conn, error)
+
+// sessionKeeper is implemented by connections that can close without Discord invalidating the
+// session. Discord invalidates the session when the connection is closed with 1000 or 1001.
+type sessionKeeper interface {
+	CloseKeepSession() error
+}
+
+// NewCloseErr creates the error that Conn.Read must return when Discord closes the connection
+func NewCloseErr(code int, info string) *CloseErr {
+	return &CloseErr{code: code, info: info}
+}
+
 type CloseErr struct {
 	code int
 	info string
@@ -27,6 +61,11 @@ func (e *CloseErr) Error() string {
 	return e.info
 }
 
+// Code returns the websocket close code
+func (e *CloseErr) Code() int {
+	return e.code
+}
+
 // WebsocketErr is used internally when the websocket package returns an error. It does not represent a Discord error!
 type WebsocketErr struct {
 	ID      uint
@@ -39,4 +78,21 @@ func (e *WebsocketErr) Error() string {
 
 const (
 	encodingJSON = "json"
+	encodingETF  = "etf"
 )
+
+// decodeBinary inflates a binary websocket message. The payload is incomplete when a zlib-stream payload
+// spans several websocket messages, and the remaining messages must be read first.
+//
+// Uncompressed ETF payloads are only detected without zlib-stream, as a compressed message can start with any byte.
+func decodeBinary(stream *zlibStream, packet []byte) (payload []byte, complete bool, err error) {
+	if stream != nil {
+		return stream.decompress(packet)
+	}
+	if len(packet) > 0 && packet[0] == etfVersion {
+		// uncompressed ETF payload
+		return packet, true, nil
+	}
+	payload, err = decompressBytes(packet)
+	return payload, true, err
+}
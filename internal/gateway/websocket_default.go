@@ -0,0 +1,7 @@
+// +build !disgord_websocket_gorilla
+
+package gateway
+
+func newConn(conf ConnConfig) (Conn, error) {
+	return NewNhooyrConn(conf)
+}
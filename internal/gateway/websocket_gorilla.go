@@ -0,0 +1,164 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/atomic"
+
+	"github.com/andersfylling/disgord/internal/util"
+)
+
+// NewGorillaConn creates a Conn using github.com/gorilla/websocket. The proxy and TLS settings are taken
+// from the transport of the http client, when it is a *http.Transport.
+func NewGorillaConn(conf ConnConfig) (Conn, error) {
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+	}
+	if conf.HTTPClient != nil {
+		if transport, ok := conf.HTTPClient.Transport.(*http.Transport); ok {
+			dialer.Proxy = transport.Proxy
+			dialer.NetDialContext = transport.DialContext
+			dialer.TLSClientConfig = transport.TLSClientConfig
+		}
+	}
+
+	conn := &gorilla{
+		dialer: dialer,
+	}
+	if conf.TransportCompression {
+		conn.zlibStream = newZlibStream()
+	}
+	return conn, nil
+}
+
+type gorilla struct {
+	c           *websocket.Conn
+	dialer      *websocket.Dialer
+	isConnected atomic.Bool
+
+	// gorilla supports one concurrent writer
+	writeMu sync.Mutex
+
+	// zlibStream is nil unless the connection uses zlib-stream transport compression
+	zlibStream *zlibStream
+}
+
+func (g *gorilla) Open(ctx context.Context, endpoint string, requestHeader http.Header) (err error) {
+	if g.zlibStream != nil {
+		// a new connection means a new compression context
+		g.zlibStream.reset()
+	}
+
+	// establish ws connection
+	g.c, _, err = g.dialer.DialContext(ctx, endpoint, requestHeader)
+	if err != nil {
+		if g.c != nil {
+			_ = g.c.Close()
+		}
+		return err
+	}
+	g.isConnected.Store(true)
+
+	g.c.SetReadLimit(32768 * 10000)
+	return
+}
+
+func (g *gorilla) WriteJSON(v interface{}) (err error) {
+	g.writeMu.Lock()
+	defer g.writeMu.Unlock()
+
+	w, err := g.c.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	return util.JSONEncode(w, v)
+}
+
+func (g *gorilla) WriteBinary(data []byte) (err error) {
+	g.writeMu.Lock()
+	defer g.writeMu.Unlock()
+	return g.c.WriteMessage(websocket.BinaryMessage, data)
+}
+
+func (g *gorilla) close(code int, reason string) (err error) {
+	if g.c == nil {
+		return nil // never opened
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	deadline := time.Now().Add(5 * time.Second)
+	_ = g.c.WriteControl(websocket.CloseMessage, msg, deadline)
+
+	err = g.c.Close()
+	if !g.isConnected.Load() {
+		err = nil // discard error if we're already closed, should be a noop anyways
+	}
+	g.isConnected.Store(false)
+	return err
+}
+
+func (g *gorilla) Close() (err error) {
+	return g.close(websocket.CloseNormalClosure, "Bot is shutting down")
+}
+
+func (g *gorilla) CloseKeepSession() (err error) {
+	return g.close(websocket.CloseServiceRestart, "Bot is restarting")
+}
+
+func (g *gorilla) Read(ctx context.Context) (packet []byte, err error) {
+	// gorilla does not support cancelling reads, so a passed read deadline is used instead
+	done := make(chan interface{})
+	defer close(done)
+	go func(c *websocket.Conn) {
+		select {
+		case <-ctx.Done():
+			_ = c.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}(g.c)
+
+	for {
+		var messageType int
+		messageType, packet, err = g.c.ReadMessage()
+		if err != nil {
+			// gorilla can not recover from a failed read, so the connection is unusable either way
+			g.isConnected.Store(false)
+			if ctx.Err() != nil {
+				_ = g.c.Close()
+				return nil, context.Canceled
+			}
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				err = &CloseErr{
+					code: closeErr.Code,
+					info: closeErr.Error(),
+				}
+			}
+			return nil, err
+		}
+
+		if messageType != websocket.BinaryMessage {
+			return packet, nil
+		}
+
+		var complete bool
+		if packet, complete, err = decodeBinary(g.zlibStream, packet); err != nil {
+			return nil, err
+		} else if complete {
+			return packet, nil
+		}
+		// partial payload, wait for the remaining websocket messages
+	}
+}
+
+func (g *gorilla) Disconnected() bool {
+	return !g.isConnected.Load()
+}
+
+var _ Conn = (*gorilla)(nil)
+var _ sessionKeeper = (*gorilla)(nil)
@@ -0,0 +1,88 @@
+// +build !integration
+
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andersfylling/disgord/disgordtest"
+	"github.com/andersfylling/disgord/internal/gateway/opcode"
+)
+
+func TestGorillaConn(t *testing.T) {
+	gw := disgordtest.NewGateway(&disgordtest.GatewayConfig{
+		Token:  "test",
+		Guilds: []Snowflake{486833611564253184},
+	})
+	defer gw.Close()
+
+	var conns int
+	shard, eChan, shutdown := newFakeGatewayShard(t, gw, func(conf ConnConfig) (Conn, error) {
+		conns++
+		return NewGorillaConn(conf)
+	})
+	defer close(shutdown)
+	if conns != 1 {
+		t.Fatalf("expected one connection to be created. Got %d", conns)
+	}
+
+	if err := shard.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, eChan, "READY", "GUILD_CREATE")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := gw.CloseShard(0, disgordtest.CloseGoingAway, "going away"); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, eChan, "RESUMED")
+	if err := gw.WaitForShard(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Dispatch(0, "MESSAGE_CREATE", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, eChan, "MESSAGE_CREATE")
+	if conns != 1 {
+		t.Errorf("expected the connection to be reused. Got %d connections", conns)
+	}
+}
+
+func TestGorillaConn_CloseErr(t *testing.T) {
+	gw := disgordtest.NewGateway(&disgordtest.GatewayConfig{Token: "test"})
+	defer gw.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := NewGorillaConn(ConnConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conn.Disconnected() {
+		t.Error("connection should be disconnected before Open")
+	}
+	if err = conn.Open(ctx, gw.URL()+"?v=6&encoding=json", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Read(ctx); err != nil { // hello
+		t.Fatal(err)
+	}
+
+	// authenticating is required before anything else
+	if err = conn.WriteJSON(&clientPacket{Op: opcode.EventStatusUpdate, Data: struct{}{}}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Read(ctx)
+	closeErr, ok := err.(*CloseErr)
+	if !ok || closeErr.Code() != disgordtest.CloseNotAuthenticated {
+		t.Errorf("expected close code %d. Got %v", disgordtest.CloseNotAuthenticated, err)
+	}
+	if !conn.Disconnected() {
+		t.Error("connection should be disconnected after being closed")
+	}
+}
@@ -15,19 +15,33 @@ import (
 	"nhooyr.io/websocket"
 )
 
-func newConn(httpClient *http.Client) (Conn, error) {
-	return &nhooyr{
-		httpClient: httpClient,
-	}, nil
+// NewNhooyrConn creates a Conn using nhooyr.io/websocket. This is the default, unless Disgord is built
+// with the disgord_websocket_gorilla build tag.
+func NewNhooyrConn(conf ConnConfig) (Conn, error) {
+	conn := &nhooyr{
+		httpClient: conf.HTTPClient,
+	}
+	if conf.TransportCompression {
+		conn.zlibStream = newZlibStream()
+	}
+	return conn, nil
 }
 
 type nhooyr struct {
 	c           *websocket.Conn
 	httpClient  *http.Client
 	isConnected atomic.Bool
+
+	// zlibStream is nil unless the connection uses zlib-stream transport compression
+	zlibStream *zlibStream
 }
 
 func (g *nhooyr) Open(ctx context.Context, endpoint string, requestHeader http.Header) (err error) {
+	if g.zlibStream != nil {
+		// a new connection means a new compression context
+		g.zlibStream.reset()
+	}
+
 	// establish ws connection
 	g.c, _, err = websocket.Dial(ctx, endpoint, &websocket.DialOptions{
 		HTTPClient: g.httpClient,
@@ -56,7 +70,14 @@ func (g *nhooyr) WriteJSON(v interface{}) (err error) {
 	return
 }
 
+func (g *nhooyr) WriteBinary(data []byte) (err error) {
+	return g.c.Write(context.Background(), websocket.MessageBinary, data)
+}
+
 func (g *nhooyr) Close() (err error) {
+	if g.c == nil {
+		return nil // never opened
+	}
 	err = g.c.Close(websocket.StatusNormalClosure, "Bot is shutting down")
 	if !g.isConnected.Load() {
 		err = nil // discard error if we're already closed, should be a noop anyways
@@ -65,31 +86,52 @@ func (g *nhooyr) Close() (err error) {
 	return err
 }
 
+func (g *nhooyr) CloseKeepSession() (err error) {
+	if g.c == nil {
+		return nil // never opened
+	}
+	err = g.c.Close(websocket.StatusServiceRestart, "Bot is restarting")
+	if !g.isConnected.Load() {
+		err = nil
+	}
+	g.isConnected.Store(false)
+	return err
+}
+
 func (g *nhooyr) Read(ctx context.Context) (packet []byte, err error) {
-	var messageType websocket.MessageType
-	messageType, packet, err = g.c.Read(ctx)
-	if err != nil {
-		// Cancelling Read by ctx results in closed WS, see issue
-		// https://github.com/nhooyr/websocket/issues/242
-		if ctx.Err() != nil && errors.Is(err, context.Canceled) {
-			g.isConnected.Store(false)
-			return nil, context.Canceled
-		}
-		var closeErr websocket.CloseError
-		if errors.As(err, &closeErr) {
-			g.isConnected.Store(false)
-			err = &CloseErr{
-				code: int(closeErr.Code),
-				info: closeErr.Error(),
+	for {
+		var messageType websocket.MessageType
+		messageType, packet, err = g.c.Read(ctx)
+		if err != nil {
+			// Cancelling Read by ctx results in closed WS, see issue
+			// https://github.com/nhooyr/websocket/issues/242
+			if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+				g.isConnected.Store(false)
+				return nil, context.Canceled
 			}
+			var closeErr websocket.CloseError
+			if errors.As(err, &closeErr) {
+				g.isConnected.Store(false)
+				err = &CloseErr{
+					code: int(closeErr.Code),
+					info: closeErr.Error(),
+				}
+			}
+			return nil, err
 		}
-		return nil, err
-	}
 
-	if messageType == websocket.MessageBinary {
-		packet, err = decompressBytes(packet)
+		if messageType != websocket.MessageBinary {
+			return packet, nil
+		}
+
+		var complete bool
+		if packet, complete, err = decodeBinary(g.zlibStream, packet); err != nil {
+			return nil, err
+		} else if complete {
+			return packet, nil
+		}
+		// partial payload, wait for the remaining websocket messages
 	}
-	return packet, nil
 }
 
 func (g *nhooyr) Disconnected() bool {
@@ -97,3 +139,4 @@ func (g *nhooyr) Disconnected() bool {
 }
 
 var _ Conn = (*nhooyr)(nil)
+var _ sessionKeeper = (*nhooyr)(nil)
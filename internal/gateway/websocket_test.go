@@ -0,0 +1,36 @@
+// +build !integration
+
+package gateway
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConn_CloseUnopened(t *testing.T) {
+	newConns := map[string]NewConnFunc{
+		"nhooyr":  NewNhooyrConn,
+		"gorilla": NewGorillaConn,
+	}
+	for name, newConn := range newConns {
+		t.Run(name, func(t *testing.T) {
+			conn, err := newConn(ConnConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a voice connection is closed when it fails to open, eg. when the voice server is unreachable
+			if err = conn.Open(context.Background(), "ws://127.0.0.1:1", nil); err == nil {
+				t.Fatal("expected the connection to be refused")
+			}
+			if err = conn.Close(); err != nil {
+				t.Errorf("expected closing an unopened connection to be a noop. Got %v", err)
+			}
+			if keeper, ok := conn.(sessionKeeper); ok {
+				if err = keeper.CloseKeepSession(); err != nil {
+					t.Errorf("expected closing an unopened connection to be a noop. Got %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+)
+
+// zlibStreamSuffix is the Z_SYNC_FLUSH marker Discord appends to every complete payload
+// when the connection uses zlib-stream transport compression.
+var zlibStreamSuffix = []byte{0x00, 0x00, 0xff, 0xff}
+
+// zlibStreamWindow is the maximum back reference distance of a deflate stream
+const zlibStreamWindow = 32 * 1024
+
+func newZlibStream() *zlibStream {
+	return &zlibStream{}
+}
+
+// zlibStream inflates the zlib-stream transport compression. Discord uses one compression
+// context for the lifetime of a websocket connection, so every payload depends on the
+// previous ones, and a payload might be split across several websocket messages.
+//
+// The inflate context must be reset whenever a new connection is established.
+type zlibStream struct {
+	buffer   bytes.Buffer
+	input    bytes.Reader
+	inflater io.ReadCloser
+	window   []byte
+}
+
+// reset drops any partial payload and the inflate context. Must be called on reconnect.
+func (z *zlibStream) reset() {
+	z.buffer.Reset()
+	z.input.Reset(nil)
+	z.inflater = nil
+	z.window = z.window[:0]
+}
+
+// decompress buffers a binary websocket message. Once the buffered data ends with the zlib
+// flush suffix, the payload is inflated and returned with complete set to true. Otherwise
+// the message was a partial payload and more messages must be read.
+func (z *zlibStream) decompress(message []byte) (payload []byte, complete bool, err error) {
+	z.buffer.Write(message)
+	if !bytes.HasSuffix(z.buffer.Bytes(), zlibStreamSuffix) {
+		return nil, false, nil
+	}
+	defer z.buffer.Reset()
+
+	data := z.buffer.Bytes()
+	if z.inflater == nil {
+		if data, err = stripZlibHeader(data); err != nil {
+			return nil, false, err
+		}
+	}
+
+	z.input.Reset(data)
+	if z.inflater == nil {
+		z.inflater = flate.NewReader(&z.input)
+	} else if err = z.inflater.(flate.Resetter).Reset(&z.input, z.window); err != nil {
+		return nil, false, err
+	}
+
+	// the stream never ends, so the inflater reports an unexpected EOF once it has
+	// consumed the sync flush and tries to read the next block header.
+	output := new(bytes.Buffer)
+	if _, err = output.ReadFrom(z.inflater); err != nil && !(errors.Is(err, io.ErrUnexpectedEOF) && z.input.Len() == 0) {
+		return nil, false, err
+	}
+	payload = output.Bytes()
+
+	// later payloads can reference the data of previous ones
+	z.window = append(z.window, payload...)
+	if len(z.window) > zlibStreamWindow {
+		z.window = append(z.window[:0], z.window[len(z.window)-zlibStreamWindow:]...)
+	}
+	return payload, true, nil
+}
+
+// stripZlibHeader validates and removes the two byte zlib header found at the start of the stream.
+func stripZlibHeader(data []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, errors.New("zlib-stream: missing zlib header")
+	}
+	cmf, flg := data[0], data[1]
+	if cmf&0x0f != 8 || (uint16(cmf)<<8|uint16(flg))%31 != 0 {
+		return nil, errors.New("zlib-stream: invalid zlib header")
+	}
+	if flg&0x20 != 0 {
+		return nil, errors.New("zlib-stream: preset dictionaries are not supported")
+	}
+	return data[2:], nil
+}
@@ -0,0 +1,155 @@
+// +build !integration
+
+package gateway
+
+import (
+	"bytes"
+	"compress/zlib"
+	"testing"
+)
+
+func compressZlibStream(t *testing.T, payloads ...string) (frames [][]byte) {
+	var buffer bytes.Buffer
+	w := zlib.NewWriter(&buffer)
+	for _, payload := range payloads {
+		if _, err := w.Write([]byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		frame := make([]byte, buffer.Len())
+		copy(frame, buffer.Bytes())
+		frames = append(frames, frame)
+		buffer.Reset()
+	}
+	return frames
+}
+
+func TestZlibStream_decompress(t *testing.T) {
+	payloads := []string{
+		`{"t":null,"s":null,"op":10,"d":{"heartbeat_interval":41250}}`,
+		`{"t":"READY","s":1,"op":0,"d":{"session_id":"abc"}}`,
+		`{"t":"GUILD_CREATE","s":2,"op":0,"d":{"id":"1","name":"guild"}}`,
+		`{"t":"GUILD_CREATE","s":3,"op":0,"d":{"id":"2","name":"guild"}}`,
+	}
+
+	t.Run("complete frames", func(t *testing.T) {
+		stream := newZlibStream()
+		for i, frame := range compressZlibStream(t, payloads...) {
+			payload, complete, err := stream.decompress(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !complete {
+				t.Fatalf("frame %d should be complete", i)
+			}
+			if string(payload) != payloads[i] {
+				t.Errorf("frame %d: got %s, wants %s", i, string(payload), payloads[i])
+			}
+		}
+	})
+
+	t.Run("partial frames", func(t *testing.T) {
+		stream := newZlibStream()
+		for i, frame := range compressZlibStream(t, payloads...) {
+			half := len(frame) / 2
+			if _, complete, err := stream.decompress(frame[:half]); err != nil {
+				t.Fatal(err)
+			} else if complete {
+				t.Fatalf("frame %d should be partial", i)
+			}
+
+			payload, complete, err := stream.decompress(frame[half:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !complete {
+				t.Fatalf("frame %d should be complete", i)
+			}
+			if string(payload) != payloads[i] {
+				t.Errorf("frame %d: got %s, wants %s", i, string(payload), payloads[i])
+			}
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		stream := newZlibStream()
+		for i := 0; i < 2; i++ {
+			frames := compressZlibStream(t, payloads...)
+			if _, _, err := stream.decompress(frames[0][:3]); err != nil {
+				t.Fatal(err)
+			}
+			stream.reset()
+
+			for j, frame := range frames {
+				payload, _, err := stream.decompress(frame)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(payload) != payloads[j] {
+					t.Errorf("frame %d: got %s, wants %s", j, string(payload), payloads[j])
+				}
+			}
+			stream.reset()
+		}
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		stream := newZlibStream()
+		if _, _, err := stream.decompress(append([]byte{0x01, 0x02}, zlibStreamSuffix...)); err == nil {
+			t.Error("expected an error on invalid zlib header")
+		}
+	})
+}
+
+func TestGatewayEndpoint(t *testing.T) {
+	conf := &EvtConfig{
+		Endpoint:             "wss://gateway.discord.gg",
+		Version:              6,
+		Encoding:             "json",
+		TransportCompression: true,
+	}
+	wants := "wss://gateway.discord.gg?compress=zlib-stream&encoding=json&v=6"
+	if got := gatewayEndpoint(conf); got != wants {
+		t.Errorf("got %s, wants %s", got, wants)
+	}
+
+	conf.TransportCompression = false
+	wants = "wss://gateway.discord.gg?encoding=json&v=6"
+	if got := gatewayEndpoint(conf); got != wants {
+		t.Errorf("got %s, wants %s", got, wants)
+	}
+}
+
+func TestDecodeBinary_zlibStreamETFVersionByte(t *testing.T) {
+	// stored deflate blocks keep the payload as is, so the second message starts with the ETF version byte
+	payload := string([]byte{etfVersion}) + "payload"
+	var buffer bytes.Buffer
+	w, _ := zlib.NewWriterLevel(&buffer, zlib.NoCompression)
+	if _, err := w.Write([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	frame := buffer.Bytes()
+	split := bytes.IndexByte(frame, etfVersion)
+	if split <= 0 {
+		t.Fatal("expected the frame to contain the payload")
+	}
+
+	stream := newZlibStream()
+	if _, complete, err := decodeBinary(stream, frame[:split]); err != nil {
+		t.Fatal(err)
+	} else if complete {
+		t.Fatal("first message should be partial")
+	}
+	got, complete, err := decodeBinary(stream, frame[split:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !complete || string(got) != payload {
+		t.Errorf("got %q (complete: %t), wants %q", got, complete, payload)
+	}
+}
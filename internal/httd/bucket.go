@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/andersfylling/disgord/internal/logger"
 	"github.com/andersfylling/disgord/internal/util"
 )
 
@@ -16,6 +17,7 @@ func newLeakyBucket(global *ltBucket) (b *ltBucket) {
 		remaining: -1,
 		resetTime: time.Now(),
 		global:    global,
+		log:       logger.Empty{},
 	}
 
 	return b
@@ -40,6 +42,14 @@ type ltBucket struct {
 	// this bucket is global if this.global is nil or this == this.global
 	global      *ltBucket
 	usingGlobal bool
+
+	// store shares the rate limit info with other clients, when set. The bucket is stored by the discord
+	// hash, and by the local hash until the discord hash is known.
+	store RESTBucketStore
+	key   string // local hash
+
+	// log reports store errors. The local bucket state is used when the store fails.
+	log logger.Logger
 }
 
 var _ RESTBucket = (*ltBucket)(nil)
@@ -127,13 +137,25 @@ func (b *ltBucket) Transaction(ctx context.Context, do bucketTransaction) (resp
 	if bucket.resetTime.After(now) && bucket.remaining == 0 {
 		wait = bucket.resetTime.Sub(now)
 	}
-	if deadline, ok := ctx.Deadline(); ok && deadline.Before(time.Now().Add(wait)) {
-		return nil, nil, errors.New("time out, bucket resets in " + wait.String())
+	if err = waitForReset(ctx, wait); err != nil {
+		return nil, nil, err
 	}
-	select {
-	case <-ctx.Done():
-		return nil, nil, errors.New("time out")
-	case <-time.After(wait):
+
+	// other clients sharing the store might have used up the bucket in the mean time
+	if b.store != nil {
+		for {
+			if wait, err = b.store.Reserve(ctx, b.storeKeys()[0]); err != nil {
+				// the local state was already respected, so an unreachable store must not stop the request
+				b.log.Error("rest bucket store reserve failed, using the local rate limit instead:", err)
+				break
+			}
+			if wait == 0 {
+				break
+			}
+			if err = waitForReset(ctx, wait); err != nil {
+				return nil, nil, err
+			}
+		}
 	}
 
 	// send request
@@ -144,17 +166,62 @@ func (b *ltBucket) Transaction(ctx context.Context, do bucketTransaction) (resp
 
 	// update ltBucket info
 	// reduce remaining if needed
-	if !b.updateAfterRequest(resp.Header, resp.StatusCode) && bucket.remaining > 0 {
+	if updated := b.updateAfterRequest(resp.Header, resp.StatusCode); updated != nil {
+		if b.store != nil {
+			// a failed update only means the other clients must learn the rate limit on their own
+			state := updated.state()
+			for _, key := range updated.storeKeys() {
+				_ = b.store.Update(ctx, key, state)
+			}
+		}
+	} else if bucket.remaining > 0 {
 		bucket.remaining--
 	}
 
 	return resp, body, nil
 }
 
+func waitForReset(ctx context.Context, wait time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(time.Now().Add(wait)) {
+		return errors.New("time out, bucket resets in " + wait.String())
+	}
+	select {
+	case <-ctx.Done():
+		return errors.New("time out")
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// storeKeys returns the keys of the bucket in the RESTBucketStore, the first one being used for reservations
+func (b *ltBucket) storeKeys() []string {
+	if b.global == nil || b == b.global {
+		return []string{GlobalHash}
+	}
+	if b.hash == "" || b.hash == b.key {
+		return []string{b.key}
+	}
+	return []string{b.hash, b.key}
+}
+
+func (b *ltBucket) state() RESTBucketState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return RESTBucketState{
+		Remaining:    b.remaining,
+		Reset:        b.resetTime,
+		DiscordReset: b.discordResetTime,
+	}
+}
+
 // updateAfterRequests updates the bucket with the latest rate limit info from http responses.
 //
+// The bucket that had its remaining requests adjusted is returned, which is the global bucket on global
+// rate limits. Nil is returned when the header did not hold any newer information.
+//
 // Note! you must call NormalizeDiscordHeader before using this.
-func (b *ltBucket) updateAfterRequest(header http.Header, statusCode int) (adjustedRemaining bool) {
+func (b *ltBucket) updateAfterRequest(header http.Header, statusCode int) (adjusted *ltBucket) {
 	if normalized := header.Get(DisgordNormalizedHeader); normalized == "" {
 		panic("headers were not normalized to use milliseconds")
 	}
@@ -220,7 +287,7 @@ func (b *ltBucket) updateAfterRequest(header http.Header, statusCode int) (adjus
 	}
 
 	if discordReset.Before(time.Unix(0, int64(time.Hour))) {
-		return false
+		return nil
 	}
 
 	// TODO: this can be simpler
@@ -230,17 +297,17 @@ func (b *ltBucket) updateAfterRequest(header http.Header, statusCode int) (adjus
 		bucket.discordResetTime = discordReset
 		bucket.remaining = remaining
 		bucket.updatedAt = discordTime
-		adjustedRemaining = true
+		adjusted = bucket
 	} else if bucket.discordResetTime == discordReset {
 		if bucket.remaining == -1 || bucket.remaining > remaining {
 			bucket.remaining = remaining
 			bucket.updatedAt = discordTime
 			bucket.discordResetTime = discordReset
-			adjustedRemaining = true
+			adjusted = bucket
 		}
 	}
 
-	return adjustedRemaining
+	return adjusted
 }
 
 func (b *ltBucket) active() bool {
@@ -2,6 +2,8 @@ package httd
 
 import (
 	"sync"
+
+	"github.com/andersfylling/disgord/internal/logger"
 )
 
 const GlobalHash = "global"
@@ -20,13 +22,23 @@ func relationsByBucketID(relations map[string]string) map[string][]string {
 }
 
 func NewManager(defaultRelations map[string]string) *Manager {
+	return NewManagerWithStore(defaultRelations, nil)
+}
+
+// NewManagerWithStore creates a manager that shares the rate limit info of every bucket through the store,
+// such that several clients using the same bot token can respect the rate limits together. The bucket
+// state is only kept in memory when store is nil.
+func NewManagerWithStore(defaultRelations map[string]string, store RESTBucketStore) *Manager {
 	global := newLeakyBucket(nil)
 	global.hash = GlobalHash
+	global.store = store
 
 	m := &Manager{
 		proxy:   make(map[string]string),
 		buckets: make(map[string]*ltBucket),
 		global:  global,
+		store:   store,
+		log:     global.log,
 	}
 
 	hashRelations := relationsByBucketID(defaultRelations)
@@ -35,7 +47,7 @@ func NewManager(defaultRelations map[string]string) *Manager {
 		if hash == GlobalHash {
 			bucket = m.global
 		} else {
-			bucket = newLeakyBucket(m.global)
+			bucket = m.newBucket(hash)
 		}
 
 		for i := range ids {
@@ -55,10 +67,31 @@ type Manager struct {
 	buckets map[string]*ltBucket
 
 	global *ltBucket
+	store  RESTBucketStore
+	log    logger.Logger
 }
 
 var _ RESTBucketManager = (*Manager)(nil)
 
+// setLogger changes the logger used to report store errors
+func (r *Manager) setLogger(log logger.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log = log
+	r.global.log = log
+	for _, bucket := range r.buckets {
+		bucket.log = log
+	}
+}
+
+func (r *Manager) newBucket(key string) *ltBucket {
+	bucket := newLeakyBucket(r.global)
+	bucket.store = r.store
+	bucket.log = r.log
+	bucket.key = key
+	return bucket
+}
+
 func (r *Manager) BucketGrouping() (group map[string][]string) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -110,7 +143,7 @@ func (r *Manager) Bucket(id string, cb func(bucket RESTBucket)) {
 	if !ok {
 		r.mu.Lock()
 		if _, ok = r.buckets[pID]; !ok {
-			r.buckets[pID] = newLeakyBucket(r.global)
+			r.buckets[pID] = r.newBucket(pID)
 		}
 		bucket = r.buckets[pID]
 		r.mu.Unlock()
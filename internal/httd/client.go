@@ -11,7 +11,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/andersfylling/disgord/internal/logger"
 	"github.com/andersfylling/disgord/internal/util"
 )
 
@@ -73,12 +75,19 @@ type ErrREST struct {
 	HTTPCode       int      `json:"-"`
 	Bucket         []string `json:"-"`
 	HashedEndpoint string   `json:"-"`
+
+	// Retries is the number of times the request was sent again, see RetryPolicy
+	Retries int `json:"-"`
 }
 
 var _ error = (*ErrREST)(nil)
 
 func (e *ErrREST) Error() string {
-	return fmt.Sprintf("%s\n%s\n%s => %+v", e.Msg, e.Suggestion, e.HashedEndpoint, e.Bucket)
+	msg := fmt.Sprintf("%s\n%s\n%s => %+v", e.Msg, e.Suggestion, e.HashedEndpoint, e.Bucket)
+	if e.Retries > 0 {
+		msg += fmt.Sprintf("\nretried %d times", e.Retries)
+	}
+	return msg
 }
 
 // Client is the httd client for handling Discord requests
@@ -88,6 +97,8 @@ type Client struct {
 	httpClient                   *http.Client // TODO: decouple to allow better unit testing of REST requests
 	cancelRequestWhenRateLimited bool
 	buckets                      RESTBucketManager
+	retryPolicy                  *RetryPolicy
+	middlewares                  []RESTMiddleware
 }
 
 func (c *Client) BucketGrouping() (group map[string][]string) {
@@ -138,7 +149,11 @@ func NewClient(conf *Config) (*Client, error) {
 	}
 
 	if conf.RESTBucketManager == nil {
-		conf.RESTBucketManager = NewManager(nil)
+		manager := NewManagerWithStore(nil, conf.RESTBucketStore)
+		if conf.Logger != nil {
+			manager.setLogger(conf.Logger)
+		}
+		conf.RESTBucketManager = manager
 	}
 
 	// Clients using the HTTP API must provide a valid User Agent which specifies
@@ -158,11 +173,20 @@ func NewClient(conf *Config) (*Client, error) {
 		"Accept-Encoding":   {"gzip"},
 	}
 
+	var retryPolicy *RetryPolicy
+	if conf.RetryPolicy != nil {
+		policy := *conf.RetryPolicy
+		policy.populateMissing()
+		retryPolicy = &policy
+	}
+
 	return &Client{
-		url:        BaseURL + "/v" + strconv.Itoa(conf.APIVersion),
-		reqHeader:  header,
-		httpClient: conf.HTTPClient,
-		buckets:    conf.RESTBucketManager,
+		url:         BaseURL + "/v" + strconv.Itoa(conf.APIVersion),
+		reqHeader:   header,
+		httpClient:  conf.HTTPClient,
+		buckets:     conf.RESTBucketManager,
+		retryPolicy: retryPolicy,
+		middlewares: conf.RESTMiddlewares,
 	}, nil
 }
 
@@ -179,6 +203,19 @@ type Config struct {
 	// RESTBucketManager stores all rate limit buckets and dictates the behaviour of how rate limiting is respected
 	RESTBucketManager RESTBucketManager
 
+	// RESTBucketStore shares the rate limits with other clients using the same bot token. It is not used
+	// when a RESTBucketManager is given.
+	RESTBucketStore RESTBucketStore
+
+	// Logger reports RESTBucketStore errors
+	Logger logger.Logger
+
+	// RetryPolicy decides which failed requests are sent again. Requests are not retried when nil.
+	RetryPolicy *RetryPolicy
+
+	// RESTMiddlewares hooks into every request, in order
+	RESTMiddlewares []RESTMiddleware
+
 	// Header field: `User-Agent: DiscordBot ({Source}, {Version}) {Extra}`
 	UserAgentVersion   string
 	UserAgentSourceURL string
@@ -227,6 +264,53 @@ func (c *Client) Do(ctx context.Context, r *Request) (resp *http.Response, body
 		return nil, nil, err
 	}
 
+	retry := c.retryPolicy.allows(r)
+	if !retry {
+		return c.do(ctx, r)
+	}
+
+	// the body must be sent again on every attempt
+	var payload []byte
+	if r.bodyReader != nil {
+		if payload, err = ioutil.ReadAll(r.bodyReader); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var retries int
+	for {
+		if payload != nil {
+			r.bodyReader = bytes.NewReader(payload)
+		}
+		if resp, body, err = c.do(ctx, r); err == nil {
+			return resp, body, nil
+		}
+		if retries+1 >= c.retryPolicy.MaxAttempts || !c.retryPolicy.retryable(err) {
+			break
+		}
+
+		retries++
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.retryPolicy.backoff(retries)):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if retries == 0 {
+		return nil, nil, err
+	}
+	if restErr, ok := err.(*ErrREST); ok {
+		restErr.Retries = retries
+		return nil, nil, restErr
+	}
+	return nil, nil, &RetryError{Retries: retries, Err: err}
+}
+
+// do sends the request once
+func (c *Client) do(ctx context.Context, r *Request) (resp *http.Response, body []byte, err error) {
 	// create http request
 	req, err := http.NewRequestWithContext(ctx, r.Method.String(), c.url+r.Endpoint, r.bodyReader)
 	if err != nil {
@@ -243,9 +327,21 @@ func (c *Client) Do(ctx context.Context, r *Request) (resp *http.Response, body
 	}
 	req.Header = header
 
+	info := &RESTRequestInfo{Request: r, Bucket: r.hashedEndpoint}
+	ctx, middlewares, err := c.before(ctx, r, req)
+	defer func() {
+		info.Err = err
+		c.after(ctx, middlewares, info)
+	}()
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.WithContext(ctx)
+
 	// queue & send request
 	c.buckets.Bucket(r.hashedEndpoint, func(bucket RESTBucket) {
 		resp, body, err = bucket.Transaction(ctx, func() (*http.Response, []byte, error) {
+			start := time.Now()
 			resp, err := c.httpClient.Do(req)
 			if err != nil {
 				return nil, nil, err
@@ -254,6 +350,7 @@ func (c *Client) Do(ctx context.Context, r *Request) (resp *http.Response, body
 			// decode body
 			body, err := c.decodeResponseBody(resp)
 			_ = resp.Body.Close()
+			info.Latency = time.Since(start)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -266,6 +363,10 @@ func (c *Client) Do(ctx context.Context, r *Request) (resp *http.Response, body
 	if err != nil {
 		return nil, nil, err
 	}
+	info.Response, info.Body = resp, body
+	if bucketHash := resp.Header.Get(XRateLimitBucket); bucketHash != "" {
+		info.Bucket = bucketHash
+	}
 
 	// check if request was successful
 	noDiff := resp.StatusCode == http.StatusNotModified
@@ -0,0 +1,64 @@
+package httd
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// RESTMiddleware hooks into every request sent by the Client. Both hooks are optional, and are called for
+// every attempt when a request is retried.
+type RESTMiddleware struct {
+	// Before is called before the request is queued in its bucket. The http request can be modified, eg. to send
+	// it to another host. The returned context is used for the request and given to After, such that it can
+	// carry tracing spans. The previous context is kept when the returned context is nil. Returning an error
+	// aborts the request.
+	Before func(ctx context.Context, req *Request, httpReq *http.Request) (context.Context, error)
+
+	// After is called once the request is done or has failed, including when a Before hook aborted it.
+	After func(ctx context.Context, info *RESTRequestInfo)
+}
+
+// RESTRequestInfo describes a finished request
+type RESTRequestInfo struct {
+	Request *Request
+
+	// Response and Body are nil when no response was received, see Err
+	Response *http.Response
+	Body     []byte
+	Err      error
+
+	// Bucket is the Discord bucket hash, or the hashed endpoint when Discord did not specify a bucket
+	Bucket string
+
+	// Latency is the time spent sending the request and reading the response, which does not include the time
+	// spent waiting for the rate limit to reset
+	Latency time.Duration
+}
+
+// before calls the Before hooks in order, and returns how many of the middlewares that must be given to after
+func (c *Client) before(ctx context.Context, r *Request, req *http.Request) (context.Context, int, error) {
+	for i := range c.middlewares {
+		if c.middlewares[i].Before == nil {
+			continue
+		}
+
+		next, err := c.middlewares[i].Before(ctx, r, req)
+		if next != nil {
+			ctx = next
+		}
+		if err != nil {
+			return ctx, i, err
+		}
+	}
+	return ctx, len(c.middlewares), nil
+}
+
+// after calls the After hooks in reverse order, such that the first middleware wraps the others
+func (c *Client) after(ctx context.Context, n int, info *RESTRequestInfo) {
+	for i := n - 1; i >= 0; i-- {
+		if c.middlewares[i].After != nil {
+			c.middlewares[i].After(ctx, info)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// +build !integration
+
+package httd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type middlewareTestKey struct{}
+
+func TestClient_RESTMiddlewares(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(XRateLimitBucket, "f56681194ebea036dd1297f1184bf7bd")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"code":10013,"message":"Unknown User"}`))
+	}))
+	defer server.Close()
+	mock, _ := url.Parse(server.URL)
+
+	var calls []string
+	var info *RESTRequestInfo
+	client, err := NewClient(&Config{
+		APIVersion:         6,
+		BotToken:           "test",
+		UserAgentSourceURL: "https://github.com/andersfylling/disgord",
+		UserAgentVersion:   "test",
+		RESTMiddlewares: []RESTMiddleware{
+			{
+				// rewrites every request to the mock server
+				Before: func(ctx context.Context, req *Request, httpReq *http.Request) (context.Context, error) {
+					calls = append(calls, "before rewrite")
+					httpReq.URL.Scheme, httpReq.URL.Host = mock.Scheme, mock.Host
+					return context.WithValue(ctx, middlewareTestKey{}, req.Endpoint), nil
+				},
+				After: func(ctx context.Context, i *RESTRequestInfo) {
+					calls = append(calls, "after rewrite")
+					info = i
+				},
+			},
+			{
+				After: func(ctx context.Context, i *RESTRequestInfo) {
+					calls = append(calls, "after "+ctx.Value(middlewareTestKey{}).(string))
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = client.Do(context.Background(), &Request{Method: MethodGet, Endpoint: "/users/1"})
+	if err == nil {
+		t.Fatal("expected the mock server to respond with 404")
+	}
+
+	expected := []string{"before rewrite", "after /users/1", "after rewrite"}
+	if len(calls) != len(expected) {
+		t.Fatalf("expected the hooks %v. Got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("expected the hooks %v. Got %v", expected, calls)
+		}
+	}
+
+	if info.Response == nil || info.Response.StatusCode != http.StatusNotFound || len(info.Body) == 0 {
+		t.Errorf("expected the 404 response to be given to the middleware. Got %+v", info)
+	}
+	if info.Bucket != "f56681194ebea036dd1297f1184bf7bd" {
+		t.Errorf("expected the bucket to be given to the middleware. Got %s", info.Bucket)
+	}
+	if _, ok := info.Err.(*ErrREST); !ok || info.Latency <= 0 {
+		t.Errorf("expected the REST error and latency to be set. Got %v and %s", info.Err, info.Latency)
+	}
+}
+
+func TestClient_RESTMiddlewares_Abort(t *testing.T) {
+	aborted := errors.New("aborted")
+
+	var afterCalls int
+	client, err := NewClient(&Config{
+		APIVersion:         6,
+		BotToken:           "test",
+		UserAgentSourceURL: "https://github.com/andersfylling/disgord",
+		UserAgentVersion:   "test",
+		RESTMiddlewares: []RESTMiddleware{
+			{
+				After: func(ctx context.Context, info *RESTRequestInfo) {
+					afterCalls++
+					if info.Err != aborted || info.Response != nil {
+						t.Errorf("expected the request to be aborted. Got %+v", info)
+					}
+				},
+			},
+			{
+				Before: func(ctx context.Context, req *Request, httpReq *http.Request) (context.Context, error) {
+					return ctx, aborted
+				},
+				After: func(ctx context.Context, info *RESTRequestInfo) {
+					t.Error("the After hook of the aborting middleware should not be called")
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = client.Do(context.Background(), &Request{Method: MethodGet, Endpoint: "/users/1"}); err != aborted {
+		t.Errorf("expected the request to be aborted. Got %v", err)
+	}
+	if afterCalls != 1 {
+		t.Errorf("expected the After hook to be called once. Got %d", afterCalls)
+	}
+}
+
+func TestClient_RESTMiddlewares_NilContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	mock, _ := url.Parse(server.URL)
+
+	var afterCtx context.Context
+	client, err := NewClient(&Config{
+		APIVersion:         6,
+		BotToken:           "test",
+		UserAgentSourceURL: "https://github.com/andersfylling/disgord",
+		UserAgentVersion:   "test",
+		RESTMiddlewares: []RESTMiddleware{
+			{
+				Before: func(ctx context.Context, req *Request, httpReq *http.Request) (context.Context, error) {
+					httpReq.URL.Scheme, httpReq.URL.Host = mock.Scheme, mock.Host
+					return nil, nil
+				},
+				After: func(ctx context.Context, info *RESTRequestInfo) {
+					afterCtx = ctx
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), middlewareTestKey{}, "previous")
+	if _, _, err = client.Do(ctx, &Request{Method: MethodGet, Endpoint: "/users/1"}); err != nil {
+		t.Fatal(err)
+	}
+	if afterCtx == nil || afterCtx.Value(middlewareTestKey{}) != "previous" {
+		t.Error("expected the previous context to be kept")
+	}
+}
+
@@ -44,6 +44,10 @@ type Request struct {
 	// Reason is a X-Audit-Log-Reason header field that will show up on the audit log for this action.
 	Reason string
 
+	// RetryNonIdempotent allows the RetryPolicy to send a POST or PATCH request more than once. A retried
+	// request might be handled twice by Discord, such that a message is sent twice.
+	RetryNonIdempotent bool
+
 	bodyReader     io.Reader
 	hashedEndpoint string
 }
@@ -0,0 +1,129 @@
+package httd
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryOn is a set of failures that a RetryPolicy retries
+type RetryOn uint
+
+const (
+	// RetryOnServerErrors retries 500, 502, 503 and 504 responses, which are usually caused by Cloudflare or
+	// a Discord outage
+	RetryOnServerErrors RetryOn = 1 << iota
+
+	// RetryOnNetworkErrors retries transient network errors, such as a reset connection or a timeout
+	RetryOnNetworkErrors
+
+	// RetryOnRateLimits retries 429 responses, after the bucket has reset
+	RetryOnRateLimits
+)
+
+// RetryPolicy decides when a failed request is sent again. Requests that are not idempotent, POST and PATCH,
+// are only retried when Request.RetryNonIdempotent is set, as Discord might have handled the first attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent, including the first attempt. Defaults to 3.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry, which doubles for every retry. Defaults to 500ms.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between two attempts. Defaults to 10 seconds.
+	MaxDelay time.Duration
+
+	// RetryOn decides which failures are retried. Defaults to server and network errors.
+	RetryOn RetryOn
+}
+
+func (p *RetryPolicy) populateMissing() {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay == 0 {
+		p.BaseDelay = 500 * time.Millisecond
+	}
+	if p.MaxDelay == 0 {
+		p.MaxDelay = 10 * time.Second
+	}
+	if p.RetryOn == 0 {
+		p.RetryOn = RetryOnServerErrors | RetryOnNetworkErrors
+	}
+}
+
+// allows reports whether the request can be sent more than once
+func (p *RetryPolicy) allows(r *Request) bool {
+	if p == nil || p.MaxAttempts <= 1 {
+		return false
+	}
+	switch r.Method {
+	case MethodGet, MethodPut, MethodDelete:
+		return true
+	default:
+		return r.RetryNonIdempotent
+	}
+}
+
+// retryable reports whether the failure of an attempt is covered by the policy
+func (p *RetryPolicy) retryable(err error) bool {
+	var restErr *ErrREST
+	if errors.As(err, &restErr) {
+		switch restErr.HTTPCode {
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return p.RetryOn&RetryOnServerErrors > 0
+		case http.StatusTooManyRequests:
+			return p.RetryOn&RetryOnRateLimits > 0
+		default:
+			return false
+		}
+	}
+
+	return p.RetryOn&RetryOnNetworkErrors > 0 && isTransientNetworkError(err)
+}
+
+func isTransientNetworkError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true // the connection was closed before a response was received
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// backoff returns the delay before the given retry. Half of the delay is random, such that clients that failed
+// at the same time does not retry at the same time.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.MaxDelay
+	if retry < 32 && p.BaseDelay<<uint(retry-1) < p.MaxDelay {
+		delay = p.BaseDelay << uint(retry-1)
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// RetryError is returned when a request has failed after being retried. Note that *ErrREST is returned as is,
+// with ErrREST.Retries set.
+type RetryError struct {
+	Retries int
+	Err     error
+}
+
+var _ error = (*RetryError)(nil)
+
+func (e *RetryError) Error() string {
+	return e.Err.Error() + " (retried " + strconv.Itoa(e.Retries) + " times)"
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
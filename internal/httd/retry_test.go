@@ -0,0 +1,160 @@
+// +build !integration
+
+package httd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// retryTestServer responds with the given status codes, and then 200 OK
+type retryTestServer struct {
+	mu     sync.Mutex
+	codes  []int
+	bodies []string
+}
+
+func (s *retryTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bodies = append(s.bodies, string(body))
+
+	code := http.StatusOK
+	if len(s.codes) > 0 {
+		code, s.codes = s.codes[0], s.codes[1:]
+	}
+	w.WriteHeader(code)
+	_, _ = w.Write([]byte(`{}`))
+}
+
+func newRetryTestClient(t *testing.T, server *httptest.Server, policy *RetryPolicy) *Client {
+	client, err := NewClient(&Config{
+		APIVersion:         6,
+		BotToken:           "test",
+		UserAgentSourceURL: "https://github.com/andersfylling/disgord",
+		UserAgentVersion:   "test",
+		RetryPolicy:        policy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.url = server.URL
+	return client
+}
+
+func TestClient_Retry(t *testing.T) {
+	policy := &RetryPolicy{BaseDelay: time.Millisecond}
+
+	t.Run("server-errors", func(t *testing.T) {
+		handler := &retryTestServer{codes: []int{http.StatusBadGateway, http.StatusServiceUnavailable}}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		client := newRetryTestClient(t, server, policy)
+		_, _, err := client.Do(context.Background(), &Request{
+			Method:      MethodPut,
+			Endpoint:    "/guilds/1/members/2/roles/3",
+			Body:        "payload",
+			ContentType: ContentTypeJSON,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(handler.bodies) != 3 {
+			t.Fatalf("expected 3 attempts. Got %d", len(handler.bodies))
+		}
+		for _, body := range handler.bodies {
+			if body != `"payload"` {
+				t.Errorf("expected the body to be sent on every attempt. Got %s", body)
+			}
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		handler := &retryTestServer{codes: []int{500, 500, 500, 500}}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		client := newRetryTestClient(t, server, policy)
+		_, _, err := client.Do(context.Background(), &Request{Method: MethodGet, Endpoint: "/users/@me"})
+
+		var restErr *ErrREST
+		if !errors.As(err, &restErr) || restErr.Retries != 2 {
+			t.Fatalf("expected a REST error after 2 retries. Got %v", err)
+		}
+	})
+
+	t.Run("non-idempotent", func(t *testing.T) {
+		handler := &retryTestServer{codes: []int{http.StatusBadGateway, http.StatusBadGateway}}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		client := newRetryTestClient(t, server, policy)
+		if _, _, err := client.Do(context.Background(), &Request{Method: MethodPost, Endpoint: "/channels/1/messages"}); err == nil {
+			t.Fatal("expected the POST request to not be retried")
+		}
+		_, _, err := client.Do(context.Background(), &Request{
+			Method:             MethodPost,
+			Endpoint:           "/channels/1/messages",
+			RetryNonIdempotent: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(handler.bodies) != 3 {
+			t.Errorf("expected 1 attempt, and 2 attempts when opted in. Got %d", len(handler.bodies))
+		}
+	})
+
+	t.Run("not-retryable", func(t *testing.T) {
+		handler := &retryTestServer{codes: []int{http.StatusNotFound}}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		client := newRetryTestClient(t, server, policy)
+		if _, _, err := client.Do(context.Background(), &Request{Method: MethodGet, Endpoint: "/users/1"}); err == nil {
+			t.Fatal("expected 404 to fail")
+		}
+		if len(handler.bodies) != 1 {
+			t.Errorf("expected a single attempt. Got %d", len(handler.bodies))
+		}
+	})
+
+	t.Run("network-errors", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close() // refuses connections
+
+		client := newRetryTestClient(t, server, policy)
+		_, _, err := client.Do(context.Background(), &Request{Method: MethodGet, Endpoint: "/users/1"})
+
+		var retryErr *RetryError
+		if !errors.As(err, &retryErr) || retryErr.Retries != 2 {
+			t.Fatalf("expected the request to fail after 2 retries. Got %v", err)
+		}
+	})
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := &RetryPolicy{}
+	policy.populateMissing()
+
+	for i, max := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second} {
+		retry := i + 1
+		for j := 0; j < 20; j++ {
+			if delay := policy.backoff(retry); delay < max/2 || delay > max {
+				t.Errorf("retry %d: expected a delay between %s and %s. Got %s", retry, max/2, max, delay)
+			}
+		}
+	}
+	if delay := policy.backoff(100); delay > policy.MaxDelay {
+		t.Errorf("expected the delay to be capped at %s. Got %s", policy.MaxDelay, delay)
+	}
+}
@@ -0,0 +1,106 @@
+package httd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RESTBucketState is the rate limit info of a bucket, as given by the latest Discord response
+type RESTBucketState struct {
+	// Remaining requests before the reset, -1 when unknown
+	Remaining int `json:"remaining"`
+
+	// Reset is when the bucket resets, adjusted to the local clock
+	Reset time.Time `json:"reset"`
+
+	// DiscordReset is the reset as given by Discord, which is used to tell which state is the newest
+	DiscordReset time.Time `json:"discord_reset"`
+}
+
+// RESTBucketStore holds the rate limit info of buckets such that several clients, which might run in different
+// processes, can share the same view of the rate limits of a bot token. The global bucket uses the key GlobalHash.
+type RESTBucketStore interface {
+	// Reserve takes a request from the bucket and the global bucket, as one atomic operation. When either is
+	// exhausted nothing is taken, and the time until the bucket can be reserved again is returned instead.
+	Reserve(ctx context.Context, key string) (wait time.Duration, err error)
+
+	// Update stores the rate limit info of the bucket, unless the store already holds a newer state.
+	Update(ctx context.Context, key string, state RESTBucketState) error
+}
+
+// NewMemoryBucketStore creates a store that can be shared by clients in the same process.
+// See NewBucketStoreServer to share the buckets between processes.
+func NewMemoryBucketStore() *MemoryBucketStore {
+	return &MemoryBucketStore{
+		buckets: make(map[string]*RESTBucketState),
+	}
+}
+
+type MemoryBucketStore struct {
+	mu      sync.Mutex
+	buckets map[string]*RESTBucketState
+}
+
+var _ RESTBucketStore = (*MemoryBucketStore)(nil)
+
+func (s *MemoryBucketStore) Reserve(_ context.Context, key string) (wait time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// only the known buckets, that has not yet reset, can be exhausted
+	var buckets []*RESTBucketState
+	now := time.Now()
+	for _, k := range []string{GlobalHash, key} {
+		bucket, ok := s.buckets[k]
+		if ok && !bucket.Reset.After(now) {
+			delete(s.buckets, k)
+		} else if ok && bucket.Remaining >= 0 {
+			buckets = append(buckets, bucket)
+		}
+		if key == GlobalHash {
+			break
+		}
+	}
+
+	for _, bucket := range buckets {
+		if bucket.Remaining == 0 && bucket.Reset.Sub(now) > wait {
+			wait = bucket.Reset.Sub(now)
+		}
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+
+	for _, bucket := range buckets {
+		bucket.Remaining--
+	}
+	return 0, nil
+}
+
+func (s *MemoryBucketStore) Update(_ context.Context, key string, state RESTBucketState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// buckets that has reset hold no information, and would otherwise pile up for every major parameter
+	now := time.Now()
+	for k, bucket := range s.buckets {
+		if !bucket.Reset.After(now) {
+			delete(s.buckets, k)
+		}
+	}
+	if !state.Reset.After(now) {
+		return nil
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok || state.DiscordReset.After(bucket.DiscordReset) {
+		s.buckets[key] = &state
+	} else if bucket.DiscordReset.Equal(state.DiscordReset) {
+		// requests reserved by other clients might not yet be reflected by the state
+		if state.Remaining >= 0 && (bucket.Remaining == -1 || bucket.Remaining > state.Remaining) {
+			bucket.Remaining = state.Remaining
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package httd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	bucketStoreOpReserve = "reserve"
+	bucketStoreOpUpdate  = "update"
+)
+
+type bucketStoreRequest struct {
+	Op    string           `json:"op"`
+	Key   string           `json:"key"`
+	State *RESTBucketState `json:"state,omitempty"`
+}
+
+type bucketStoreResponse struct {
+	Error string        `json:"error,omitempty"`
+	Wait  time.Duration `json:"wait,omitempty"`
+}
+
+//////////////////////////////////////////////////////
+//
+// SERVER
+//
+//////////////////////////////////////////////////////
+
+// NewBucketStoreServer creates the reference coordinator for sharing buckets between processes. Use Serve to
+// accept processes over a local TCP or unix socket, and NewBucketStoreClient in every process.
+func NewBucketStoreServer() *BucketStoreServer {
+	return &BucketStoreServer{
+		store:   NewMemoryBucketStore(),
+		closing: make(chan struct{}),
+	}
+}
+
+type BucketStoreServer struct {
+	store *MemoryBucketStore
+
+	mu        sync.Mutex
+	listeners []net.Listener
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// Serve accepts connections until the listener fails or the server is closed.
+func (s *BucketStoreServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-s.closing:
+				return nil
+			default:
+				return err
+			}
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops every listener used by Serve
+func (s *BucketStoreServer) Close() (err error) {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, listener := range s.listeners {
+			if e := listener.Close(); e != nil {
+				err = e
+			}
+		}
+	})
+	return err
+}
+
+// handle serves requests until the client disconnects
+func (s *BucketStoreServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+	for {
+		req := &bucketStoreRequest{}
+		if err := decoder.Decode(req); err != nil {
+			return
+		}
+
+		resp := &bucketStoreResponse{}
+		switch req.Op {
+		case bucketStoreOpReserve:
+			resp.Wait, _ = s.store.Reserve(context.Background(), req.Key)
+		case bucketStoreOpUpdate:
+			if req.State == nil {
+				resp.Error = "missing bucket state"
+				break
+			}
+			_ = s.store.Update(context.Background(), req.Key, *req.State)
+		default:
+			resp.Error = "unknown operation " + req.Op
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+//////////////////////////////////////////////////////
+//
+// CLIENT
+//
+//////////////////////////////////////////////////////
+
+// NewBucketStoreClient connects to a BucketStoreServer, given the network ("tcp" or "unix") and address.
+func NewBucketStoreClient(network, address string) RESTBucketStore {
+	return &bucketStoreClient{
+		network: network,
+		address: address,
+	}
+}
+
+type bucketStoreClient struct {
+	network string
+	address string
+	dialer  net.Dialer
+
+	// idle connections are reused, as a request is made for every REST request
+	mu   sync.Mutex
+	idle []net.Conn
+}
+
+var _ RESTBucketStore = (*bucketStoreClient)(nil)
+
+func (c *bucketStoreClient) conn(ctx context.Context) (net.Conn, error) {
+	c.mu.Lock()
+	if len(c.idle) > 0 {
+		conn := c.idle[len(c.idle)-1]
+		c.idle = c.idle[:len(c.idle)-1]
+		c.mu.Unlock()
+		return conn, nil
+	}
+	c.mu.Unlock()
+
+	return c.dialer.DialContext(ctx, c.network, c.address)
+}
+
+func (c *bucketStoreClient) request(ctx context.Context, req *bucketStoreRequest) (*bucketStoreResponse, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline() // the zero deadline removes the deadline of a reused connection
+	_ = conn.SetDeadline(deadline)
+
+	resp := &bucketStoreResponse{}
+	if err = json.NewEncoder(conn).Encode(req); err == nil {
+		err = json.NewDecoder(conn).Decode(resp)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.idle = append(c.idle, conn)
+	c.mu.Unlock()
+
+	if resp.Error != "" {
+		return nil, errors.New("bucket store: " + resp.Error)
+	}
+	return resp, nil
+}
+
+func (c *bucketStoreClient) Reserve(ctx context.Context, key string) (wait time.Duration, err error) {
+	resp, err := c.request(ctx, &bucketStoreRequest{
+		Op:  bucketStoreOpReserve,
+		Key: key,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Wait, nil
+}
+
+func (c *bucketStoreClient) Update(ctx context.Context, key string, state RESTBucketState) error {
+	_, err := c.request(ctx, &bucketStoreRequest{
+		Op:    bucketStoreOpUpdate,
+		Key:   key,
+		State: &state,
+	})
+	return err
+}
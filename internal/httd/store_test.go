@@ -0,0 +1,201 @@
+// +build !integration
+
+package httd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/logger"
+)
+
+func testBucketStore(t *testing.T, a, b RESTBucketStore) {
+	ctx := context.Background()
+	reset := time.Now().Add(time.Hour)
+	err := a.Update(ctx, "bucket", RESTBucketState{Remaining: 2, Reset: reset, DiscordReset: reset})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, store := range []RESTBucketStore{a, b, a} {
+		wait, err := store.Reserve(ctx, "bucket")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exhausted := i == 2; exhausted != (wait > 0) {
+			t.Errorf("reservation %d: unexpected wait %s", i, wait)
+		}
+	}
+
+	// an older state must not reset the remaining requests
+	err = b.Update(ctx, "bucket", RESTBucketState{Remaining: 5, Reset: reset, DiscordReset: reset.Add(-time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := b.Reserve(ctx, "bucket"); wait == 0 {
+		t.Error("an outdated state replaced the bucket")
+	}
+
+	// the global bucket affects every bucket
+	err = b.Update(ctx, GlobalHash, RESTBucketState{Remaining: 0, Reset: reset, DiscordReset: reset})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := a.Reserve(ctx, "another bucket"); wait == 0 {
+		t.Error("expected the global rate limit to be respected")
+	}
+}
+
+func TestMemoryBucketStore(t *testing.T) {
+	store := NewMemoryBucketStore()
+	testBucketStore(t, store, store)
+}
+
+func TestMemoryBucketStore_expired(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryBucketStore()
+	reset := time.Now().Add(20 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		key := "bucket:" + strconv.Itoa(i)
+		if err := store.Update(ctx, key, RESTBucketState{Remaining: 0, Reset: reset, DiscordReset: reset}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(store.buckets) != 10 {
+		t.Fatalf("expected 10 buckets, got %d", len(store.buckets))
+	}
+
+	<-time.After(30 * time.Millisecond)
+	if wait, _ := store.Reserve(ctx, "bucket:0"); wait != 0 {
+		t.Errorf("a bucket that has reset should not be waited for. Got %s", wait)
+	}
+
+	// buckets that has reset are dropped by any update
+	reset = time.Now().Add(time.Hour)
+	if err := store.Update(ctx, "active", RESTBucketState{Remaining: 1, Reset: reset, DiscordReset: reset}); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.buckets) != 1 {
+		t.Errorf("expected only the active bucket to remain, got %d buckets", len(store.buckets))
+	}
+}
+
+func TestBucketStoreServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewBucketStoreServer()
+	defer server.Close()
+	go server.Serve(listener)
+
+	a := NewBucketStoreClient("tcp", listener.Addr().String())
+	b := NewBucketStoreClient("tcp", listener.Addr().String())
+	testBucketStore(t, a, b)
+}
+
+func TestManager_SharedStore(t *testing.T) {
+	store := NewMemoryBucketStore()
+	first := NewManagerWithStore(nil, store)
+	second := NewManagerWithStore(nil, store)
+
+	id := "dlfjhdskfhjdskfjsd"
+	first.Bucket(id, func(bucket RESTBucket) {
+		_, _, _ = bucket.Transaction(context.Background(), func() (*http.Response, []byte, error) {
+			reset := time.Now().Add(2 * time.Hour)
+			resp := &http.Response{
+				Header:     make(http.Header),
+				StatusCode: http.StatusOK,
+			}
+			resp.Header.Set(XRateLimitBucket, "f56681194ebea036dd1297f1184bf7bd")
+			resp.Header.Set(XRateLimitLimit, "2")
+			resp.Header.Set(XRateLimitRemaining, "0")
+			resp.Header.Set(XRateLimitReset, strconv.FormatFloat(float64(reset.UnixNano())/float64(time.Second), 'f', 4, 64))
+			resp.Header.Set("date", time.Now().Format(time.RFC1123))
+
+			resp.Header, _ = NormalizeDiscordHeader(resp.StatusCode, resp.Header, nil)
+			return resp, nil, nil
+		})
+	})
+
+	second.Bucket(id, func(bucket RESTBucket) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Minute))
+		defer cancel()
+
+		var sent bool
+		_, _, err := bucket.Transaction(ctx, func() (*http.Response, []byte, error) {
+			sent = true
+			return nil, nil, nil
+		})
+		if sent || err == nil || !strings.Contains(err.Error(), "time out") {
+			t.Error("expected the rate limit of the other manager to be respected")
+		}
+	})
+}
+
+type errorLogger struct {
+	logger.Empty
+	errors []string
+}
+
+func (l *errorLogger) Error(v ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprint(v...))
+}
+
+func TestManager_StoreServerStopped(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewBucketStoreServer()
+	stopped := make(chan struct{})
+	go func() {
+		_ = server.Serve(listener)
+		close(stopped)
+	}()
+	if _, err = NewBucketStoreClient("tcp", listener.Addr().String()).Reserve(context.Background(), "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	_ = server.Close()
+	<-stopped
+
+	store := NewBucketStoreClient("tcp", listener.Addr().String())
+
+	log := &errorLogger{}
+	manager := NewManagerWithStore(nil, store)
+	manager.setLogger(log)
+
+	manager.Bucket("dlfjhdskfhjdskfjsd", func(bucket RESTBucket) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		var sent bool
+		_, _, err := bucket.Transaction(ctx, func() (*http.Response, []byte, error) {
+			sent = true
+			resp := &http.Response{
+				Header:     make(http.Header),
+				StatusCode: http.StatusOK,
+			}
+			resp.Header.Set(XRateLimitBucket, "f56681194ebea036dd1297f1184bf7bd")
+			resp.Header.Set(XRateLimitLimit, "2")
+			resp.Header.Set(XRateLimitRemaining, "1")
+			resp.Header.Set("date", time.Now().Format(time.RFC1123))
+
+			resp.Header, _ = NormalizeDiscordHeader(resp.StatusCode, resp.Header, nil)
+			return resp, nil, nil
+		})
+		if err != nil || !sent {
+			t.Errorf("expected the request to be sent without the store. Got %v", err)
+		}
+	})
+	if len(log.errors) == 0 {
+		t.Error("expected the store error to be logged")
+	}
+}
+
@@ -72,6 +72,16 @@ func defineResource(evt string) (resource evtResource) {
 		resource = &Ready{}
 	case EvtResumed:
 		resource = &Resumed{}
+	case EvtShardConnecting:
+		resource = &ShardConnecting{}
+	case EvtShardDisconnected:
+		resource = &ShardDisconnected{}
+	case EvtShardReady:
+		resource = &ShardReady{}
+	case EvtShardResumed:
+		resource = &ShardResumed{}
+	case EvtShardZombied:
+		resource = &ShardZombied{}
 	case EvtTypingStart:
 		resource = &TypingStart{}
 	case EvtUserUpdate:
@@ -215,6 +225,26 @@ func isHandler(h Handler) (ok bool) {
 		ok = true
 	case chan *Resumed:
 		ok = true
+	case ShardConnectingHandler:
+		ok = true
+	case chan *ShardConnecting:
+		ok = true
+	case ShardDisconnectedHandler:
+		ok = true
+	case chan *ShardDisconnected:
+		ok = true
+	case ShardReadyHandler:
+		ok = true
+	case chan *ShardReady:
+		ok = true
+	case ShardResumedHandler:
+		ok = true
+	case chan *ShardResumed:
+		ok = true
+	case ShardZombiedHandler:
+		ok = true
+	case chan *ShardZombied:
+		ok = true
 	case TypingStartHandler:
 		ok = true
 	case chan *TypingStart:
@@ -303,6 +333,16 @@ func closeChannel(channel interface{}) {
 		close(t)
 	case chan *Resumed:
 		close(t)
+	case chan *ShardConnecting:
+		close(t)
+	case chan *ShardDisconnected:
+		close(t)
+	case chan *ShardReady:
+		close(t)
+	case chan *ShardResumed:
+		close(t)
+	case chan *ShardZombied:
+		close(t)
 	case chan *TypingStart:
 		close(t)
 	case chan *UserUpdate:
@@ -523,6 +563,36 @@ func (d *dispatcher) trigger(h Handler, evt resource) {
 		t <- evt.(*Resumed)
 	case chan<- *Resumed:
 		t <- evt.(*Resumed)
+	case ShardConnectingHandler:
+		t(d.session, evt.(*ShardConnecting))
+	case chan *ShardConnecting:
+		t <- evt.(*ShardConnecting)
+	case chan<- *ShardConnecting:
+		t <- evt.(*ShardConnecting)
+	case ShardDisconnectedHandler:
+		t(d.session, evt.(*ShardDisconnected))
+	case chan *ShardDisconnected:
+		t <- evt.(*ShardDisconnected)
+	case chan<- *ShardDisconnected:
+		t <- evt.(*ShardDisconnected)
+	case ShardReadyHandler:
+		t(d.session, evt.(*ShardReady))
+	case chan *ShardReady:
+		t <- evt.(*ShardReady)
+	case chan<- *ShardReady:
+		t <- evt.(*ShardReady)
+	case ShardResumedHandler:
+		t(d.session, evt.(*ShardResumed))
+	case chan *ShardResumed:
+		t <- evt.(*ShardResumed)
+	case chan<- *ShardResumed:
+		t <- evt.(*ShardResumed)
+	case ShardZombiedHandler:
+		t(d.session, evt.(*ShardZombied))
+	case chan *ShardZombied:
+		t <- evt.(*ShardZombied)
+	case chan<- *ShardZombied:
+		t <- evt.(*ShardZombied)
 	case TypingStartHandler:
 		t(d.session, evt.(*TypingStart))
 	case chan *TypingStart:
@@ -652,6 +722,21 @@ type ReadyHandler = func(s Session, h *Ready)
 // ResumedHandler is triggered in Resumed events
 type ResumedHandler = func(s Session, h *Resumed)
 
+// ShardConnectingHandler is triggered in ShardConnecting events
+type ShardConnectingHandler = func(s Session, h *ShardConnecting)
+
+// ShardDisconnectedHandler is triggered in ShardDisconnected events
+type ShardDisconnectedHandler = func(s Session, h *ShardDisconnected)
+
+// ShardReadyHandler is triggered in ShardReady events
+type ShardReadyHandler = func(s Session, h *ShardReady)
+
+// ShardResumedHandler is triggered in ShardResumed events
+type ShardResumedHandler = func(s Session, h *ShardResumed)
+
+// ShardZombiedHandler is triggered in ShardZombied events
+type ShardZombiedHandler = func(s Session, h *ShardZombied)
+
 // TypingStartHandler is triggered in TypingStart events
 type TypingStartHandler = func(s Session, h *TypingStart)
 
@@ -314,6 +314,7 @@ func (b *RESTBuilder) prepare() {
 	if flags.Ignorecache() {
 		b.IgnoreCache()
 	}
+	b.config.RetryNonIdempotent = flags&RetryNonIdempotent > 0
 }
 
 // execute ... v must be a nil pointer.
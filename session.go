@@ -52,9 +52,15 @@ type SocketHandler interface {
 	//  // a handler that only runs for events within the first 10 minutes
 	//  Client.On(EvtReady, onReady, &Ctrl{Duration: 10*time.Minute})
 	On(event string, inputs ...interface{})
+
+	// AddHandler registers handlers like On, but returns an error instead of panicking. See Config.StrictIntents.
+	AddHandler(event string, inputs ...interface{}) error
 	SocketHandlerRegistrators // type safe handler registration
 
 	Emitter
+
+	// RequestGuildMembers requests guild members over the gateway, and waits for every chunk of the response
+	RequestGuildMembers(ctx context.Context, guildID Snowflake, params *RequestGuildMembersParams) (*GuildMembers, error)
 }
 
 // AuditLogsRESTer REST interface for all audit-logs endpoints
@@ -500,6 +506,8 @@ type Session interface {
 	AvgHeartbeatLatency() (duration time.Duration, err error)
 	// returns the latency for each given shard id. shardID => latency
 	HeartbeatLatencies() (latencies map[uint]time.Duration, err error)
+	// returns the connection state, session and health of every local shard
+	ShardStatus() (statuses []ShardStatus, err error)
 
 	RESTRatelimitBuckets() (group map[string][]string)
 	RESTBucketGrouping() (group map[string][]string)
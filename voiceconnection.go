@@ -14,8 +14,6 @@ import (
 
 	"github.com/andersfylling/disgord/internal/gateway"
 	"github.com/andersfylling/disgord/internal/gateway/cmd"
-
-	"golang.org/x/crypto/nacl/secretbox"
 )
 
 type voiceRepository struct {
@@ -24,8 +22,14 @@ type voiceRepository struct {
 
 	pendingStates  map[Snowflake]chan *VoiceStateUpdate
 	pendingServers map[Snowflake]chan *VoiceServerUpdate
+
+	// connections holds the open voice connections by guild ID, such that they can follow voice server migrations
+	connections map[Snowflake]*voiceImpl
 }
 
+// voiceMigrationTimeout is how long a closed voice connection waits for Discord to announce a new voice server
+const voiceMigrationTimeout = 5 * time.Second
+
 // VoiceConnection is the interface used to interact with active voice connections.
 type VoiceConnection interface {
 	// StartSpeaking should be sent before sending voice data.
@@ -41,6 +45,20 @@ type VoiceConnection interface {
 	SendOpusFrame(data []byte) error
 	// SendDCA reads from a Reader expecting a DCA encoded stream/file and sends them as frames.
 	SendDCA(r io.Reader) error
+	// SendOggOpus reads from a Reader expecting an Ogg Opus stream/file, such as .opus files created by ffmpeg or
+	// opusenc, and sends the opus packets as frames without decoding them. The frames are paced by the Ogg
+	// granule positions, so frame sizes other than 20ms are supported.
+	SendOggOpus(r io.Reader) error
+
+	// Receive returns the decrypted opus frames sent by the other users in the voice channel. Packets are dropped
+	// when the channel is full, so it must be read continuously. The channel is closed with the voice connection.
+	Receive() <-chan *VoicePacket
+
+	// Record writes the voice of each user in the voice channel to its own Ogg Opus file, created by the
+	// given function when the user first speaks. Gaps are filled with silence, such that the files of all the
+	// users line up in time. The files are closed when the voice connection is closed, and Close waits for
+	// them. Record consumes the packets of Receive, so the two can not be used together.
+	Record(create func(userID Snowflake) (io.WriteCloser, error)) error
 
 	// MoveTo moves from the current voice channel to the given.
 	MoveTo(channelID Snowflake) error
@@ -55,18 +73,60 @@ type VoiceConnection interface {
 type voiceImpl struct {
 	sync.Mutex
 
-	ready atomic.Bool
+	ready    atomic.Bool
+	speaking bool
 
 	ws  *gateway.VoiceClient
 	udp net.Conn
 
 	ssrc      uint32
+	mode      string
 	secretKey [32]byte
-	send      chan []byte
+	send      chan *voiceFrame
+	receive   chan *VoicePacket
 	close     chan struct{}
 
-	guildID Snowflake
-	c       *Client
+	// ssrcUsers maps the SSRC of received voice packets to the speaking users
+	ssrcUsers map[uint32]Snowflake
+
+	// recording is closed once the recorder has closed its files, see Record
+	recording chan struct{}
+
+	// migrateMu makes sure only one voice server migration runs at the time
+	migrateMu sync.Mutex
+	migrated  chan struct{}
+
+	guildID   Snowflake
+	sessionID string
+	c         *Client
+}
+
+// voiceServerConn is an established connection to a voice server
+type voiceServerConn struct {
+	ws        *gateway.VoiceClient
+	udp       net.Conn
+	ssrc      uint32
+	mode      string
+	secretKey [32]byte
+}
+
+func (s *voiceServerConn) close() (err error) {
+	var errMsg string
+	if s.udp != nil {
+		if err = s.udp.Close(); err != nil {
+			errMsg += err.Error()
+		}
+	}
+	if s.ws != nil {
+		if err = s.ws.Disconnect(); err != nil {
+			errMsg += err.Error()
+		}
+	}
+
+	if errMsg != "" {
+		return errors.New(errMsg)
+	}
+	return nil
 }
 
 func newVoiceRepository(c *Client) (voice *voiceRepository) {
@@ -75,9 +135,10 @@ func newVoiceRepository(c *Client) (voice *voiceRepository) {
 
 		pendingStates:  make(map[Snowflake]chan *VoiceStateUpdate),
 		pendingServers: make(map[Snowflake]chan *VoiceServerUpdate),
+		connections:    make(map[Snowflake]*voiceImpl),
 	}
-	c.On(EvtVoiceServerUpdate, voice.onVoiceServerUpdate)
-	c.On(EvtVoiceStateUpdate, voice.onVoiceStateUpdate)
+	c.on(EvtVoiceServerUpdate, voice.onVoiceServerUpdate)
+	c.on(EvtVoiceStateUpdate, voice.onVoiceStateUpdate)
 
 	return voice
 }
@@ -146,52 +207,80 @@ waiter:
 		}
 	}
 
-	voice := voiceImpl{
-		guildID: guildID,
-		c:       r.c,
-		send:    make(chan []byte),
-		close:   make(chan struct{}),
+	voice := &voiceImpl{
+		guildID:   guildID,
+		sessionID: state.SessionID,
+		c:         r.c,
+		send:      make(chan *voiceFrame),
+		receive:   make(chan *VoicePacket, voiceReceiveBufferSize),
+		close:     make(chan struct{}),
+		migrated:  make(chan struct{}, 1),
+		ssrcUsers: make(map[uint32]Snowflake),
 	}
-	// Defer a cleanup just in case
-	defer func(v *voiceImpl) {
-		if !v.ready.Load() {
-			if v.ws != nil {
-				_ = v.ws.Disconnect()
-			}
-			if v.udp != nil {
-				_ = v.udp.Close()
-			}
-			close(v.close)
+
+	var conn *voiceServerConn
+	if conn, err = r.connectVoiceServer(voice, state.SessionID, server); err != nil {
+		return
+	}
+	voice.ws, voice.udp = conn.ws, conn.udp
+	voice.ssrc, voice.mode, voice.secretKey = conn.ssrc, conn.mode, conn.secretKey
+	voice.ready.Store(true)
+
+	r.Lock()
+	r.connections[guildID] = voice
+	r.Unlock()
+
+	go voice.opusSendLoop()
+	go voice.opusReceiveLoop()
+	go voice.watcherDiscordCloseEvt()
+
+	ret = voice
+	return
+}
+
+// connectVoiceServer identifies with the voice server, and sets up the encrypted UDP connection
+func (r *voiceRepository) connectVoiceServer(voice *voiceImpl, sessionID string, server *VoiceServerUpdate) (conn *voiceServerConn, err error) {
+	conn = &voiceServerConn{}
+	defer func() {
+		if err != nil {
+			_ = conn.close()
+			conn = nil
 		}
-	}(&voice)
+	}()
 
 	// Connect to the websocket
-	voice.ws, err = gateway.NewVoiceClient(&gateway.VoiceConfig{
+	conn.ws, err = gateway.NewVoiceClient(&gateway.VoiceConfig{
 		GuildID:        server.GuildID,
 		UserID:         r.c.myID,
-		SessionID:      state.SessionID,
+		SessionID:      sessionID,
 		Token:          server.Token,
 		HTTPClient:     r.c.config.HTTPClient,
 		Endpoint:       "wss://" + strings.TrimSuffix(server.Endpoint, ":80") + "/?v=4",
 		Logger:         r.c.log,
 		SystemShutdown: r.c.shutdownChan,
+
+		SpeakingListener:   voice.onSpeaking,
+		DisconnectListener: voice.onClientDisconnect,
 	})
 	if err != nil {
 		return
 	}
 
 	var ready *gateway.VoiceReady
-	if ready, err = voice.ws.Connect(); err != nil {
+	if ready, err = conn.ws.Connect(); err != nil {
+		return
+	}
+	conn.ssrc = ready.SSRC
+	if conn.mode, err = selectVoiceEncryptionMode(r.c.config.VoiceEncryptionModes, ready.Modes); err != nil {
 		return
 	}
-	voice.ssrc = ready.SSRC
 
 	// Connect to UDP
 	dialer := net.Dial
 	if r.c.config.Proxy != nil {
 		dialer = r.c.config.Proxy.Dial
 	}
-	voice.udp, err = dialer("udp", ready.IP+":"+strconv.Itoa(ready.Port))
+	conn.udp, err = dialer("udp", ready.IP+":"+strconv.Itoa(ready.Port))
 	if err != nil {
 		return
 	}
@@ -199,14 +288,14 @@ waiter:
 	// SendOpusFrame our SSRC with no further data for the IP discovery process.
 	ssrcBuffer := make([]byte, 70)
 	binary.BigEndian.PutUint32(ssrcBuffer, ready.SSRC)
-	_, err = voice.udp.Write(ssrcBuffer)
+	_, err = conn.udp.Write(ssrcBuffer)
 	if err != nil {
 		return
 	}
 
 	ipBuffer := make([]byte, 70)
 	var n int
-	n, err = voice.udp.Read(ipBuffer)
+	n, err = conn.udp.Read(ipBuffer)
 	if err != nil {
 		return
 	}
@@ -224,12 +313,11 @@ waiter:
 	ip := ipb[:nullPos]
 	port := binary.LittleEndian.Uint16(ipBuffer[68:70])
 
-	// Tell the websocket which encryption mode we want to use. We'll go with XSalsa20 and Poly1305 since that's what
-	// libSodium/NaCl and golang.org/x/crypto/nacl/secretbox use. If both Discord and Go both start supporting more
-	// modes "out of the box" we might want to consider implementing a "preferred mode selection" algorithm here.
+	// Tell the websocket which encryption mode we want to use. All the XSalsa20 and Poly1305 modes are
+	// supported by golang.org/x/crypto/nacl/secretbox, and only differ in how the nonce is created.
 	var session *gateway.VoiceSessionDescription
-	session, err = voice.ws.SendUDPInfo(&gateway.VoiceSelectProtocolParams{
-		Mode:    "xsalsa20_poly1305",
+	session, err = conn.ws.SendUDPInfo(&gateway.VoiceSelectProtocolParams{
+		Mode:    conn.mode,
 		Address: ip,
 		Port:    port,
 	})
@@ -241,14 +329,12 @@ waiter:
 		return
 	}
 
-	voice.secretKey = session.SecretKey
-	voice.ready.Store(true)
-
-	go voice.opusSendLoop()
-	go voice.watcherDiscordCloseEvt()
-
-	ret = &voice
-	return
+	conn.secretKey = session.SecretKey
+	if session.Mode != "" && session.Mode != conn.mode {
+		err = errors.New("voice server selected the unrequested encryption mode " + session.Mode)
+		return
+	}
+	return conn, nil
 }
 
 func (r *voiceRepository) onVoiceStateUpdate(_ Session, event *VoiceStateUpdate) {
@@ -263,6 +349,13 @@ func (r *voiceRepository) onVoiceStateUpdate(_ Session, event *VoiceStateUpdate)
 		r.Unlock()
 
 		ch <- event
+	} else if voice, exists := r.connections[event.VoiceState.GuildID]; exists && event.SessionID != "" {
+		r.Unlock()
+
+		// used on the next voice server migration
+		voice.Lock()
+		voice.sessionID = event.SessionID
+		voice.Unlock()
 	} else {
 		r.Unlock()
 	}
@@ -272,15 +365,83 @@ func (r *voiceRepository) onVoiceServerUpdate(_ Session, event *VoiceServerUpdat
 	r.Lock()
 
 	if ch, exists := r.pendingServers[event.GuildID]; exists {
-		delete(r.pendingStates, event.GuildID)
+		delete(r.pendingServers, event.GuildID)
 		r.Unlock()
 
 		ch <- event
+	} else if voice, exists := r.connections[event.GuildID]; exists {
+		r.Unlock()
+
+		// Discord moved the voice session to another voice server
+		go voice.migrate(event)
 	} else {
 		r.Unlock()
 	}
 }
 
+// forget removes a closed voice connection, unless it has already been replaced
+func (r *voiceRepository) forget(voice *voiceImpl) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.connections[voice.guildID] == voice {
+		delete(r.connections, voice.guildID)
+	}
+}
+
+// migrate connects to the new voice server, and replaces the current voice server connection once it is ready.
+// The send channel is kept, so an ongoing playback continues on the new voice server.
+func (v *voiceImpl) migrate(server *VoiceServerUpdate) {
+	if server.Endpoint == "" {
+		// the voice server is gone. Discord sends another update once a new voice server is allocated
+		return
+	}
+
+	v.migrateMu.Lock()
+	defer v.migrateMu.Unlock()
+
+	v.Lock()
+	if !v.ready.Load() {
+		v.Unlock()
+		return
+	}
+	sessionID := v.sessionID
+	v.Unlock()
+
+	v.c.log.Info("voice server migration for guild", v.guildID, "to", server.Endpoint)
+	conn, err := v.c.voiceRepository.connectVoiceServer(v, sessionID, server)
+	if err != nil {
+		v.c.log.Error("unable to migrate voice connection:", err)
+		v.closeByDiscord()
+		return
+	}
+
+	v.Lock()
+	if !v.ready.Load() {
+		v.Unlock()
+		_ = conn.close()
+		return
+	}
+	old := &voiceServerConn{ws: v.ws, udp: v.udp}
+	v.ws, v.udp = conn.ws, conn.udp
+	v.ssrc, v.mode, v.secretKey = conn.ssrc, conn.mode, conn.secretKey
+	speaking := v.speaking
+	v.Unlock()
+
+	_ = old.close()
+	select {
+	case v.migrated <- struct{}{}:
+	default:
+	}
+
+	// the SSRC is new, so Discord must be told again
+	if speaking {
+		if err = v.speakingImpl(true); err != nil {
+			v.c.log.Error("unable to resume speaking after voice server migration:", err)
+		}
+	}
+}
+
 func (v *voiceImpl) StartSpeaking() error {
 	return v.speakingImpl(true)
 }
@@ -297,6 +458,7 @@ func (v *voiceImpl) speakingImpl(b bool) error {
 		return errors.New("attempting to interact with a closed voice connection")
 	}
 
+	v.speaking = b
 	return v.ws.Emit(cmd.VoiceSpeaking, &voiceSpeakingData{
 		Speaking: b,
 		SSRC:     v.ssrc,
@@ -307,31 +469,54 @@ func (v *voiceImpl) SendOpusFrame(data []byte) error {
 	if !v.ready.Load() {
 		return errors.New("attempting to send to a closed voice connection")
 	}
-	v.send <- data
-	return nil
+	return v.sendFrame(&voiceFrame{opus: data, samples: opusFrameSamples})
 }
 
-func (v *voiceImpl) SendDCA(r io.Reader) error {
-	if !v.ready.Load() {
+// sendFrame blocks until the frame is picked up by the send loop
+func (v *voiceImpl) sendFrame(frame *voiceFrame) error {
+	select {
+	case v.send <- frame:
+		return nil
+	case <-v.close:
 		return errors.New("attempting to send to a closed voice connection")
 	}
+}
 
-	var sampleSize uint16
+// sendFrames sends every frame of the source, until it ends
+func (v *voiceImpl) sendFrames(src voiceFrameSource) error {
 	for {
-		if err := binary.Read(r, binary.LittleEndian, &sampleSize); err != nil {
+		frame, err := src.next()
+		if err != nil {
 			if err == io.EOF {
 				return nil
 			}
 			return err
 		}
 
-		buf := make([]byte, sampleSize)
-		if _, err := io.ReadFull(r, buf); err != nil {
-			panic(err)
+		if err = v.sendFrame(frame); err != nil {
+			return err
 		}
+	}
+}
+
+func (v *voiceImpl) SendDCA(r io.Reader) error {
+	if !v.ready.Load() {
+		return errors.New("attempting to send to a closed voice connection")
+	}
 
-		v.send <- buf
+	return v.sendFrames(&dcaReader{r: r})
+}
+
+func (v *voiceImpl) SendOggOpus(r io.Reader) error {
+	if !v.ready.Load() {
+		return errors.New("attempting to send to a closed voice connection")
 	}
+
+	ogg, err := newOggOpusReader(r)
+	if err != nil {
+		return err
+	}
+	return v.sendFrames(ogg)
 }
 
 func (v *voiceImpl) MoveTo(channelID Snowflake) error {
@@ -358,17 +543,45 @@ func (v *voiceImpl) MoveTo(channelID Snowflake) error {
 
 func (v *voiceImpl) watcherDiscordCloseEvt() {
 	for {
-		var open bool
+		v.Lock()
+		ws := v.ws
+		v.Unlock()
+
 		select {
 		case <-v.close:
 			return
-		case _, open = <-v.ws.Active():
+		case <-ws.Active():
 		}
-		if !open {
-			break
+
+		v.Lock()
+		migrated := v.ws != ws
+		v.Unlock()
+		if migrated {
+			// the old connection was closed by the migration itself
+			select {
+			case <-v.migrated:
+			default:
+			}
+			continue
+		}
+
+		// Discord closes the connection when the session moves to another voice server, which might happen
+		// before the new voice server is announced. Give the migration a moment before closing.
+		select {
+		case <-v.close:
+			return
+		case <-v.migrated:
+			continue
+		case <-time.After(voiceMigrationTimeout):
 		}
+		break
 	}
 
+	v.closeByDiscord()
+}
+
+// closeByDiscord cleans up after Discord closed the voice connection for good
+func (v *voiceImpl) closeByDiscord() {
 	v.Lock()
 	defer v.Unlock()
 
@@ -376,17 +589,13 @@ func (v *voiceImpl) watcherDiscordCloseEvt() {
 		return
 	}
 	v.ready.Store(false)
+	v.c.voiceRepository.forget(v)
 
+	// senders are released by the close channel, so the send channel is never closed
 	close(v.close)
-	// clear send channel
-	select {
-	case <-v.send:
-	default:
-	}
 
 	_ = v.udp.Close()
 	_ = v.ws.Disconnect()
-	close(v.send)
 
 	//for range v.ws.Receive() {} // drain
 
@@ -394,21 +603,21 @@ func (v *voiceImpl) watcherDiscordCloseEvt() {
 }
 
 func (v *voiceImpl) Close() (err error) {
+	// the recorder finishes once the receive loop exits, which requires the lock
+	defer v.waitForRecording()
+
 	v.Lock()
 	defer v.Unlock()
 
 	if !v.ready.Load() {
 		return errors.New("attempting to close a closed Voice Connection")
 	}
+	v.ready.Store(false)
+	v.c.voiceRepository.forget(v)
 
 	defer func() {
+		// senders are released by the close channel, so the send channel is never closed
 		close(v.close)
-		// clear send channel
-		select {
-		case <-v.send:
-		default:
-		}
-		close(v.send)
 	}()
 
 	// if discord have already closed the connection
@@ -451,26 +660,25 @@ type voiceSpeakingData struct {
 
 func (v *voiceImpl) opusSendLoop() {
 	// https://discord.com/developers/docs/topics/voice-connections#encrypting-and-sending-voice
-	header := make([]byte, 12)
+	header := make([]byte, rtpHeaderSize)
 	header[0] = 0x80
-	header[1] = 0x78
-	binary.BigEndian.PutUint32(header[8:12], v.ssrc)
+	header[1] = rtpPayloadType
 
 	var (
 		sequence  uint16
 		timestamp uint32
-		nonce     [24]byte
+		liteNonce uint32
 
-		msg  []byte
-		open bool
-	)
+		// next is when the next frame should be sent, as each frame must be played before the next is sent
+		next time.Time
 
-	frequency := time.NewTicker(time.Millisecond * 20) // 50 sends per sec, 960 samples each at 48kHz
-	defer frequency.Stop()
+		frame *voiceFrame
+		open  bool
+	)
 
 	for {
 		select {
-		case msg, open = <-v.send:
+		case frame, open = <-v.send:
 			if !open {
 				return
 			}
@@ -478,22 +686,37 @@ func (v *voiceImpl) opusSendLoop() {
 			return
 		}
 
+		// the voice server, and with it the SSRC, mode and key, might change during a migration
+		v.Lock()
+		udp, ssrc, mode, secretKey := v.udp, v.ssrc, v.mode, v.secretKey
+		v.Unlock()
+		binary.BigEndian.PutUint32(header[8:12], ssrc)
+
 		binary.BigEndian.PutUint16(header[2:4], sequence)
 		sequence++
 
 		binary.BigEndian.PutUint32(header[4:8], timestamp)
-		timestamp += 960 // samples
+		timestamp += frame.samples
 
-		copy(nonce[:], header)
+		toSend, err := sealVoicePayload(mode, header, frame.opus, &secretKey, &liteNonce)
+		if err != nil {
+			v.c.log.Error("unable to encrypt voice packet:", err)
+			continue
+		}
 
-		toSend := secretbox.Seal(header, msg, &nonce, &v.secretKey)
-		select {
-		case <-frequency.C:
-		case <-v.close:
-			return
+		if wait := time.Until(next); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-v.close:
+				return
+			}
+		} else {
+			// the sender fell behind, so the pace starts over
+			next = time.Now()
 		}
+		next = next.Add(frame.duration())
 
-		_, _ = v.udp.Write(toSend)
+		_, _ = udp.Write(toSend)
 		// err on udp write? hahahahahah... hahah.. good joke.
 	}
 }
@@ -0,0 +1,118 @@
+package disgord
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Voice encryption modes supported by Disgord. See Config.VoiceEncryptionModes.
+// https://discord.com/developers/docs/topics/voice-connections#encrypting-and-sending-voice
+const (
+	// VoiceModeXSalsa20Poly1305 uses the RTP header as the nonce. Some voice servers no longer support it.
+	VoiceModeXSalsa20Poly1305 = "xsalsa20_poly1305"
+
+	// VoiceModeXSalsa20Poly1305Suffix uses a random 24 byte nonce, appended to the payload.
+	VoiceModeXSalsa20Poly1305Suffix = "xsalsa20_poly1305_suffix"
+
+	// VoiceModeXSalsa20Poly1305Lite uses an incrementing 4 byte nonce, appended to the payload.
+	VoiceModeXSalsa20Poly1305Lite = "xsalsa20_poly1305_lite"
+)
+
+// defaultVoiceEncryptionModes is the preference order when Config.VoiceEncryptionModes is empty
+var defaultVoiceEncryptionModes = []string{
+	VoiceModeXSalsa20Poly1305Lite,
+	VoiceModeXSalsa20Poly1305Suffix,
+	VoiceModeXSalsa20Poly1305,
+}
+
+// selectVoiceEncryptionMode picks the first preferred mode that is offered by the voice server
+func selectVoiceEncryptionMode(preferred, offered []string) (string, error) {
+	if len(preferred) == 0 {
+		preferred = defaultVoiceEncryptionModes
+	}
+
+	for _, mode := range preferred {
+		if !isVoiceEncryptionModeSupported(mode) {
+			continue
+		}
+		for i := range offered {
+			if offered[i] == mode {
+				return mode, nil
+			}
+		}
+	}
+	return "", errors.New("the voice server does not offer any of the preferred encryption modes")
+}
+
+func isVoiceEncryptionModeSupported(mode string) bool {
+	for i := range defaultVoiceEncryptionModes {
+		if defaultVoiceEncryptionModes[i] == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// sealVoicePayload encrypts the payload and returns the complete RTP packet. The lite nonce is incremented
+// for every packet when the lite mode is used.
+func sealVoicePayload(mode string, header, payload []byte, secretKey *[32]byte, liteNonce *uint32) ([]byte, error) {
+	var nonce [24]byte
+	packet := make([]byte, len(header), len(header)+len(payload)+secretbox.Overhead+len(nonce))
+	copy(packet, header)
+
+	switch mode {
+	case VoiceModeXSalsa20Poly1305:
+		copy(nonce[:], header[:rtpHeaderSize])
+		return secretbox.Seal(packet, payload, &nonce, secretKey), nil
+	case VoiceModeXSalsa20Poly1305Suffix:
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return nil, err
+		}
+		packet = secretbox.Seal(packet, payload, &nonce, secretKey)
+		return append(packet, nonce[:]...), nil
+	case VoiceModeXSalsa20Poly1305Lite:
+		*liteNonce++
+		binary.BigEndian.PutUint32(nonce[:4], *liteNonce)
+		packet = secretbox.Seal(packet, payload, &nonce, secretKey)
+		return append(packet, nonce[:4]...), nil
+	default:
+		return nil, errors.New("unsupported voice encryption mode " + mode)
+	}
+}
+
+// openVoicePayload decrypts the payload of a RTP packet, where headerSize is the size of the RTP header
+func openVoicePayload(mode string, data []byte, headerSize int, secretKey *[32]byte) ([]byte, error) {
+	var nonce [24]byte
+	ciphertext := data[headerSize:]
+
+	switch mode {
+	case VoiceModeXSalsa20Poly1305:
+		copy(nonce[:], data[:rtpHeaderSize])
+	case VoiceModeXSalsa20Poly1305Suffix:
+		if len(ciphertext) < len(nonce) {
+			return nil, errors.New("voice packet is missing the nonce")
+		}
+		copy(nonce[:], ciphertext[len(ciphertext)-len(nonce):])
+		ciphertext = ciphertext[:len(ciphertext)-len(nonce)]
+	case VoiceModeXSalsa20Poly1305Lite:
+		if len(ciphertext) < 4 {
+			return nil, errors.New("voice packet is missing the nonce")
+		}
+		copy(nonce[:4], ciphertext[len(ciphertext)-4:])
+		ciphertext = ciphertext[:len(ciphertext)-4]
+	default:
+		return nil, errors.New("unsupported voice encryption mode " + mode)
+	}
+
+	if len(ciphertext) < secretbox.Overhead {
+		return nil, errors.New("RTP packet is too short")
+	}
+	payload, ok := secretbox.Open(nil, ciphertext, &nonce, secretKey)
+	if !ok {
+		return nil, errors.New("unable to decrypt voice packet")
+	}
+	return payload, nil
+}
@@ -0,0 +1,82 @@
+package disgord
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	opusSampleRate   = 48000
+	opusFrameSamples = 960  // 20ms
+	opusMaxSamples   = 5760 // 120ms, the longest opus packet
+)
+
+// voiceFrame is an opus packet that is waiting to be sent
+type voiceFrame struct {
+	opus []byte
+
+	// samples is the number of 48kHz samples in the frame per channel, which decides how long it plays
+	samples uint32
+}
+
+func (f *voiceFrame) duration() time.Duration {
+	return samplesToDuration(uint64(f.samples))
+}
+
+// samplesToDuration converts a number of 48kHz samples to the time it takes to play them
+func samplesToDuration(samples uint64) time.Duration {
+	return time.Duration(samples) * time.Second / opusSampleRate
+}
+
+// voiceFrameSource reads opus frames from an audio container, see dcaReader and oggOpusReader.
+// io.EOF is returned once the source has ended.
+type voiceFrameSource interface {
+	next() (*voiceFrame, error)
+}
+
+// dcaReader reads the length prefixed opus frames of a DCA stream, which are always 20ms
+type dcaReader struct {
+	r io.Reader
+}
+
+func (d *dcaReader) next() (*voiceFrame, error) {
+	var size uint16
+	if err := binary.Read(d.r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+
+	frame := &voiceFrame{opus: make([]byte, size), samples: opusFrameSamples}
+	if _, err := io.ReadFull(d.r, frame.opus); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return frame, nil
+}
+
+var _ voiceFrameSource = (*dcaReader)(nil)
+var _ voiceFrameSource = (*oggOpusReader)(nil)
+
+// peekableSource allows the next frame to be inspected before it is read
+type peekableSource struct {
+	src    voiceFrameSource
+	peeked *voiceFrame
+}
+
+func (s *peekableSource) peek() (*voiceFrame, error) {
+	if s.peeked == nil {
+		frame, err := s.src.next()
+		if err != nil {
+			return nil, err
+		}
+		s.peeked = frame
+	}
+	return s.peeked, nil
+}
+
+func (s *peekableSource) next() (*voiceFrame, error) {
+	if frame := s.peeked; frame != nil {
+		s.peeked = nil
+		return frame, nil
+	}
+	return s.src.next()
+}
@@ -0,0 +1,362 @@
+package disgord
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	oggContinuedPacket = 0x01
+	oggFirstPage       = 0x02
+	oggLastPage        = 0x04
+
+	oggPageHeaderSize = 27
+)
+
+// oggCRCTable is the CRC-32 lookup table used by Ogg. Unlike the common CRC-32, the Ogg checksum
+// is not reflected, and can therefore not use hash/crc32.
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04C11DB7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return
+}()
+
+func oggCRC(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// oggPage is a single page of an Ogg stream
+// https://tools.ietf.org/html/rfc3533#section-6
+type oggPage struct {
+	headerType byte
+	granule    int64
+	serial     uint32
+	lacing     []byte
+	data       []byte
+}
+
+func readOggPage(r io.Reader) (*oggPage, error) {
+	header := make([]byte, oggPageHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "OggS" {
+		return nil, errors.New("missing ogg page capture pattern")
+	}
+	if header[4] != 0 {
+		return nil, errors.New("unsupported ogg version")
+	}
+
+	page := &oggPage{
+		headerType: header[5],
+		granule:    int64(binary.LittleEndian.Uint64(header[6:14])),
+		serial:     binary.LittleEndian.Uint32(header[14:18]),
+		lacing:     make([]byte, header[26]),
+	}
+	if _, err := io.ReadFull(r, page.lacing); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	var size int
+	for _, lace := range page.lacing {
+		size += int(lace)
+	}
+	page.data = make([]byte, size)
+	if _, err := io.ReadFull(r, page.data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	checksum := binary.LittleEndian.Uint32(header[22:26])
+	copy(header[22:26], []byte{0, 0, 0, 0})
+	crc := oggCRC(0, header)
+	crc = oggCRC(crc, page.lacing)
+	crc = oggCRC(crc, page.data)
+	if crc != checksum {
+		return nil, errors.New("ogg page checksum mismatch")
+	}
+
+	return page, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// oggOpusReader demuxes the opus packets of an Ogg Opus stream. Only the first logical stream is read,
+// any other multiplexed stream is ignored.
+// https://tools.ietf.org/html/rfc7845
+type oggOpusReader struct {
+	r      io.Reader
+	serial uint32
+
+	// partial is a packet that continues on the next page
+	partial []byte
+
+	// granule is the granule position of the last page, used to find the duration of the packets
+	granule int64
+	frames  []*voiceFrame
+	done    bool
+}
+
+// newOggOpusReader reads and validates the OpusHead and OpusTags headers
+func newOggOpusReader(r io.Reader) (*oggOpusReader, error) {
+	o := &oggOpusReader{r: r}
+
+	page, err := readOggPage(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if page.headerType&oggFirstPage == 0 {
+		return nil, errors.New("ogg stream does not start with a beginning of stream page")
+	}
+	o.serial = page.serial
+
+	// the first page holds only the OpusHead header
+	// https://tools.ietf.org/html/rfc7845#section-5.1
+	packets := o.packets(page)
+	if len(packets) != 1 || o.partial != nil {
+		return nil, errors.New("the first ogg page must only contain the OpusHead header")
+	}
+	head := packets[0]
+	if len(head) < 19 || !bytes.HasPrefix(head, []byte("OpusHead")) {
+		return nil, errors.New("missing OpusHead header, the ogg stream does not contain opus")
+	}
+	if head[8]>>4 != 0 {
+		return nil, errors.New("unsupported OpusHead version")
+	}
+	if head[9] == 0 {
+		return nil, errors.New("OpusHead header has an invalid channel count")
+	}
+
+	// the OpusTags header might span several pages, and is followed by the audio data on a new page
+	// https://tools.ietf.org/html/rfc7845#section-5.2
+	var tags [][]byte
+	for len(tags) == 0 {
+		if tags, _, err = o.nextPage(); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	if len(tags) != 1 || !bytes.HasPrefix(tags[0], []byte("OpusTags")) {
+		return nil, errors.New("missing OpusTags header")
+	}
+	if o.partial != nil {
+		return nil, errors.New("the OpusTags header must end the ogg page")
+	}
+
+	return o, nil
+}
+
+// packets returns the packets that are completed on the page. Packets that continue on the next page
+// are kept until the next page is read.
+func (o *oggOpusReader) packets(page *oggPage) (packets [][]byte) {
+	if page.headerType&oggContinuedPacket == 0 {
+		o.partial = nil // the continuation was lost
+	}
+
+	var offset int
+	for _, lace := range page.lacing {
+		o.partial = append(o.partial, page.data[offset:offset+int(lace)]...)
+		offset += int(lace)
+
+		// a lacing value below 255 ends the packet
+		if lace < 255 {
+			packets = append(packets, o.partial)
+			o.partial = nil
+		}
+	}
+	return packets
+}
+
+// nextPage returns the packets completed on the next page of the opus stream
+func (o *oggOpusReader) nextPage() (packets [][]byte, page *oggPage, err error) {
+	for {
+		if page, err = readOggPage(o.r); err != nil {
+			return nil, nil, err
+		}
+		if page.serial == o.serial {
+			break
+		}
+	}
+	if page.headerType&oggLastPage != 0 {
+		o.done = true
+	}
+	return o.packets(page), page, nil
+}
+
+// next returns the next opus packet, or io.EOF once the stream has ended
+func (o *oggOpusReader) next() (*voiceFrame, error) {
+	for len(o.frames) == 0 {
+		if o.done {
+			return nil, io.EOF
+		}
+
+		packets, page, err := o.nextPage()
+		if err != nil {
+			return nil, err
+		}
+		if len(packets) == 0 {
+			continue
+		}
+
+		// the granule position is the sample count at the end of the last packet completed on the page
+		samples := uint32(opusFrameSamples)
+		if page.granule >= 0 {
+			if delta := page.granule - o.granule; delta > 0 {
+				samples = uint32(delta / int64(len(packets)))
+			}
+			o.granule = page.granule
+		}
+		if samples > opusMaxSamples {
+			// the stream does not start at zero, eg. a cut live stream
+			samples = opusFrameSamples
+		}
+
+		for _, packet := range packets {
+			if len(packet) == 0 {
+				continue
+			}
+			o.frames = append(o.frames, &voiceFrame{opus: packet, samples: samples})
+		}
+	}
+
+	frame := o.frames[0]
+	o.frames = o.frames[1:]
+	return frame, nil
+}
+
+// oggOpusWriter muxes opus packets into an Ogg Opus stream, without decoding them
+type oggOpusWriter struct {
+	w        io.WriteCloser
+	serial   uint32
+	sequence uint32
+
+	// granule is the number of samples written, including the buffered packets
+	granule int64
+	packets [][]byte
+	lacing  int
+}
+
+const (
+	// oggPagePackets is the number of packets per page, one second of 20ms frames
+	oggPagePackets = 50
+	oggMaxLacing   = 255
+)
+
+// newOggOpusWriter writes the OpusHead and OpusTags headers for a 48kHz stereo stream
+func newOggOpusWriter(w io.WriteCloser, serial uint32) (*oggOpusWriter, error) {
+	o := &oggOpusWriter{w: w, serial: serial}
+
+	// https://tools.ietf.org/html/rfc7845#section-5.1
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1 // version
+	head[9] = 2 // channels
+	binary.LittleEndian.PutUint32(head[12:16], opusSampleRate)
+	if err := o.writePage(oggFirstPage, [][]byte{head}); err != nil {
+		return nil, err
+	}
+
+	// https://tools.ietf.org/html/rfc7845#section-5.2
+	const vendor = "disgord"
+	tags := make([]byte, 8+4+len(vendor)+4)
+	copy(tags, "OpusTags")
+	binary.LittleEndian.PutUint32(tags[8:12], uint32(len(vendor)))
+	copy(tags[12:], vendor)
+	if err := o.writePage(0, [][]byte{tags}); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// write adds an opus packet with the given number of samples to the stream
+func (o *oggOpusWriter) write(packet []byte, samples uint32) error {
+	lacing := len(packet)/255 + 1
+	if o.lacing+lacing > oggMaxLacing {
+		if err := o.flush(0); err != nil {
+			return err
+		}
+	}
+
+	o.packets = append(o.packets, packet)
+	o.lacing += lacing
+	o.granule += int64(samples)
+	if len(o.packets) >= oggPagePackets {
+		return o.flush(0)
+	}
+	return nil
+}
+
+func (o *oggOpusWriter) flush(headerType byte) error {
+	if len(o.packets) == 0 && headerType&oggLastPage == 0 {
+		return nil
+	}
+
+	err := o.writePage(headerType, o.packets)
+	o.packets, o.lacing = nil, 0
+	return err
+}
+
+// close ends the stream and closes the underlying writer
+func (o *oggOpusWriter) close() error {
+	err := o.flush(oggLastPage)
+	if errClose := o.w.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+func (o *oggOpusWriter) writePage(headerType byte, packets [][]byte) error {
+	var lacing []byte
+	var size int
+	for _, packet := range packets {
+		for n := len(packet); ; n -= 255 {
+			if n < 255 {
+				lacing = append(lacing, byte(n))
+				break
+			}
+			lacing = append(lacing, 255)
+		}
+		size += len(packet)
+	}
+
+	// the header pages have a granule position of zero
+	var granule int64
+	if o.sequence > 1 {
+		granule = o.granule
+	}
+
+	page := make([]byte, oggPageHeaderSize, oggPageHeaderSize+len(lacing)+size)
+	copy(page, "OggS")
+	page[5] = headerType
+	binary.LittleEndian.PutUint64(page[6:14], uint64(granule))
+	binary.LittleEndian.PutUint32(page[14:18], o.serial)
+	binary.LittleEndian.PutUint32(page[18:22], o.sequence)
+	page[26] = byte(len(lacing))
+	page = append(page, lacing...)
+	for _, packet := range packets {
+		page = append(page, packet...)
+	}
+	binary.LittleEndian.PutUint32(page[22:26], oggCRC(0, page))
+	o.sequence++
+
+	_, err := o.w.Write(page)
+	return err
+}
@@ -0,0 +1,117 @@
+// +build !integration
+
+package disgord
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// oggPageBytes creates an ogg page. The last packet continues on the next page when partial is true.
+func oggPageBytes(headerType byte, granule int64, serial uint32, partial bool, packets ...[]byte) []byte {
+	var lacing, data []byte
+	for i, packet := range packets {
+		data = append(data, packet...)
+		size := len(packet)
+		for ; size >= 255; size -= 255 {
+			lacing = append(lacing, 255)
+		}
+		if !partial || i < len(packets)-1 {
+			lacing = append(lacing, byte(size))
+		}
+	}
+
+	header := make([]byte, oggPageHeaderSize)
+	copy(header, "OggS")
+	header[5] = headerType
+	binary.LittleEndian.PutUint64(header[6:14], uint64(granule))
+	binary.LittleEndian.PutUint32(header[14:18], serial)
+	header[26] = byte(len(lacing))
+
+	crc := oggCRC(0, header)
+	crc = oggCRC(crc, lacing)
+	crc = oggCRC(crc, data)
+	binary.LittleEndian.PutUint32(header[22:26], crc)
+
+	page := append(header, lacing...)
+	return append(page, data...)
+}
+
+func opusHead() []byte {
+	head := []byte("OpusHead")
+	head = append(head, 1, 2)             // version, channels
+	head = append(head, 0x38, 0x01)       // pre-skip
+	head = append(head, 0x80, 0xBB, 0, 0) // 48kHz
+	head = append(head, 0, 0, 0)          // gain, mapping family
+	return head
+}
+
+func TestOggOpusReader(t *testing.T) {
+	const serial = 1234
+	long := bytes.Repeat([]byte{7}, 300) // spans two pages
+
+	var stream []byte
+	stream = append(stream, oggPageBytes(oggFirstPage, 0, serial, false, opusHead())...)
+	stream = append(stream, oggPageBytes(0, 0, serial, false, []byte("OpusTags"))...)
+	stream = append(stream, oggPageBytes(oggFirstPage, 0, 99, false, []byte("another stream"))...)
+	stream = append(stream, oggPageBytes(0, 3840, serial, false, []byte{1}, []byte{2})...) // 40ms frames
+	stream = append(stream, oggPageBytes(0, -1, serial, true, long[:255])...)
+	stream = append(stream, oggPageBytes(oggContinuedPacket|oggLastPage, 4800, serial, false, long[255:])...)
+
+	ogg, err := newOggOpusReader(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*voiceFrame{
+		{opus: []byte{1}, samples: 1920},
+		{opus: []byte{2}, samples: 1920},
+		{opus: long, samples: 960},
+	}
+	for i := range expected {
+		frame, err := ogg.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(frame.opus, expected[i].opus) {
+			t.Errorf("frame %d: expected opus packet of %d bytes. Got %d bytes", i, len(expected[i].opus), len(frame.opus))
+		}
+		if frame.samples != expected[i].samples {
+			t.Errorf("frame %d: expected %d samples. Got %d", i, expected[i].samples, frame.samples)
+		}
+	}
+	if _, err = ogg.next(); err != io.EOF {
+		t.Errorf("expected io.EOF after the last page. Got %v", err)
+	}
+}
+
+func TestOggOpusReader_Invalid(t *testing.T) {
+	t.Run("not opus", func(t *testing.T) {
+		stream := oggPageBytes(oggFirstPage, 0, 1, false, []byte("\x01vorbis"))
+		if _, err := newOggOpusReader(bytes.NewReader(stream)); err == nil {
+			t.Error("expected missing OpusHead to fail")
+		}
+	})
+	t.Run("missing tags", func(t *testing.T) {
+		stream := oggPageBytes(oggFirstPage, 0, 1, false, opusHead())
+		stream = append(stream, oggPageBytes(0, 960, 1, false, []byte{1})...)
+		if _, err := newOggOpusReader(bytes.NewReader(stream)); err == nil {
+			t.Error("expected missing OpusTags to fail")
+		}
+	})
+	t.Run("checksum", func(t *testing.T) {
+		stream := oggPageBytes(oggFirstPage, 0, 1, false, opusHead())
+		stream[len(stream)-1] ^= 0xFF
+		if _, err := newOggOpusReader(bytes.NewReader(stream)); err == nil {
+			t.Error("expected a corrupt page to fail")
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		stream := oggPageBytes(oggFirstPage, 0, 1, false, opusHead())
+		if _, err := newOggOpusReader(bytes.NewReader(stream[:len(stream)-2])); err != io.ErrUnexpectedEOF {
+			t.Errorf("expected io.ErrUnexpectedEOF. Got %v", err)
+		}
+	})
+}
@@ -0,0 +1,449 @@
+package disgord
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// VoiceFormat is the audio container of a VoiceTrack
+type VoiceFormat int
+
+const (
+	// VoiceFormatDCA is the length prefixed opus format, see VoiceConnection.SendDCA
+	VoiceFormatDCA VoiceFormat = iota
+	// VoiceFormatOggOpus is the format of .opus files, see VoiceConnection.SendOggOpus
+	VoiceFormatOggOpus
+)
+
+// VoiceTrack is an opus encoded audio stream that can be played by a VoicePlayer
+type VoiceTrack struct {
+	// Title is not used by the player, but helps telling the tracks apart
+	Title  string
+	Format VoiceFormat
+
+	// Open returns the audio stream of the track. Seeking backwards opens the stream again.
+	Open func() (io.ReadCloser, error)
+}
+
+func (t *VoiceTrack) open() (io.ReadCloser, *peekableSource, error) {
+	if t.Open == nil {
+		return nil, nil, errors.New("track is missing the Open function")
+	}
+
+	r, err := t.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var src voiceFrameSource
+	switch t.Format {
+	case VoiceFormatDCA:
+		src = &dcaReader{r: r}
+	case VoiceFormatOggOpus:
+		if src, err = newOggOpusReader(r); err != nil {
+			_ = r.Close()
+			return nil, nil, err
+		}
+	default:
+		_ = r.Close()
+		return nil, nil, errors.New("unknown voice track format")
+	}
+	return r, &peekableSource{src: src}, nil
+}
+
+// voicePlayback is the state of the track being played
+type voicePlayback struct {
+	track *VoiceTrack
+	r     io.ReadCloser
+	src   *peekableSource
+}
+
+// VoicePlayerConfig holds the event handlers of a VoicePlayer. The handlers are called from the playback
+// goroutine, so they must not block, nor call the Pause, Resume, Skip, Seek or Stop methods.
+type VoicePlayerConfig struct {
+	// TrackStart is called when a track starts playing
+	TrackStart func(track *VoiceTrack)
+
+	// TrackEnd is called when a track has finished playing, or was skipped
+	TrackEnd func(track *VoiceTrack, skipped bool)
+
+	// TrackError is called when a track fails to play, after which the next track is played
+	TrackError func(track *VoiceTrack, err error)
+}
+
+type voicePlayerCmd int
+
+const (
+	voicePlayerPause voicePlayerCmd = iota
+	voicePlayerResume
+	voicePlayerSkip
+	voicePlayerSeek
+)
+
+type voicePlayerRequest struct {
+	cmd      voicePlayerCmd
+	position time.Duration
+	result   chan error
+}
+
+// voiceFrameSender is implemented by voice connections that supports frames of any duration
+type voiceFrameSender interface {
+	sendFrame(frame *voiceFrame) error
+}
+
+// VoicePlayer plays a queue of tracks on a voice connection. The player sends SPEAKING when a track starts,
+// and sends silence followed by SPEAKING 0 when it pauses or runs out of tracks.
+type VoicePlayer struct {
+	sync.Mutex
+	voice VoiceConnection
+	conf  VoicePlayerConfig
+
+	queue   []*VoiceTrack
+	current *VoiceTrack
+	samples uint64 // played samples of the current track
+	paused  bool
+
+	requests chan *voicePlayerRequest
+	enqueued chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewVoicePlayer creates a player for the voice connection. The config is optional.
+func NewVoicePlayer(voice VoiceConnection, config *VoicePlayerConfig) *VoicePlayer {
+	p := &VoicePlayer{
+		voice:    voice,
+		requests: make(chan *voicePlayerRequest),
+		enqueued: make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if config != nil {
+		p.conf = *config
+	}
+
+	go p.run()
+	return p
+}
+
+// Enqueue adds the tracks to the end of the queue. Playback starts right away when the player is idle.
+func (p *VoicePlayer) Enqueue(tracks ...*VoiceTrack) {
+	p.Lock()
+	p.queue = append(p.queue, tracks...)
+	p.Unlock()
+
+	select {
+	case p.enqueued <- struct{}{}:
+	default:
+	}
+}
+
+// Queue returns the tracks waiting to be played, not including the current track
+func (p *VoicePlayer) Queue() []*VoiceTrack {
+	p.Lock()
+	defer p.Unlock()
+
+	return append([]*VoiceTrack(nil), p.queue...)
+}
+
+// NowPlaying returns the current track, or nil when nothing is playing
+func (p *VoicePlayer) NowPlaying() *VoiceTrack {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.current
+}
+
+// Position returns how much of the current track has been sent
+func (p *VoicePlayer) Position() time.Duration {
+	p.Lock()
+	defer p.Unlock()
+
+	return samplesToDuration(p.samples)
+}
+
+// Paused reports whether the current track is paused
+func (p *VoicePlayer) Paused() bool {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.paused
+}
+
+// Pause pauses the current track
+func (p *VoicePlayer) Pause() error {
+	return p.request(&voicePlayerRequest{cmd: voicePlayerPause})
+}
+
+// Resume continues a paused track
+func (p *VoicePlayer) Resume() error {
+	return p.request(&voicePlayerRequest{cmd: voicePlayerResume})
+}
+
+// Skip ends the current track, and starts the next track in the queue
+func (p *VoicePlayer) Skip() error {
+	return p.request(&voicePlayerRequest{cmd: voicePlayerSkip})
+}
+
+// Seek moves to the frame at the given position of the current track. Seeking past the end of the track
+// ends it.
+func (p *VoicePlayer) Seek(position time.Duration) error {
+	if position < 0 {
+		return errors.New("can not seek to a negative position")
+	}
+	return p.request(&voicePlayerRequest{cmd: voicePlayerSeek, position: position})
+}
+
+// Stop ends the current track, clears the queue and stops the player. The player can not be used afterwards.
+func (p *VoicePlayer) Stop() {
+	p.stopOnce.Do(func() {
+		p.Lock()
+		p.queue = nil
+		p.Unlock()
+		close(p.stop)
+	})
+	<-p.done
+}
+
+func (p *VoicePlayer) request(req *voicePlayerRequest) error {
+	req.result = make(chan error, 1)
+	select {
+	case p.requests <- req:
+		return <-req.result
+	case <-p.done:
+		return errors.New("the voice player has stopped")
+	}
+}
+
+func (p *VoicePlayer) run() {
+	defer close(p.done)
+
+	for {
+		track := p.nextTrack()
+		if track == nil {
+			return
+		}
+		if !p.play(track) {
+			return
+		}
+	}
+}
+
+// nextTrack waits for a track to be queued, and returns nil when the player is stopped
+func (p *VoicePlayer) nextTrack() *VoiceTrack {
+	for {
+		p.Lock()
+		if len(p.queue) > 0 {
+			track := p.queue[0]
+			p.queue = p.queue[1:]
+			p.Unlock()
+			return track
+		}
+		p.Unlock()
+
+		select {
+		case <-p.enqueued:
+		case req := <-p.requests:
+			req.result <- errors.New("nothing is playing")
+		case <-p.stop:
+			return nil
+		}
+	}
+}
+
+// play sends the track until it ends, and returns false when the player should stop
+func (p *VoicePlayer) play(track *VoiceTrack) (keepPlaying bool) {
+	r, src, err := track.open()
+	if err != nil {
+		p.trackError(track, err)
+		return true
+	}
+	pb := &voicePlayback{track: track, r: r, src: src}
+	defer func() {
+		if pb.r != nil {
+			_ = pb.r.Close()
+		}
+	}()
+
+	p.Lock()
+	p.current, p.samples, p.paused = track, 0, false
+	p.Unlock()
+	defer func() {
+		p.Lock()
+		p.current, p.samples, p.paused = nil, 0, false
+		p.Unlock()
+	}()
+
+	if p.conf.TrackStart != nil {
+		p.conf.TrackStart(track)
+	}
+	_ = p.voice.StartSpeaking()
+	defer func() {
+		p.Lock()
+		idle := len(p.queue) == 0 || !keepPlaying
+		p.Unlock()
+
+		// a paused track has already been silenced, while speaking continues into the next track
+		if idle && !p.Paused() {
+			p.silence()
+		}
+	}()
+
+	for {
+		// controls are handled between frames, and the player waits for them while paused
+		for {
+			var req *voicePlayerRequest
+			if p.Paused() {
+				select {
+				case req = <-p.requests:
+				case <-p.stop:
+					return false
+				}
+			} else {
+				select {
+				case req = <-p.requests:
+				case <-p.stop:
+					return false
+				default:
+				}
+			}
+			if req == nil {
+				break
+			}
+			if ended := p.handle(pb, req); ended {
+				return true
+			}
+		}
+
+		frame, err := pb.src.next()
+		if err == io.EOF {
+			p.trackEnd(track, false)
+			return true
+		}
+		if err != nil {
+			p.trackError(track, err)
+			return true
+		}
+
+		if err = p.send(frame); err != nil {
+			// the voice connection is closed
+			p.trackError(track, err)
+			return false
+		}
+
+		p.Lock()
+		p.samples += uint64(frame.samples)
+		p.Unlock()
+	}
+}
+
+// handle executes a control request, and returns true when the track has ended
+func (p *VoicePlayer) handle(pb *voicePlayback, req *voicePlayerRequest) (ended bool) {
+	switch req.cmd {
+	case voicePlayerPause:
+		if !p.Paused() {
+			p.silence()
+			p.setPaused(true)
+		}
+		req.result <- nil
+	case voicePlayerResume:
+		if p.Paused() {
+			_ = p.voice.StartSpeaking()
+			p.setPaused(false)
+		}
+		req.result <- nil
+	case voicePlayerSkip:
+		req.result <- nil
+		p.trackEnd(pb.track, true)
+		return true
+	case voicePlayerSeek:
+		ended, err := p.seek(pb, req.position)
+		req.result <- err
+		if err != nil {
+			p.trackError(pb.track, err)
+			return true
+		}
+		if ended {
+			p.trackEnd(pb.track, false)
+			return true
+		}
+	}
+	return false
+}
+
+// seek skips frames until the position is reached. The track is opened again to seek backwards.
+func (p *VoicePlayer) seek(pb *voicePlayback, position time.Duration) (ended bool, err error) {
+	target := uint64(position * opusSampleRate / time.Second)
+
+	p.Lock()
+	samples := p.samples
+	p.Unlock()
+
+	if target < samples {
+		_ = pb.r.Close()
+		if pb.r, pb.src, err = pb.track.open(); err != nil {
+			return false, err
+		}
+		samples = 0
+	}
+
+	// frames are skipped as long as they end before the target, such that the position ends up at the
+	// start of the frame that holds the target
+	for {
+		var frame *voiceFrame
+		if frame, err = pb.src.peek(); err != nil {
+			break
+		}
+		if samples+uint64(frame.samples) > target {
+			break
+		}
+		_, _ = pb.src.next()
+		samples += uint64(frame.samples)
+	}
+	if err == io.EOF {
+		ended, err = true, nil
+	}
+
+	p.Lock()
+	p.samples = samples
+	p.Unlock()
+	return ended, err
+}
+
+func (p *VoicePlayer) send(frame *voiceFrame) error {
+	if sender, ok := p.voice.(voiceFrameSender); ok {
+		return sender.sendFrame(frame)
+	}
+	return p.voice.SendOpusFrame(frame.opus)
+}
+
+// silence avoids opus interpolation with the next transmission, see VoiceConnection.StopSpeaking
+func (p *VoicePlayer) silence() {
+	for i := 0; i < 5; i++ {
+		if err := p.send(&voiceFrame{opus: opusSilenceFrame, samples: opusFrameSamples}); err != nil {
+			return
+		}
+	}
+	_ = p.voice.StopSpeaking()
+}
+
+func (p *VoicePlayer) setPaused(paused bool) {
+	p.Lock()
+	p.paused = paused
+	p.Unlock()
+}
+
+func (p *VoicePlayer) trackEnd(track *VoiceTrack, skipped bool) {
+	if p.conf.TrackEnd != nil {
+		p.conf.TrackEnd(track, skipped)
+	}
+}
+
+func (p *VoicePlayer) trackError(track *VoiceTrack, err error) {
+	if p.conf.TrackError != nil {
+		p.conf.TrackError(track, err)
+	}
+}
@@ -0,0 +1,241 @@
+// +build !integration
+
+package disgord
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// playerTestVoice hands every frame sent by the player to the test, one by one
+type playerTestVoice struct {
+	VoiceConnection
+
+	frames chan *voiceFrame
+
+	mu       sync.Mutex
+	speaking []bool
+}
+
+func (v *playerTestVoice) StartSpeaking() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.speaking = append(v.speaking, true)
+	return nil
+}
+
+func (v *playerTestVoice) StopSpeaking() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.speaking = append(v.speaking, false)
+	return nil
+}
+
+func (v *playerTestVoice) sendFrame(frame *voiceFrame) error {
+	v.frames <- frame
+	return nil
+}
+
+func (v *playerTestVoice) expect(t *testing.T, payloads ...[]byte) {
+	for i := range payloads {
+		select {
+		case frame := <-v.frames:
+			if !bytes.Equal(frame.opus, payloads[i]) {
+				t.Fatalf("expected frame %v. Got %v", payloads[i], frame.opus)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected frame %v to be sent", payloads[i])
+		}
+	}
+}
+
+// until reads frames until the payload is sent, and returns the number of frames before it
+func (v *playerTestVoice) until(t *testing.T, payload []byte) (n int) {
+	for {
+		select {
+		case frame := <-v.frames:
+			if bytes.Equal(frame.opus, payload) {
+				return n
+			}
+			n++
+		case <-time.After(time.Second):
+			t.Fatalf("expected frame %v to be sent", payload)
+		}
+	}
+}
+
+func (v *playerTestVoice) expectSilence(t *testing.T) {
+	v.expect(t, opusSilenceFrame, opusSilenceFrame, opusSilenceFrame, opusSilenceFrame, opusSilenceFrame)
+}
+
+func dcaTrack(title byte, frames int) *VoiceTrack {
+	return &VoiceTrack{
+		Title:  string(title),
+		Format: VoiceFormatDCA,
+		Open: func() (io.ReadCloser, error) {
+			var dca bytes.Buffer
+			for i := 0; i < frames; i++ {
+				_ = binary.Write(&dca, binary.LittleEndian, uint16(2))
+				dca.Write([]byte{title, byte(i)})
+			}
+			return ioutil.NopCloser(&dca), nil
+		},
+	}
+}
+
+func TestVoicePlayer_Queue(t *testing.T) {
+	voice := &playerTestVoice{frames: make(chan *voiceFrame)}
+
+	var events []string
+	player := NewVoicePlayer(voice, &VoicePlayerConfig{
+		TrackStart: func(track *VoiceTrack) {
+			events = append(events, "start "+track.Title)
+		},
+		TrackEnd: func(track *VoiceTrack, skipped bool) {
+			events = append(events, "end "+track.Title)
+		},
+	})
+	defer player.Stop()
+
+	if err := player.Pause(); err == nil {
+		t.Error("expected an error when nothing is playing")
+	}
+
+	player.Enqueue(dcaTrack('a', 2), dcaTrack('b', 1))
+	voice.expect(t, []byte{'a', 0}, []byte{'a', 1}, []byte{'b', 0})
+	voice.expectSilence(t)
+	player.Stop()
+
+	expected := []string{"start a", "end a", "start b", "end b"}
+	if len(events) != len(expected) {
+		t.Fatalf("expected events %v. Got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("expected events %v. Got %v", expected, events)
+		}
+	}
+
+	voice.mu.Lock()
+	defer voice.mu.Unlock()
+	if len(voice.speaking) != 3 || !voice.speaking[0] || !voice.speaking[1] || voice.speaking[2] {
+		t.Errorf("expected SPEAKING for each track, and to stop speaking at the end. Got %v", voice.speaking)
+	}
+}
+
+func TestVoicePlayer_Controls(t *testing.T) {
+	voice := &playerTestVoice{frames: make(chan *voiceFrame)}
+
+	var skipped, failed bool
+	player := NewVoicePlayer(voice, &VoicePlayerConfig{
+		TrackEnd: func(track *VoiceTrack, skip bool) {
+			skipped = skipped || skip
+		},
+		TrackError: func(track *VoiceTrack, err error) {
+			failed = true
+		},
+	})
+	defer player.Stop()
+
+	player.Enqueue(dcaTrack('a', 1000), dcaTrack('b', 1))
+	voice.expect(t, []byte{'a', 0})
+	if player.NowPlaying() == nil || player.NowPlaying().Title != "a" {
+		t.Errorf("expected track a to be playing. Got %+v", player.NowPlaying())
+	}
+	if queue := player.Queue(); len(queue) != 1 || queue[0].Title != "b" {
+		t.Errorf("expected track b to be queued. Got %v", queue)
+	}
+
+	// the player keeps sending frames until it handles the pause
+	paused := make(chan error)
+	go func() {
+		paused <- player.Pause()
+	}()
+	time.Sleep(10 * time.Millisecond) // the test and player otherwise hands frames back and forth without yielding
+	played := 1 + voice.until(t, opusSilenceFrame)
+	voice.expect(t, opusSilenceFrame, opusSilenceFrame, opusSilenceFrame, opusSilenceFrame)
+	if err := <-paused; err != nil {
+		t.Fatal(err)
+	}
+	if position := time.Duration(played) * 20 * time.Millisecond; !player.Paused() || player.Position() != position {
+		t.Errorf("expected the player to be paused at %s. Got %s", position, player.Position())
+	}
+
+	if err := player.Seek(110 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if player.Position() != 100*time.Millisecond {
+		t.Errorf("expected seeking to move to the start of the frame. Got %s", player.Position())
+	}
+	if err := player.Seek(20 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if player.Position() != 20*time.Millisecond {
+		t.Errorf("expected seeking backwards to move to 20ms. Got %s", player.Position())
+	}
+
+	if err := player.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	voice.expect(t, []byte{'a', 1})
+
+	skip := make(chan error)
+	go func() {
+		skip <- player.Skip()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	voice.until(t, []byte{'b', 0})
+	if err := <-skip; err != nil {
+		t.Fatal(err)
+	}
+	voice.expectSilence(t)
+
+	if !skipped || failed {
+		t.Errorf("expected track a to be skipped without errors")
+	}
+
+	player.Stop()
+	if err := player.Resume(); err == nil {
+		t.Error("expected an error after the player has stopped")
+	}
+}
+
+func TestVoicePlayer_SeekPastEnd(t *testing.T) {
+	voice := &playerTestVoice{frames: make(chan *voiceFrame)}
+
+	ended := make(chan bool, 1)
+	player := NewVoicePlayer(voice, &VoicePlayerConfig{
+		TrackEnd: func(track *VoiceTrack, skipped bool) {
+			ended <- skipped
+		},
+	})
+	defer player.Stop()
+
+	player.Enqueue(dcaTrack('a', 200))
+	voice.expect(t, []byte{'a', 0})
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		voice.until(t, opusSilenceFrame)
+	}()
+	if err := player.Seek(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case skipped := <-ended:
+		if skipped {
+			t.Error("expected the track to end, not to be skipped")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the track to end")
+	}
+	<-drained
+	voice.expect(t, opusSilenceFrame, opusSilenceFrame, opusSilenceFrame, opusSilenceFrame)
+}
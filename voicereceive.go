@@ -0,0 +1,151 @@
+package disgord
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/gateway"
+)
+
+const (
+	rtpHeaderSize  = 12
+	rtpVersion     = 2
+	rtpPayloadType = 0x78 // opus
+
+	// voiceReceiveBufferSize is the number of received voice packets that are buffered, before packets are dropped
+	voiceReceiveBufferSize = 100
+)
+
+// VoicePacket is a decrypted opus frame sent by a user in the voice channel
+type VoicePacket struct {
+	// SSRC identifies the source of the voice packet
+	SSRC uint32
+
+	// UserID is the user sending the voice packet. It is zero until Discord tells which user the SSRC
+	// belongs to, which happens when the user starts speaking.
+	UserID Snowflake
+
+	// Sequence and Timestamp are taken from the RTP header, and can be used to order the packets and
+	// detect packet loss. The timestamp is increased by 960 for every 20ms frame.
+	Sequence  uint16
+	Timestamp uint32
+
+	Opus []byte
+}
+
+// openVoicePacket parses a RTP packet and decrypts the opus payload. RTCP packets, and any other non-opus
+// packets, results in an error.
+func openVoicePacket(mode string, data []byte, secretKey *[32]byte) (*VoicePacket, error) {
+	// https://tools.ietf.org/html/rfc3550#section-5.1
+	if len(data) < rtpHeaderSize || data[0]>>6 != rtpVersion {
+		return nil, errors.New("not a RTP packet")
+	}
+	if data[1]&0x7F != rtpPayloadType {
+		return nil, errors.New("not an opus RTP packet")
+	}
+
+	headerSize := rtpHeaderSize + 4*int(data[0]&0x0F) // CSRC identifiers
+	if len(data) < headerSize {
+		return nil, errors.New("RTP packet is too short")
+	}
+
+	opus, err := openVoicePayload(mode, data, headerSize, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// padding
+	if data[0]&0x20 != 0 {
+		if len(opus) == 0 || int(opus[len(opus)-1]) > len(opus) {
+			return nil, errors.New("invalid RTP padding")
+		}
+		opus = opus[:len(opus)-int(opus[len(opus)-1])]
+	}
+
+	// Discord encrypts the header extension together with the payload
+	// https://tools.ietf.org/html/rfc8285#section-4.2
+	if data[0]&0x10 != 0 {
+		if len(opus) < 4 {
+			return nil, errors.New("invalid RTP header extension")
+		}
+		extensionSize := 4 + 4*int(binary.BigEndian.Uint16(opus[2:4]))
+		if len(opus) < extensionSize {
+			return nil, errors.New("invalid RTP header extension")
+		}
+		opus = opus[extensionSize:]
+	}
+
+	return &VoicePacket{
+		Sequence:  binary.BigEndian.Uint16(data[2:4]),
+		Timestamp: binary.BigEndian.Uint32(data[4:8]),
+		SSRC:      binary.BigEndian.Uint32(data[8:12]),
+		Opus:      opus,
+	}, nil
+}
+
+func (v *voiceImpl) Receive() <-chan *VoicePacket {
+	return v.receive
+}
+
+func (v *voiceImpl) onSpeaking(evt *gateway.VoiceSpeakingUpdate) {
+	v.Lock()
+	defer v.Unlock()
+
+	v.ssrcUsers[evt.SSRC] = evt.UserID
+}
+
+func (v *voiceImpl) onClientDisconnect(evt *gateway.VoiceClientDisconnect) {
+	v.Lock()
+	defer v.Unlock()
+
+	for ssrc, userID := range v.ssrcUsers {
+		if userID == evt.UserID {
+			delete(v.ssrcUsers, ssrc)
+		}
+	}
+}
+
+func (v *voiceImpl) opusReceiveLoop() {
+	defer close(v.receive)
+
+	buffer := make([]byte, 1500) // MTU
+	for {
+		// the voice server, and with it the UDP connection and key, might change during a migration
+		v.Lock()
+		udp, mode, secretKey := v.udp, v.mode, v.secretKey
+		v.Unlock()
+
+		n, err := udp.Read(buffer)
+		if err != nil {
+			v.Lock()
+			migrated := v.udp != udp
+			v.Unlock()
+			if migrated {
+				continue
+			}
+
+			select {
+			case <-v.close:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+			continue
+		}
+
+		packet, err := openVoicePacket(mode, buffer[:n], &secretKey)
+		if err != nil {
+			continue // RTCP
+		}
+
+		v.Lock()
+		packet.UserID = v.ssrcUsers[packet.SSRC]
+		v.Unlock()
+
+		select {
+		case v.receive <- packet:
+		default:
+			v.c.log.Debug("voice receive buffer is full, dropping packet from SSRC", packet.SSRC)
+		}
+	}
+}
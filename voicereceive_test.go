@@ -0,0 +1,169 @@
+// +build !integration
+
+package disgord
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/gateway"
+)
+
+func sealVoicePacket(t *testing.T, mode string, header, payload []byte, secretKey *[32]byte) []byte {
+	var liteNonce uint32
+	packet, err := sealVoicePayload(mode, header, payload, secretKey, &liteNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func rtpHeader(sequence uint16, timestamp, ssrc uint32) []byte {
+	header := make([]byte, rtpHeaderSize)
+	header[0] = 0x80
+	header[1] = rtpPayloadType
+	binary.BigEndian.PutUint16(header[2:4], sequence)
+	binary.BigEndian.PutUint32(header[4:8], timestamp)
+	binary.BigEndian.PutUint32(header[8:12], ssrc)
+	return header
+}
+
+func TestOpenVoicePacket(t *testing.T) {
+	secretKey := [32]byte{1, 2, 3}
+	opus := []byte{0xF8, 0xFF, 0xFE}
+
+	for _, mode := range defaultVoiceEncryptionModes {
+		t.Run(mode, func(t *testing.T) {
+			packet, err := openVoicePacket(mode, sealVoicePacket(t, mode, rtpHeader(7, 960, 42), opus, &secretKey), &secretKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if packet.Sequence != 7 || packet.Timestamp != 960 || packet.SSRC != 42 {
+				t.Errorf("unexpected RTP header fields %+v", packet)
+			}
+			if !bytes.Equal(packet.Opus, opus) {
+				t.Errorf("expected opus frame %v. Got %v", opus, packet.Opus)
+			}
+		})
+	}
+	t.Run("extension", func(t *testing.T) {
+		header := rtpHeader(7, 960, 42)
+		header[0] |= 0x10
+		extension := []byte{0xBE, 0xDE, 0, 1, 0x10, 0xAA, 0, 0}
+		payload := append(extension, opus...)
+
+		mode := VoiceModeXSalsa20Poly1305Lite
+		packet, err := openVoicePacket(mode, sealVoicePacket(t, mode, header, payload, &secretKey), &secretKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(packet.Opus, opus) {
+			t.Errorf("expected the header extension to be stripped. Got %v", packet.Opus)
+		}
+	})
+	t.Run("rtcp", func(t *testing.T) {
+		header := rtpHeader(7, 960, 42)
+		header[1] = 0xC9 // receiver report
+		mode := VoiceModeXSalsa20Poly1305
+		if _, err := openVoicePacket(mode, sealVoicePacket(t, mode, header, opus, &secretKey), &secretKey); err == nil {
+			t.Error("expected RTCP packets to be rejected")
+		}
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		otherKey := [32]byte{4, 5, 6}
+		mode := VoiceModeXSalsa20Poly1305Suffix
+		if _, err := openVoicePacket(mode, sealVoicePacket(t, mode, rtpHeader(7, 960, 42), opus, &otherKey), &secretKey); err == nil {
+			t.Error("expected decryption to fail")
+		}
+	})
+}
+
+func TestSealVoicePayload_LiteNonce(t *testing.T) {
+	secretKey := [32]byte{1, 2, 3}
+	var liteNonce uint32
+	for i := uint32(1); i <= 2; i++ {
+		packet, err := sealVoicePayload(VoiceModeXSalsa20Poly1305Lite, rtpHeader(0, 0, 42), []byte{1}, &secretKey, &liteNonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nonce := binary.BigEndian.Uint32(packet[len(packet)-4:]); nonce != i {
+			t.Errorf("expected nonce %d. Got %d", i, nonce)
+		}
+	}
+}
+
+func TestSelectVoiceEncryptionMode(t *testing.T) {
+	offered := []string{"aead_aes256_gcm", VoiceModeXSalsa20Poly1305Suffix, VoiceModeXSalsa20Poly1305Lite}
+
+	mode, err := selectVoiceEncryptionMode(nil, offered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != VoiceModeXSalsa20Poly1305Lite {
+		t.Errorf("expected the default preference to select %s. Got %s", VoiceModeXSalsa20Poly1305Lite, mode)
+	}
+
+	mode, err = selectVoiceEncryptionMode([]string{"aead_aes256_gcm", VoiceModeXSalsa20Poly1305Suffix}, offered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != VoiceModeXSalsa20Poly1305Suffix {
+		t.Errorf("expected unsupported modes to be skipped. Got %s", mode)
+	}
+
+	if _, err = selectVoiceEncryptionMode(nil, []string{VoiceModeXSalsa20Poly1305 + "_unknown"}); err == nil {
+		t.Error("expected an error when no preferred mode is offered")
+	}
+}
+
+func TestVoiceImpl_Receive(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	v := &voiceImpl{
+		udp:       local,
+		mode:      VoiceModeXSalsa20Poly1305Lite,
+		secretKey: [32]byte{1, 2, 3},
+		receive:   make(chan *VoicePacket, voiceReceiveBufferSize),
+		close:     make(chan struct{}),
+		ssrcUsers: make(map[uint32]Snowflake),
+	}
+	go v.opusReceiveLoop()
+
+	v.onSpeaking(&gateway.VoiceSpeakingUpdate{UserID: 228846961774559232, SSRC: 42})
+	opus := []byte{0xF8, 0xFF, 0xFE}
+	if _, err := remote.Write(sealVoicePacket(t, v.mode, rtpHeader(1, 0, 42), opus, &v.secretKey)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case packet := <-v.Receive():
+		if packet.UserID != 228846961774559232 {
+			t.Errorf("expected SSRC to be mapped to the speaking user. Got %d", packet.UserID)
+		}
+		if !bytes.Equal(packet.Opus, opus) {
+			t.Errorf("expected opus frame %v. Got %v", opus, packet.Opus)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("voice packet was not received")
+	}
+
+	v.onClientDisconnect(&gateway.VoiceClientDisconnect{UserID: 228846961774559232})
+	if _, exists := v.ssrcUsers[42]; exists {
+		t.Error("expected SSRC mapping to be removed when the user disconnects")
+	}
+
+	close(v.close)
+	_ = local.Close()
+	select {
+	case _, open := <-v.Receive():
+		if open {
+			t.Error("expected no more packets")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("receive channel was not closed")
+	}
+}
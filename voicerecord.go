@@ -0,0 +1,155 @@
+package disgord
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// opusSilenceFrame is a 20ms frame of silence, used to fill the gaps in a recording
+var opusSilenceFrame = []byte{0xF8, 0xFF, 0xFE}
+
+// voiceRecording is the Ogg Opus stream of a single user
+type voiceRecording struct {
+	ogg *oggOpusWriter
+
+	// ssrc of the last packet, which changes after a voice server migration
+	ssrc uint32
+	// next is the RTP timestamp expected for the next packet
+	next uint32
+}
+
+// voiceRecorder writes the received voice of each user to its own Ogg Opus stream. Gaps are filled with
+// silence, such that the streams of all users starts at the same time and lines up.
+type voiceRecorder struct {
+	create func(userID Snowflake) (io.WriteCloser, error)
+	log    Logger
+
+	start time.Time
+	now   func() time.Time
+
+	users  map[Snowflake]*voiceRecording
+	serial uint32
+}
+
+func newVoiceRecorder(create func(userID Snowflake) (io.WriteCloser, error), log Logger) *voiceRecorder {
+	return &voiceRecorder{
+		create: create,
+		log:    log,
+		start:  time.Now(),
+		now:    time.Now,
+		users:  make(map[Snowflake]*voiceRecording),
+	}
+}
+
+// run records the packets until the channel is closed, and then ends every stream
+func (r *voiceRecorder) run(packets <-chan *VoicePacket) {
+	for packet := range packets {
+		r.record(packet)
+	}
+	r.close()
+}
+
+func (r *voiceRecorder) record(packet *VoicePacket) {
+	if packet.UserID.IsZero() {
+		return // Discord has not yet told which user is speaking
+	}
+
+	rec, exists := r.users[packet.UserID]
+	if !exists {
+		rec = r.newRecording(packet.UserID)
+		r.users[packet.UserID] = rec
+	}
+	if rec == nil {
+		return // the user could not be recorded
+	}
+
+	var silence int64
+	if rec.ogg.granule == 0 || rec.ssrc != packet.SSRC {
+		// a new RTP stream, which can only be lined up by the time since the recording started
+		elapsed := int64(r.now().Sub(r.start) * opusSampleRate / time.Second)
+		silence = elapsed - rec.ogg.granule
+		rec.ssrc = packet.SSRC
+	} else {
+		gap := packet.Timestamp - rec.next
+		if gap >= 1<<31 {
+			return // a late or duplicate packet
+		}
+		silence = int64(gap)
+	}
+
+	var err error
+	for ; silence >= opusFrameSamples && err == nil; silence -= opusFrameSamples {
+		err = rec.ogg.write(opusSilenceFrame, opusFrameSamples)
+	}
+	if err == nil {
+		err = rec.ogg.write(packet.Opus, opusFrameSamples)
+	}
+	if err != nil {
+		r.log.Error("unable to record voice of user", packet.UserID, ":", err)
+		_ = rec.ogg.close()
+		r.users[packet.UserID] = nil
+		return
+	}
+	rec.next = packet.Timestamp + opusFrameSamples
+}
+
+func (r *voiceRecorder) newRecording(userID Snowflake) *voiceRecording {
+	w, err := r.create(userID)
+	if err != nil {
+		r.log.Error("unable to create voice recording for user", userID, ":", err)
+		return nil
+	}
+
+	r.serial++
+	ogg, err := newOggOpusWriter(w, r.serial)
+	if err != nil {
+		r.log.Error("unable to create voice recording for user", userID, ":", err)
+		_ = w.Close()
+		return nil
+	}
+	return &voiceRecording{ogg: ogg}
+}
+
+func (r *voiceRecorder) close() {
+	for userID, rec := range r.users {
+		if rec == nil {
+			continue
+		}
+		if err := rec.ogg.close(); err != nil {
+			r.log.Error("unable to close voice recording of user", userID, ":", err)
+		}
+	}
+	r.users = nil
+}
+
+func (v *voiceImpl) Record(create func(userID Snowflake) (io.WriteCloser, error)) error {
+	v.Lock()
+	defer v.Unlock()
+
+	if !v.ready.Load() {
+		return errors.New("attempting to record a closed voice connection")
+	}
+	if v.recording != nil {
+		return errors.New("the voice connection is already being recorded")
+	}
+
+	recorder := newVoiceRecorder(create, v.c.log)
+	v.recording = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		recorder.run(v.receive)
+	}(v.recording)
+	return nil
+}
+
+// waitForRecording waits until the recorded files are closed, if the voice connection is recorded
+func (v *voiceImpl) waitForRecording() {
+	v.Lock()
+	recording := v.recording
+	v.Unlock()
+
+	if recording != nil {
+		<-recording
+	}
+}
@@ -0,0 +1,124 @@
+// +build !integration
+
+package disgord
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/andersfylling/disgord/internal/logger"
+)
+
+type recordingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *recordingBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func readRecording(t *testing.T, data []byte) (frames [][]byte) {
+	ogg, err := newOggOpusReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		frame, err := ogg.next()
+		if err == io.EOF {
+			return frames
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame.opus)
+	}
+}
+
+func TestVoiceRecorder(t *testing.T) {
+	const userA, userB Snowflake = 228846961774559232, 486833611564253184
+	files := map[Snowflake]*recordingBuffer{}
+	recorder := newVoiceRecorder(func(userID Snowflake) (io.WriteCloser, error) {
+		files[userID] = &recordingBuffer{}
+		return files[userID], nil
+	}, logger.Empty{})
+
+	start := recorder.start
+	now := start
+	recorder.now = func() time.Time {
+		return now
+	}
+
+	recorder.record(&VoicePacket{UserID: userA, SSRC: 1, Timestamp: 1000, Opus: []byte{'a', 1}})
+	recorder.record(&VoicePacket{UserID: userA, SSRC: 1, Timestamp: 1960, Opus: []byte{'a', 2}})
+	recorder.record(&VoicePacket{UserID: userA, SSRC: 1, Timestamp: 1960 + 3*960, Opus: []byte{'a', 3}}) // 2 frames lost
+	recorder.record(&VoicePacket{UserID: userA, SSRC: 1, Timestamp: 1960, Opus: []byte{'a', 2}})         // late
+	recorder.record(&VoicePacket{SSRC: 3, Timestamp: 0, Opus: []byte{'?'}})                              // unknown user
+
+	now = start.Add(100 * time.Millisecond)
+	recorder.record(&VoicePacket{UserID: userB, SSRC: 2, Timestamp: 50, Opus: []byte{'b', 1}})
+	now = start.Add(200 * time.Millisecond)
+	recorder.record(&VoicePacket{UserID: userB, SSRC: 4, Timestamp: 9, Opus: []byte{'b', 2}}) // migrated
+
+	// the recordings are closed with the voice connection
+	packets := make(chan *VoicePacket)
+	close(packets)
+	recorder.run(packets)
+
+	if len(files) != 2 {
+		t.Fatalf("expected a recording for each user. Got %d", len(files))
+	}
+
+	silence := opusSilenceFrame
+	expected := map[Snowflake][][]byte{
+		userA: {{'a', 1}, {'a', 2}, silence, silence, {'a', 3}},
+		userB: {silence, silence, silence, silence, silence, {'b', 1}, silence, silence, silence, silence, {'b', 2}},
+	}
+	for userID, frames := range expected {
+		file := files[userID]
+		if !file.closed {
+			t.Errorf("expected the recording of %d to be closed", userID)
+		}
+
+		recorded := readRecording(t, file.Bytes())
+		if len(recorded) != len(frames) {
+			t.Fatalf("expected %d frames for %d. Got %d", len(frames), userID, len(recorded))
+		}
+		for i := range frames {
+			if !bytes.Equal(recorded[i], frames[i]) {
+				t.Errorf("frame %d of %d: expected %v. Got %v", i, userID, frames[i], recorded[i])
+			}
+		}
+	}
+}
+
+func TestOggOpusWriter_Pages(t *testing.T) {
+	out := &recordingBuffer{}
+	ogg, err := newOggOpusWriter(out, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large := bytes.Repeat([]byte{1}, 1000)
+	for i := 0; i < 120; i++ {
+		if err = ogg.write(large, opusFrameSamples); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = ogg.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := readRecording(t, out.Bytes())
+	if len(frames) != 120 {
+		t.Fatalf("expected 120 frames. Got %d", len(frames))
+	}
+	for i := range frames {
+		if !bytes.Equal(frames[i], large) {
+			t.Fatalf("frame %d was not recorded correctly", i)
+		}
+	}
+}